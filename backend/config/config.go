@@ -0,0 +1,30 @@
+// Package config holds settings shared by several packages
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// MaxMessageSize is the largest raw MIME message accepted, by the SMTP
+// server (advertised with SIZE) and the Gmail upload endpoint
+const MaxMessageSize = 25 * 1024 * 1024
+
+var publicURL string
+
+func init() {
+	publicURL = strings.TrimSuffix(os.Getenv("RESENDPIT_PUBLIC_URL"), "/")
+	if publicURL == "" {
+		port := os.Getenv("PORT")
+		if port == "" {
+			port = "3000"
+		}
+		publicURL = "http://localhost:" + port
+	}
+}
+
+// PublicURL returns the base URL applications use to reach Resend-Pit, used
+// in links Resend-Pit generates (SNS subscribe URLs, unsubscribe links, ...)
+func PublicURL() string {
+	return publicURL
+}
@@ -1,22 +1,79 @@
 package handlers
 
 import (
+	"encoding/json"
 	"net/http"
 
 	"github.com/appaka/resendpit/store"
 )
 
-// APIEmails handles GET/DELETE /api/emails
-func APIEmails(w http.ResponseWriter, r *http.Request) {
+// APIEmails handles GET/DELETE /api/emails, across all mailboxes
+func (s *Server) APIEmails(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		writeJSON(w, http.StatusOK, map[string]interface{}{
-			"emails": store.GetEmails(),
+			"emails": s.store.GetEmails(),
 		})
 	case http.MethodDelete:
-		store.ClearEmails()
+		s.store.ClearEmails(store.AllMailboxes)
 		writeJSON(w, http.StatusOK, map[string]bool{"success": true})
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
+
+// APIEmail handles GET /api/emails/{id}. Reading an email marks it as used
+// for LRU eviction.
+func (s *Server) APIEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	email, ok := s.store.GetEmail(r.PathValue("id"))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Email not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, email)
+}
+
+// APIEmailEvents handles POST /api/emails/{id}/events, simulating a recipient
+// opening the email or clicking a link in it. For SES emails sent with a
+// configuration set this publishes the matching Open or Click event.
+func (s *Server) APIEmailEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	email, ok := s.store.GetEmail(r.PathValue("id"))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Email not found"})
+		return
+	}
+
+	var req struct {
+		Type string `json:"type"`
+		Link string `json:"link"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid JSON in request body"})
+		return
+	}
+
+	switch req.Type {
+	case "open":
+		s.publishSESEngagementEvent(email, "Open", "", r.UserAgent())
+	case "click":
+		if req.Link == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "link is required for click events"})
+			return
+		}
+		s.publishSESEngagementEvent(email, "Click", req.Link, r.UserAgent())
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "type must be open or click"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"net/http"
+)
+
+// APISMS handles GET/DELETE /api/sms
+func (s *Server) APISMS(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"sms": s.store.GetSMSMessages(),
+		})
+	case http.MethodDelete:
+		s.store.ClearSMS()
+		writeJSON(w, http.StatusOK, map[string]bool{"success": true})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+// base64DecodedSize returns the decoded size of base64 attachment content,
+// or nil when there is no content
+func base64DecodedSize(content string) *int {
+	if content == "" {
+		return nil
+	}
+	size := base64.StdEncoding.DecodedLen(len(content))
+	if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(content)); err == nil {
+		size = len(decoded)
+	}
+	return &size
+}
+
+// contentTypeByFilename guesses an attachment's content type from its
+// extension
+func contentTypeByFilename(filename string) string {
+	return mime.TypeByExtension(filepath.Ext(filename))
+}
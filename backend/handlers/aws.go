@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// XML namespaces of the AWS Query APIs served on POST /
+const (
+	sesV1Namespace = "http://ses.amazonaws.com/doc/2010-12-01/"
+	snsNamespace   = "http://sns.amazonaws.com/doc/2010-03-31/"
+)
+
+// awsErrorStatus maps AWS error codes to the HTTP status the service returns
+// them with. Codes not listed are client errors sent with 400.
+var awsErrorStatus = map[string]int{
+	// SES v2 (REST-JSON protocol)
+	"NotFoundException":        http.StatusNotFound,
+	"TooManyRequestsException": http.StatusTooManyRequests,
+	"ConflictException":        http.StatusConflict,
+
+	// SNS and shared Query protocol codes
+	"NotFound":        http.StatusNotFound,
+	"InternalFailure": http.StatusInternalServerError,
+}
+
+// awsErrorFault returns the Query protocol fault type of an error code
+func awsErrorFault(code string) string {
+	if awsErrorStatusFor(code) >= http.StatusInternalServerError {
+		return "Receiver"
+	}
+	return "Sender"
+}
+
+func awsErrorStatusFor(code string) int {
+	if status, ok := awsErrorStatus[code]; ok {
+		return status
+	}
+	return http.StatusBadRequest
+}
+
+// queryEnvelope wraps an action result in the AWS Query API response envelope
+type queryEnvelope struct {
+	XMLName          xml.Name
+	Xmlns            string `xml:"xmlns,attr"`
+	Result           interface{}
+	ResponseMetadata struct {
+		RequestId string `xml:"RequestId"`
+	} `xml:"ResponseMetadata"`
+}
+
+// queryErrorResponse is the AWS Query API error document
+type queryErrorResponse struct {
+	XMLName xml.Name `xml:"ErrorResponse"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Error   struct {
+		Type    string `xml:"Type"`
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	} `xml:"Error"`
+	RequestId string `xml:"RequestId"`
+}
+
+// writeSESv1Result writes an "<Action>Response" document. The result must be a
+// struct whose XMLName is "<Action>Result".
+func writeSESv1Result(w http.ResponseWriter, action string, result interface{}) {
+	writeQueryResult(w, sesV1Namespace, action, result)
+}
+
+// writeSESv1Error writes an SES v1 error. The HTTP status is derived from the code.
+func writeSESv1Error(w http.ResponseWriter, code string, message string) {
+	writeQueryError(w, sesV1Namespace, code, message)
+}
+
+// writeSESv2Error writes an SES v2 error. The HTTP status is derived from the
+// code, which is also sent in the x-amzn-ErrorType header the AWS SDKs use to
+// pick the exception class.
+func writeSESv2Error(w http.ResponseWriter, code string, message string) {
+	requestID := uuid.NewString()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("x-amzn-RequestId", requestID)
+	w.Header().Set("x-amzn-ErrorType", code)
+	w.WriteHeader(awsErrorStatusFor(code))
+	json.NewEncoder(w).Encode(map[string]string{
+		"__type":  code,
+		"message": message,
+	})
+}
+
+func writeQueryResult(w http.ResponseWriter, namespace string, action string, result interface{}) {
+	envelope := queryEnvelope{
+		XMLName: xml.Name{Local: action + "Response"},
+		Xmlns:   namespace,
+		Result:  result,
+	}
+	envelope.ResponseMetadata.RequestId = uuid.NewString()
+
+	writeXML(w, http.StatusOK, envelope.ResponseMetadata.RequestId, envelope)
+}
+
+func writeQueryError(w http.ResponseWriter, namespace string, code string, message string) {
+	resp := queryErrorResponse{Xmlns: namespace, RequestId: uuid.NewString()}
+	resp.Error.Type = awsErrorFault(code)
+	resp.Error.Code = code
+	resp.Error.Message = message
+
+	writeXML(w, awsErrorStatusFor(code), resp.RequestId, resp)
+}
+
+func writeXML(w http.ResponseWriter, status int, requestID string, data interface{}) {
+	w.Header().Set("Content-Type", "text/xml")
+	w.Header().Set("x-amzn-RequestId", requestID)
+	w.WriteHeader(status)
+	io.WriteString(w, xml.Header)
+	xml.NewEncoder(w).Encode(data)
+}
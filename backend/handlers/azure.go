@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/appaka/resendpit/types"
+	"github.com/google/uuid"
+)
+
+// azureEmailMessage is the body of an ACS POST /emails:send request
+type azureEmailMessage struct {
+	SenderAddress string `json:"senderAddress"`
+	Content       struct {
+		Subject   string `json:"subject"`
+		PlainText string `json:"plainText"`
+		HTML      string `json:"html"`
+	} `json:"content"`
+	Recipients struct {
+		To  []azureEmailAddress `json:"to"`
+		CC  []azureEmailAddress `json:"cc"`
+		BCC []azureEmailAddress `json:"bcc"`
+	} `json:"recipients"`
+	ReplyTo                        []azureEmailAddress `json:"replyTo"`
+	Headers                        map[string]string   `json:"headers"`
+	Attachments                    []azureAttachment   `json:"attachments"`
+	UserEngagementTrackingDisabled *bool               `json:"userEngagementTrackingDisabled"`
+}
+
+type azureEmailAddress struct {
+	Address     string `json:"address"`
+	DisplayName string `json:"displayName"`
+}
+
+type azureAttachment struct {
+	Name            string `json:"name"`
+	ContentType     string `json:"contentType"`
+	ContentInBase64 string `json:"contentInBase64"`
+	ContentID       string `json:"contentId"`
+}
+
+// azureOperationStatus is the body of the send response and of operation
+// polls
+type azureOperationStatus struct {
+	ID     string          `json:"id"`
+	Status string          `json:"status"`
+	Error  *azureErrorBody `json:"error"`
+}
+
+type azureErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// azureRetryAfter is the poll interval suggested to clients, in seconds
+const azureRetryAfter = "1"
+
+// azureProvider emulates Azure Communication Services Email
+type azureProvider struct{}
+
+func init() {
+	registerProvider(azureProvider{})
+}
+
+func (azureProvider) Name() string { return "azure" }
+
+func (azureProvider) Routes(s *Server) []Route {
+	return []Route{
+		{Pattern: "/emails:send", Method: http.MethodPost, Decode: s.decodeAzureEmailSend, Respond: respondAzureEmailSend},
+		{Pattern: "/emails/operations/{id}", Handler: s.GetAzureEmailOperation},
+	}
+}
+
+func (azureProvider) WriteError(w http.ResponseWriter, r *http.Request, err *RequestError) {
+	writeJSON(w, err.Status, struct {
+		Error azureErrorBody `json:"error"`
+	}{azureErrorBody{Code: err.Code, Message: err.Message}})
+}
+
+// decodeAzureEmailSend decodes a POST /emails:send request. The send is a
+// long-running operation: a repeated Operation-Id header returns the
+// existing operation without capturing the email again.
+func (s *Server) decodeAzureEmailSend(r *http.Request) ([]Message, *RequestError) {
+	if err := azurePreamble(r); err != nil {
+		return nil, err
+	}
+
+	var msg azureEmailMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		return nil, azureBadRequest("BadRequest", "The request body is not valid JSON.")
+	}
+	if msg.SenderAddress == "" {
+		return nil, azureBadRequest("InvalidSenderAddress", "The senderAddress field is required.")
+	}
+	if len(msg.Recipients.To)+len(msg.Recipients.CC)+len(msg.Recipients.BCC) == 0 {
+		return nil, azureBadRequest("EmptyRecipients", "At least one recipient is required.")
+	}
+	if msg.Content.Subject == "" {
+		return nil, azureBadRequest("EmptySubject", "The subject field is required.")
+	}
+	if msg.Content.PlainText == "" && msg.Content.HTML == "" {
+		return nil, azureBadRequest("EmptyContent", "Either plainText or html content is required.")
+	}
+
+	opID := r.Header.Get("Operation-Id")
+	if opID == "" {
+		opID = uuid.NewString()
+	}
+	email := azureEmail(&msg)
+	email.ID = uuid.NewString()
+	email.CreatedAt = time.Now().UTC()
+	email.Metadata = map[string]string{"messageId": opID}
+	if msg.UserEngagementTrackingDisabled != nil {
+		email.Metadata["userEngagementTrackingDisabled"] = strconv.FormatBool(*msg.UserEngagementTrackingDisabled)
+	}
+	op, created := s.store.AddOperation(types.Operation{
+		ID:        opID,
+		Status:    "Running",
+		EmailID:   email.ID,
+		CreatedAt: email.CreatedAt,
+	})
+	return []Message{{Email: email, Skip: !created, Result: op}}, nil
+}
+
+// respondAzureEmailSend answers 202 with an Operation-Location to poll
+func respondAzureEmailSend(w http.ResponseWriter, r *http.Request, messages []Message) {
+	op := messages[0].Result.(types.Operation)
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	location := url.URL{
+		Scheme:   scheme,
+		Host:     r.Host,
+		Path:     "/emails/operations/" + op.ID,
+		RawQuery: url.Values{"api-version": {r.URL.Query().Get("api-version")}}.Encode(),
+	}
+	w.Header().Set("Operation-Location", location.String())
+	w.Header().Set("Retry-After", azureRetryAfter)
+	writeJSON(w, http.StatusAccepted, azureOperationStatus{ID: op.ID, Status: op.Status})
+}
+
+// GetAzureEmailOperation handles GET /emails/operations/{id}. An operation
+// reports Running on its first poll and Succeeded afterwards.
+func (s *Server) GetAzureEmailOperation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := azurePreamble(r); err != nil {
+		azureProvider{}.WriteError(w, r, err)
+		return
+	}
+	op, ok := s.store.PollOperation(r.PathValue("id"))
+	if !ok {
+		azureProvider{}.WriteError(w, r, &RequestError{Status: http.StatusNotFound, Code: "NotFound", Message: "The operation was not found."})
+		return
+	}
+	if op.Status == "Running" {
+		w.Header().Set("Retry-After", azureRetryAfter)
+	}
+	writeJSON(w, http.StatusOK, azureOperationStatus{ID: op.ID, Status: op.Status})
+}
+
+// azurePreamble checks the api-version parameter and that the request is
+// authenticated (HMAC signature or Entra ID token). Any credential is
+// accepted.
+func azurePreamble(r *http.Request) *RequestError {
+	if r.URL.Query().Get("api-version") == "" {
+		return azureBadRequest("MissingApiVersionParameter", "The api-version query parameter (?api-version=) is required for all requests.")
+	}
+	if r.Header.Get("Authorization") == "" {
+		return &RequestError{Status: http.StatusUnauthorized, Code: "Denied", Message: "Denied by the resource provider."}
+	}
+	return nil
+}
+
+func azureEmail(msg *azureEmailMessage) types.Email {
+	email := types.Email{
+		From:    msg.SenderAddress,
+		To:      azureAddresses(msg.Recipients.To),
+		CC:      azureAddresses(msg.Recipients.CC),
+		BCC:     azureAddresses(msg.Recipients.BCC),
+		ReplyTo: azureAddresses(msg.ReplyTo),
+		Subject: msg.Content.Subject,
+		HTML:    msg.Content.HTML,
+		Text:    msg.Content.PlainText,
+		Headers: msg.Headers,
+	}
+	if email.To == nil {
+		email.To = []string{}
+	}
+	for _, a := range msg.Attachments {
+		att := types.Attachment{
+			Filename:    a.Name,
+			Size:        base64DecodedSize(a.ContentInBase64),
+			ContentType: a.ContentType,
+			ContentID:   a.ContentID,
+			Disposition: "attachment",
+		}
+		if a.ContentID != "" {
+			att.Disposition = "inline"
+		}
+		if att.ContentType == "" {
+			att.ContentType = contentTypeByFilename(a.Name)
+		}
+		email.Attachments = append(email.Attachments, att)
+	}
+	return email
+}
+
+func azureAddresses(list []azureEmailAddress) []string {
+	if len(list) == 0 {
+		return nil
+	}
+	result := make([]string, 0, len(list))
+	for _, addr := range list {
+		result = append(result, formatAddress(addr.DisplayName, addr.Address))
+	}
+	return result
+}
+
+func azureBadRequest(code, message string) *RequestError {
+	return &RequestError{Status: http.StatusBadRequest, Code: code, Message: message}
+}
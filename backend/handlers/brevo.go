@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/appaka/resendpit/types"
+)
+
+// brevoRequest is the body of a Brevo POST /v3/smtp/email request
+type brevoRequest struct {
+	Sender          *brevoAddress          `json:"sender"`
+	To              []brevoAddress         `json:"to"`
+	CC              []brevoAddress         `json:"cc"`
+	BCC             []brevoAddress         `json:"bcc"`
+	ReplyTo         *brevoAddress          `json:"replyTo"`
+	Subject         string                 `json:"subject"`
+	HTMLContent     string                 `json:"htmlContent"`
+	TextContent     string                 `json:"textContent"`
+	TemplateID      int                    `json:"templateId"`
+	Params          map[string]interface{} `json:"params"`
+	Attachment      []brevoAttachment      `json:"attachment"`
+	Headers         map[string]interface{} `json:"headers"`
+	Tags            []string               `json:"tags"`
+	ScheduledAt     string                 `json:"scheduledAt"`
+	BatchID         string                 `json:"batchId"`
+	MessageVersions []brevoMessageVersion  `json:"messageVersions"`
+}
+
+// brevoMessageVersion overrides the recipients and content of the base
+// message. Each version is sent as a separate message.
+type brevoMessageVersion struct {
+	To          []brevoAddress         `json:"to"`
+	CC          []brevoAddress         `json:"cc"`
+	BCC         []brevoAddress         `json:"bcc"`
+	ReplyTo     *brevoAddress          `json:"replyTo"`
+	Params      map[string]interface{} `json:"params"`
+	Subject     string                 `json:"subject"`
+	HTMLContent string                 `json:"htmlContent"`
+	TextContent string                 `json:"textContent"`
+}
+
+type brevoAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+type brevoAttachment struct {
+	URL     string `json:"url"`
+	Content string `json:"content"`
+	Name    string `json:"name"`
+}
+
+// brevoSendResult is the response data of one message version
+type brevoSendResult struct {
+	MessageID string
+	Versioned bool
+}
+
+// brevoError is Brevo's error response
+type brevoError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// brevoParamPattern matches {{ params.name }} placeholders
+var brevoParamPattern = regexp.MustCompile(`\{\{\s*params\.([\w.]+)\s*\}\}`)
+
+// brevoProvider emulates the Brevo transactional email API
+type brevoProvider struct{}
+
+func init() {
+	registerProvider(brevoProvider{})
+}
+
+func (brevoProvider) Name() string { return "brevo" }
+
+func (brevoProvider) Routes(s *Server) []Route {
+	return []Route{
+		{Pattern: "/v3/smtp/email", Method: http.MethodPost, Decode: decodeBrevoEmail, Respond: respondBrevoEmail},
+	}
+}
+
+func (brevoProvider) WriteError(w http.ResponseWriter, r *http.Request, err *RequestError) {
+	writeBrevoError(w, err.Status, err.Code, err.Message)
+}
+
+// decodeBrevoEmail decodes a POST /v3/smtp/email request (Brevo
+// transactional email). Each message version is a separate email.
+func decodeBrevoEmail(r *http.Request) ([]Message, *RequestError) {
+	if r.Header.Get("api-key") == "" {
+		return nil, &RequestError{Status: http.StatusUnauthorized, Code: "unauthorized", Message: "Key not found"}
+	}
+
+	var req brevoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, &RequestError{Status: http.StatusBadRequest, Code: "bad_request", Message: "Input must be a valid JSON object"}
+	}
+	if code, message := validateBrevoRequest(&req); code != "" {
+		return nil, &RequestError{Status: http.StatusBadRequest, Code: code, Message: message}
+	}
+
+	var scheduledAt *time.Time
+	if req.ScheduledAt != "" {
+		t, err := time.Parse(time.RFC3339, req.ScheduledAt)
+		if err != nil {
+			return nil, &RequestError{Status: http.StatusBadRequest, Code: "invalid_parameter", Message: "scheduledAt is not a valid date-time"}
+		}
+		t = t.UTC()
+		scheduledAt = &t
+	}
+
+	versions := req.MessageVersions
+	if len(versions) == 0 {
+		versions = []brevoMessageVersion{{}}
+	}
+	messages := make([]Message, 0, len(versions))
+	for _, version := range versions {
+		messageID := newBrevoMessageID()
+		email := brevoEmail(&req, version, messageID)
+		email.ScheduledAt = scheduledAt
+		messages = append(messages, Message{
+			Email:  email,
+			Result: brevoSendResult{MessageID: messageID, Versioned: len(req.MessageVersions) > 0},
+		})
+	}
+	return messages, nil
+}
+
+// respondBrevoEmail answers 201 with the message ID, or the IDs of all
+// versions when messageVersions was used
+func respondBrevoEmail(w http.ResponseWriter, r *http.Request, messages []Message) {
+	if !messages[0].Result.(brevoSendResult).Versioned {
+		writeJSON(w, http.StatusCreated, map[string]string{"messageId": messages[0].Result.(brevoSendResult).MessageID})
+		return
+	}
+	messageIDs := make([]string, 0, len(messages))
+	for _, m := range messages {
+		messageIDs = append(messageIDs, m.Result.(brevoSendResult).MessageID)
+	}
+	writeJSON(w, http.StatusCreated, map[string][]string{"messageIds": messageIDs})
+}
+
+func validateBrevoRequest(req *brevoRequest) (string, string) {
+	if req.TemplateID == 0 && (req.Sender == nil || req.Sender.Email == "") {
+		return "missing_parameter", "sender is missing"
+	}
+	if len(req.To) == 0 && len(req.MessageVersions) == 0 {
+		return "missing_parameter", "to is missing"
+	}
+	for i, version := range req.MessageVersions {
+		if len(version.To) == 0 {
+			return "missing_parameter", fmt.Sprintf("messageVersions[%d].to is missing", i)
+		}
+	}
+	if req.TemplateID == 0 {
+		if req.Subject == "" {
+			return "missing_parameter", "subject is missing"
+		}
+		if req.HTMLContent == "" && req.TextContent == "" {
+			return "missing_parameter", "htmlContent or textContent is missing"
+		}
+	}
+	for _, a := range req.Attachment {
+		if a.URL == "" && a.Content == "" {
+			return "missing_parameter", "attachment url or content is missing"
+		}
+		if a.Content != "" && a.Name == "" {
+			return "missing_parameter", "attachment name is missing"
+		}
+	}
+	return "", ""
+}
+
+// brevoEmail builds the email for one message version. Params of the
+// version are merged over the message params and replace {{ params.x }}
+// placeholders in inline content.
+func brevoEmail(req *brevoRequest, version brevoMessageVersion, messageID string) types.Email {
+	email := types.Email{
+		To:       brevoAddresses(req.To),
+		CC:       brevoAddresses(req.CC),
+		BCC:      brevoAddresses(req.BCC),
+		Subject:  req.Subject,
+		HTML:     req.HTMLContent,
+		Text:     req.TextContent,
+		Metadata: map[string]string{"messageId": messageID},
+	}
+	if req.Sender != nil {
+		email.From = formatAddress(req.Sender.Name, req.Sender.Email)
+	}
+	replyTo := req.ReplyTo
+
+	if len(version.To) > 0 {
+		email.To = brevoAddresses(version.To)
+	}
+	if len(version.CC) > 0 {
+		email.CC = brevoAddresses(version.CC)
+	}
+	if len(version.BCC) > 0 {
+		email.BCC = brevoAddresses(version.BCC)
+	}
+	if version.ReplyTo != nil {
+		replyTo = version.ReplyTo
+	}
+	if version.Subject != "" {
+		email.Subject = version.Subject
+	}
+	if version.HTMLContent != "" {
+		email.HTML = version.HTMLContent
+	}
+	if version.TextContent != "" {
+		email.Text = version.TextContent
+	}
+	if replyTo != nil && replyTo.Email != "" {
+		email.ReplyTo = []string{formatAddress(replyTo.Name, replyTo.Email)}
+	}
+
+	params := req.Params
+	if len(version.Params) > 0 {
+		params = make(map[string]interface{}, len(req.Params)+len(version.Params))
+		for k, v := range req.Params {
+			params[k] = v
+		}
+		for k, v := range version.Params {
+			params[k] = v
+		}
+	}
+	if req.TemplateID != 0 {
+		email.TemplateID = strconv.Itoa(req.TemplateID)
+		email.TemplateData = params
+	} else if len(params) > 0 {
+		email.Subject = replaceBrevoParams(email.Subject, params)
+		email.HTML = replaceBrevoParams(email.HTML, params)
+		email.Text = replaceBrevoParams(email.Text, params)
+	}
+
+	if req.BatchID != "" {
+		email.Metadata["batchId"] = req.BatchID
+	}
+	for _, tag := range req.Tags {
+		email.Tags = append(email.Tags, types.Tag{Name: "tag", Value: tag})
+	}
+	for key, value := range req.Headers {
+		if email.Headers == nil {
+			email.Headers = map[string]string{}
+		}
+		email.Headers[key] = mustachioString(value)
+	}
+	for _, a := range req.Attachment {
+		email.Attachments = append(email.Attachments, brevoAttachmentInfo(a))
+	}
+	return email
+}
+
+// brevoAttachmentInfo describes an attachment. Attachments given by URL are
+// not downloaded; the URL is recorded instead.
+func brevoAttachmentInfo(a brevoAttachment) types.Attachment {
+	att := types.Attachment{
+		Filename:    a.Name,
+		Size:        base64DecodedSize(a.Content),
+		Disposition: "attachment",
+		URL:         a.URL,
+	}
+	if att.Filename == "" && a.URL != "" {
+		if u, err := url.Parse(a.URL); err == nil {
+			att.Filename = path.Base(u.Path)
+		}
+	}
+	att.ContentType = contentTypeByFilename(att.Filename)
+	return att
+}
+
+func brevoAddresses(list []brevoAddress) []string {
+	if len(list) == 0 {
+		return nil
+	}
+	result := make([]string, 0, len(list))
+	for _, addr := range list {
+		result = append(result, formatAddress(addr.Name, addr.Email))
+	}
+	return result
+}
+
+// replaceBrevoParams replaces {{ params.name }} placeholders, including
+// nested paths such as {{ params.order.id }}
+func replaceBrevoParams(s string, params map[string]interface{}) string {
+	return brevoParamPattern.ReplaceAllStringFunc(s, func(match string) string {
+		name := brevoParamPattern.FindStringSubmatch(match)[1]
+		return mustachioString(lookupMustachio([]interface{}{params}, name))
+	})
+}
+
+// newBrevoMessageID returns an ID in the format Brevo uses,
+// e.g. <202601021504.12345678901@smtp-relay.mailin.fr>
+func newBrevoMessageID() string {
+	n, _ := rand.Int(rand.Reader, big.NewInt(1e11))
+	return fmt.Sprintf("<%s.%011d@smtp-relay.mailin.fr>", time.Now().UTC().Format("200601021504"), n.Int64())
+}
+
+func writeBrevoError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, brevoError{Code: code, Message: message})
+}
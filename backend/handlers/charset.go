@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// windows1252 maps the 0x80-0x9F range of Windows-1252, which differs from
+// ISO-8859-1. Zero entries are undefined and decode to U+FFFD.
+var windows1252 = [32]rune{
+	0x20AC, 0, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0, 0x017D, 0,
+	0, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0, 0x017E, 0x0178,
+}
+
+// iso885915 lists the code points where ISO-8859-15 differs from ISO-8859-1
+var iso885915 = map[byte]rune{
+	0xA4: 0x20AC, 0xA6: 0x0160, 0xA8: 0x0161, 0xB4: 0x017D,
+	0xB8: 0x017E, 0xBC: 0x0152, 0xBD: 0x0153, 0xBE: 0x0178,
+}
+
+// decodeCharset converts text in the given charset to UTF-8. Unknown charsets
+// are returned unchanged.
+func decodeCharset(data []byte, charset string) string {
+	s, err := convertCharset(data, charset)
+	if err != nil {
+		return string(data)
+	}
+	return s
+}
+
+// charsetReader adapts decodeCharset for mime.WordDecoder
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	s, err := convertCharset(data, charset)
+	if err != nil {
+		return nil, err
+	}
+	return strings.NewReader(s), nil
+}
+
+func convertCharset(data []byte, charset string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return string(data), nil
+	case "iso-8859-1", "iso8859-1", "latin1", "l1":
+		return decodeSingleByte(data, nil), nil
+	case "windows-1252", "cp1252":
+		return decodeSingleByte(data, func(b byte) (rune, bool) {
+			if b >= 0x80 && b <= 0x9F {
+				if r := windows1252[b-0x80]; r != 0 {
+					return r, true
+				}
+				return utf8.RuneError, true
+			}
+			return 0, false
+		}), nil
+	case "iso-8859-15", "latin9":
+		return decodeSingleByte(data, func(b byte) (rune, bool) {
+			r, ok := iso885915[b]
+			return r, ok
+		}), nil
+	case "utf-16", "utf-16be", "utf-16le":
+		return decodeUTF16(data, strings.ToLower(charset)), nil
+	}
+	return "", fmt.Errorf("unsupported charset %q", charset)
+}
+
+// decodeSingleByte decodes a Latin-1 based charset, with override handling
+// the code points where the charset differs from ISO-8859-1
+func decodeSingleByte(data []byte, override func(byte) (rune, bool)) string {
+	var sb strings.Builder
+	for _, b := range data {
+		if override != nil {
+			if r, ok := override(b); ok {
+				sb.WriteRune(r)
+				continue
+			}
+		}
+		sb.WriteRune(rune(b))
+	}
+	return sb.String()
+}
+
+func decodeUTF16(data []byte, charset string) string {
+	bigEndian := charset != "utf-16le"
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		bigEndian, data = true, data[2:]
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		bigEndian, data = false, data[2:]
+	}
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		if bigEndian {
+			units = append(units, uint16(data[i])<<8|uint16(data[i+1]))
+		} else {
+			units = append(units, uint16(data[i+1])<<8|uint16(data[i]))
+		}
+	}
+	return string(utf16.Decode(units))
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/appaka/resendpit/types"
+)
+
+// customerIORequest is the body of a Customer.io POST /v1/send/email
+// request. Fields given here override those of the transactional message.
+type customerIORequest struct {
+	TransactionalMessageID interface{}            `json:"transactional_message_id"`
+	To                     string                 `json:"to"`
+	From                   string                 `json:"from"`
+	Subject                string                 `json:"subject"`
+	Body                   string                 `json:"body"`
+	PlaintextBody          string                 `json:"plaintext_body"`
+	Preheader              string                 `json:"preheader"`
+	BCC                    string                 `json:"bcc"`
+	ReplyTo                string                 `json:"reply_to"`
+	Identifiers            map[string]interface{} `json:"identifiers"`
+	MessageData            map[string]interface{} `json:"message_data"`
+	Headers                map[string]string      `json:"headers"`
+	Attachments            map[string]string      `json:"attachments"`
+	SendAt                 int64                  `json:"send_at"`
+	Tracked                *bool                  `json:"tracked"`
+	Language               string                 `json:"language"`
+}
+
+// customerIOProvider emulates the Customer.io App API transactional send
+type customerIOProvider struct{}
+
+func init() {
+	registerProvider(customerIOProvider{})
+}
+
+func (customerIOProvider) Name() string { return "customerio" }
+
+func (customerIOProvider) Routes(s *Server) []Route {
+	return []Route{
+		{Pattern: "/v1/send/email", Method: http.MethodPost, Decode: decodeCustomerIOSendEmail, Respond: respondCustomerIOSendEmail},
+	}
+}
+
+func (customerIOProvider) WriteError(w http.ResponseWriter, r *http.Request, err *RequestError) {
+	writeJSON(w, err.Status, map[string]map[string]string{"meta": {"error": err.Message}})
+}
+
+// decodeCustomerIOSendEmail decodes a POST /v1/send/email request. Inline
+// content is rendered with {{trigger.x}} (message_data) and
+// {{customer.x}} (identifiers) Liquid variables, unescaped like Liquid.
+// Liquid filters and tags are not supported.
+func decodeCustomerIOSendEmail(r *http.Request) ([]Message, *RequestError) {
+	if r.Header.Get("Authorization") == "" {
+		return nil, &RequestError{Status: http.StatusUnauthorized, Message: "Unauthorized request"}
+	}
+
+	var req customerIORequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, &RequestError{Status: http.StatusBadRequest, Message: "invalid JSON body"}
+	}
+	templateID := ""
+	if req.TransactionalMessageID != nil {
+		templateID = mustachioString(req.TransactionalMessageID)
+	}
+	if message := validateCustomerIORequest(&req, templateID); message != "" {
+		return nil, &RequestError{Status: http.StatusBadRequest, Message: message}
+	}
+
+	deliveryID := newCustomerIODeliveryID()
+	model := map[string]interface{}{"trigger": req.MessageData, "customer": req.Identifiers}
+	email := types.Email{
+		From:       req.From,
+		To:         splitAddressList([]string{req.To}),
+		BCC:        splitAddressList([]string{req.BCC}),
+		ReplyTo:    splitAddressList([]string{req.ReplyTo}),
+		Subject:    renderMustachio(req.Subject, model, false),
+		HTML:       renderMustachio(req.Body, model, false),
+		Text:       renderMustachio(req.PlaintextBody, model, false),
+		Headers:    req.Headers,
+		TemplateID: templateID,
+		Metadata:   map[string]string{"messageId": deliveryID},
+	}
+	if templateID != "" {
+		email.TemplateData = req.MessageData
+	}
+	for k, v := range req.Identifiers {
+		email.Metadata["identifiers."+k] = mustachioString(v)
+	}
+	if req.Preheader != "" {
+		email.Metadata["preheader"] = req.Preheader
+	}
+	if req.Language != "" {
+		email.Metadata["language"] = req.Language
+	}
+	if req.Tracked != nil {
+		email.Metadata["tracked"] = strconv.FormatBool(*req.Tracked)
+	}
+	if req.SendAt != 0 {
+		t := time.Unix(req.SendAt, 0).UTC()
+		email.ScheduledAt = &t
+	}
+	// Attachments map file names to base64 content
+	filenames := make([]string, 0, len(req.Attachments))
+	for filename := range req.Attachments {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	for _, filename := range filenames {
+		email.Attachments = append(email.Attachments, types.Attachment{
+			Filename:    filename,
+			Size:        base64DecodedSize(req.Attachments[filename]),
+			ContentType: contentTypeByFilename(filename),
+			Disposition: "attachment",
+		})
+	}
+	return []Message{{Email: email, Result: deliveryID}}, nil
+}
+
+func respondCustomerIOSendEmail(w http.ResponseWriter, r *http.Request, messages []Message) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"delivery_id": messages[0].Result,
+		"queued_at":   messages[0].Email.CreatedAt.Unix(),
+	})
+}
+
+// validateCustomerIORequest returns the error message for an invalid
+// request. Without a transactional message, the sender, subject and body
+// must be given inline.
+func validateCustomerIORequest(req *customerIORequest, templateID string) string {
+	if len(req.Identifiers) == 0 {
+		return "identifiers: required"
+	}
+	if req.To == "" {
+		return "to: required"
+	}
+	if templateID == "" {
+		if req.From == "" {
+			return "from: required when transactional_message_id is not set"
+		}
+		if req.Subject == "" {
+			return "subject: required when transactional_message_id is not set"
+		}
+		if req.Body == "" {
+			return "body: required when transactional_message_id is not set"
+		}
+	}
+	return ""
+}
+
+// newCustomerIODeliveryID returns a base64 delivery ID like Customer.io's
+func newCustomerIODeliveryID() string {
+	b := make([]byte, 18)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -3,74 +3,69 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
-	"time"
 
-	"github.com/appaka/resendpit/store"
 	"github.com/appaka/resendpit/types"
-	"github.com/google/uuid"
 )
 
-// PostEmails handles POST /emails (Resend SDK interceptor)
-func PostEmails(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// resendProvider emulates the Resend API (POST /emails)
+type resendProvider struct{}
+
+func init() {
+	registerProvider(resendProvider{})
+}
+
+func (resendProvider) Name() string { return "resend" }
+
+func (resendProvider) Routes(s *Server) []Route {
+	return []Route{
+		{Pattern: "/emails", Method: http.MethodPost, Decode: decodeResendEmail, Respond: respondResendEmail},
 	}
+}
 
+func (resendProvider) WriteError(w http.ResponseWriter, r *http.Request, err *RequestError) {
+	name := err.Code
+	if name == "" {
+		name = "validation_error"
+	}
+	writeJSON(w, err.Status, types.ValidationError{
+		StatusCode: err.Status,
+		Message:    err.Message,
+		Name:       name,
+	})
+}
+
+// decodeResendEmail decodes a POST /emails request (Resend SDK interceptor)
+func decodeResendEmail(r *http.Request) ([]Message, *RequestError) {
 	var req types.ResendEmailRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, http.StatusUnprocessableEntity, types.ValidationError{
-			StatusCode: 422,
-			Message:    "Invalid JSON in request body.",
-			Name:       "validation_error",
-		})
-		return
+		return nil, resendValidationError("Invalid JSON in request body.")
 	}
 
 	// Validate required fields
 	if req.From == "" {
-		writeJSON(w, http.StatusUnprocessableEntity, types.ValidationError{
-			StatusCode: 422,
-			Message:    "The `from` field is required.",
-			Name:       "validation_error",
-		})
-		return
+		return nil, resendValidationError("The `from` field is required.")
 	}
 
 	to := normalizeToArray(req.To)
 	if len(to) == 0 {
-		writeJSON(w, http.StatusUnprocessableEntity, types.ValidationError{
-			StatusCode: 422,
-			Message:    "The `to` field is required.",
-			Name:       "validation_error",
-		})
-		return
+		return nil, resendValidationError("The `to` field is required.")
 	}
 
 	if req.Subject == "" {
-		writeJSON(w, http.StatusUnprocessableEntity, types.ValidationError{
-			StatusCode: 422,
-			Message:    "The `subject` field is required.",
-			Name:       "validation_error",
-		})
-		return
+		return nil, resendValidationError("The `subject` field is required.")
 	}
 
-	// Create email
 	email := types.Email{
-		ID:        uuid.NewString(),
-		Provider:  "resend",
-		From:      req.From,
-		To:        to,
-		CC:        normalizeToArray(req.CC),
-		BCC:       normalizeToArray(req.BCC),
-		Subject:   req.Subject,
-		HTML:      req.HTML,
-		Text:      req.Text,
-		ReplyTo:   req.ReplyTo,
-		Headers:   req.Headers,
-		Tags:      req.Tags,
-		CreatedAt: time.Now().UTC(),
+		From:    req.From,
+		To:      to,
+		CC:      normalizeToArray(req.CC),
+		BCC:     normalizeToArray(req.BCC),
+		Subject: req.Subject,
+		HTML:    req.HTML,
+		Text:    req.Text,
+		ReplyTo: normalizeToArray(req.ReplyTo),
+		Headers: req.Headers,
+		Tags:    req.Tags,
 	}
 
 	// Process attachments
@@ -83,9 +78,15 @@ func PostEmails(w http.ResponseWriter, r *http.Request) {
 		email.Attachments = append(email.Attachments, att)
 	}
 
-	store.AddEmail(email)
+	return []Message{{Email: email}}, nil
+}
+
+func respondResendEmail(w http.ResponseWriter, r *http.Request, messages []Message) {
+	writeJSON(w, http.StatusOK, map[string]string{"id": messages[0].Email.ID})
+}
 
-	writeJSON(w, http.StatusOK, map[string]string{"id": email.ID})
+func resendValidationError(message string) *RequestError {
+	return &RequestError{Status: http.StatusUnprocessableEntity, Message: message}
 }
 
 // normalizeToArray converts string or []interface{} to []string
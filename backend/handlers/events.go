@@ -6,12 +6,23 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/appaka/resendpit/store"
 	"github.com/appaka/resendpit/types"
 )
 
 // Events handles GET /api/events (SSE stream)
-func Events(w http.ResponseWriter, r *http.Request) {
+func (s *Server) Events(w http.ResponseWriter, r *http.Request) {
+	s.streamEvents(w, r, func() types.SSEMessage {
+		return types.SSEMessage{
+			Type:        "init",
+			Emails:      s.store.GetEmails(),
+			SMSMessages: s.store.GetSMSMessages(),
+		}
+	}, nil)
+}
+
+// streamEvents streams the message init returns, then the events filter
+// accepts (all with a nil filter)
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request, init func() types.SSEMessage, filter func(types.SSEMessage) bool) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -31,15 +42,11 @@ func Events(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("X-Accel-Buffering", "no")
 
 	// Subscribe to events
-	ch := store.Subscribe()
-	defer store.Unsubscribe(ch)
+	ch := s.events.Subscribe()
+	defer s.events.Unsubscribe(ch)
 
 	// Send initial state
-	initMsg := types.SSEMessage{
-		Type:   "init",
-		Emails: store.GetEmails(),
-	}
-	sendSSE(w, flusher, initMsg)
+	sendSSE(w, flusher, init())
 
 	// Keepalive ticker
 	ticker := time.NewTicker(30 * time.Second)
@@ -52,7 +59,9 @@ func Events(w http.ResponseWriter, r *http.Request) {
 		case <-ctx.Done():
 			return
 		case msg := <-ch:
-			sendSSE(w, flusher, msg)
+			if filter == nil || filter(msg) {
+				sendSSE(w, flusher, msg)
+			}
 		case <-ticker.C:
 			// Keepalive comment
 			fmt.Fprintf(w, ": keepalive\n\n")
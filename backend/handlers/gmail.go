@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/appaka/resendpit/config"
+	"github.com/appaka/resendpit/types"
+)
+
+// gmailMessage is the Gmail message resource, as sent and returned
+type gmailMessage struct {
+	ID       string   `json:"id,omitempty"`
+	ThreadID string   `json:"threadId,omitempty"`
+	LabelIDs []string `json:"labelIds,omitempty"`
+	Raw      string   `json:"raw,omitempty"`
+}
+
+// gmailError is the Google API error response
+type gmailError struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+// gmailProvider emulates the Gmail API messages.send method
+type gmailProvider struct{}
+
+func init() {
+	registerProvider(gmailProvider{})
+}
+
+func (gmailProvider) Name() string { return "gmail" }
+
+func (gmailProvider) Routes(s *Server) []Route {
+	return []Route{
+		{Pattern: "/gmail/v1/users/{userId}/messages/send", Method: http.MethodPost, Decode: decodeGmailSend, Respond: respondGmailSend},
+		{Pattern: "/upload/gmail/v1/users/{userId}/messages/send", Method: http.MethodPost, Decode: decodeGmailUploadSend, Respond: respondGmailSend},
+	}
+}
+
+// WriteError writes the Google API error; Code is the status reason
+func (gmailProvider) WriteError(w http.ResponseWriter, r *http.Request, err *RequestError) {
+	var resp gmailError
+	resp.Error.Code = err.Status
+	resp.Error.Message = err.Message
+	resp.Error.Status = err.Code
+	writeJSON(w, err.Status, resp)
+}
+
+// decodeGmailSend decodes a POST /gmail/v1/users/{userId}/messages/send
+// request, with the message as base64url in raw
+func decodeGmailSend(r *http.Request) ([]Message, *RequestError) {
+	if err := requireGmailToken(r); err != nil {
+		return nil, err
+	}
+	var req gmailMessage
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, gmailInvalidArgument("Invalid JSON payload received.")
+	}
+	if req.Raw == "" {
+		return nil, gmailInvalidArgument("'raw' RFC822 payload message string or uploading message via /upload/* URL required")
+	}
+	data, err := decodeGmailRaw(req.Raw)
+	if err != nil {
+		return nil, gmailInvalidArgument("Invalid value at 'message.raw' (TYPE_BYTES), Base64 decoding failed")
+	}
+	return gmailMessages(r, data, req.ThreadID)
+}
+
+// decodeGmailUploadSend decodes a POST
+// /upload/gmail/v1/users/{userId}/messages/send request, where the message
+// is the request body (uploadType=media) or the second part of a
+// multipart/related body (uploadType=multipart)
+func decodeGmailUploadSend(r *http.Request) ([]Message, *RequestError) {
+	if err := requireGmailToken(r); err != nil {
+		return nil, err
+	}
+	var data []byte
+	var threadID string
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(r.Body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				break
+			}
+			partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+			if partType == "application/json" {
+				var metadata gmailMessage
+				json.NewDecoder(part).Decode(&metadata)
+				threadID = metadata.ThreadID
+				continue
+			}
+			data, _ = io.ReadAll(io.LimitReader(part, config.MaxMessageSize))
+		}
+	} else {
+		data, _ = io.ReadAll(io.LimitReader(r.Body, config.MaxMessageSize))
+	}
+	if len(data) == 0 {
+		return nil, gmailInvalidArgument("Media type 'message/rfc822' is required")
+	}
+	return gmailMessages(r, data, threadID)
+}
+
+// gmailMessages builds the email of a send. Like Gmail, recipients
+// (including Bcc) come from the headers and a missing From is the sending
+// user.
+func gmailMessages(r *http.Request, data []byte, threadID string) ([]Message, *RequestError) {
+	parsed := parseMIME(data)
+	if len(parsed.To)+len(parsed.CC)+len(parsed.BCC) == 0 {
+		return nil, gmailInvalidArgument("Recipient address required")
+	}
+
+	id := newGmailID()
+	if threadID == "" {
+		threadID = id
+	}
+	from := parsed.From
+	if user := r.PathValue("userId"); from == "" && user != "me" {
+		from = user
+	}
+	to := parsed.To
+	if to == nil {
+		to = []string{}
+	}
+
+	email := types.Email{
+		From:        from,
+		To:          to,
+		CC:          parsed.CC,
+		BCC:         parsed.BCC,
+		Subject:     parsed.Subject,
+		HTML:        parsed.HTML,
+		Text:        parsed.Text,
+		ReplyTo:     parsed.ReplyTo,
+		Headers:     parsed.Headers,
+		Attachments: parsed.Attachments,
+		Metadata:    map[string]string{"messageId": id, "threadId": threadID},
+	}
+	return []Message{{Email: email, Result: gmailMessage{ID: id, ThreadID: threadID, LabelIDs: []string{"SENT"}}}}, nil
+}
+
+// respondGmailSend writes the sent message resource
+func respondGmailSend(w http.ResponseWriter, r *http.Request, messages []Message) {
+	writeJSON(w, http.StatusOK, messages[0].Result)
+}
+
+// requireGmailToken checks that an OAuth token is present. Any token is
+// accepted.
+func requireGmailToken(r *http.Request) *RequestError {
+	if r.Header.Get("Authorization") == "" {
+		return &RequestError{Status: http.StatusUnauthorized, Code: "UNAUTHENTICATED", Message: "Request is missing required authentication credential. Expected OAuth 2 access token, login cookie or other valid authentication credential."}
+	}
+	return nil
+}
+
+// decodeGmailRaw decodes base64url, padded or not. Standard base64 is
+// accepted too, as Gmail does.
+func decodeGmailRaw(raw string) ([]byte, error) {
+	raw = strings.TrimRight(strings.TrimSpace(raw), "=")
+	if data, err := base64.RawURLEncoding.DecodeString(raw); err == nil {
+		return data, nil
+	}
+	return base64.RawStdEncoding.DecodeString(raw)
+}
+
+// newGmailID returns a 16 character hex ID like Gmail message IDs
+func newGmailID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func gmailInvalidArgument(message string) *RequestError {
+	return &RequestError{Status: http.StatusBadRequest, Code: "INVALID_ARGUMENT", Message: message}
+}
@@ -9,7 +9,7 @@ import (
 )
 
 // Health handles GET /api/health
-func Health(w http.ResponseWriter, r *http.Request) {
+func (s *Server) Health(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -17,8 +17,12 @@ func Health(w http.ResponseWriter, r *http.Request) {
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"status":    "ok",
-		"emails":    store.GetEmailCount(),
-		"maxEmails": store.GetMaxEmails(),
+		"emails":    s.store.GetEmailCount(),
+		"maxEmails": s.store.GetMaxEmails(),
+		"retention": retentionJSON(s.store.GetRetention()),
+		"usage":     s.store.GetUsage(),
+		"sms":       s.store.GetSMSCount(),
+		"providers": ProviderNames(),
 		"timestamp": time.Now().UTC().Format(time.RFC3339),
 	})
 }
@@ -28,3 +32,18 @@ func writeJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(data)
 }
+
+// retentionJSON describes a retention policy; 0 (or "" for maxAge) means
+// unlimited
+func retentionJSON(r store.Retention) map[string]interface{} {
+	maxAge := ""
+	if r.MaxAge > 0 {
+		maxAge = r.MaxAge.String()
+	}
+	return map[string]interface{}{
+		"maxAge":   maxAge,
+		"maxCount": r.MaxCount,
+		"maxBytes": r.MaxBytes,
+		"eviction": r.Eviction,
+	}
+}
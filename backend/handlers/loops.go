@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/appaka/resendpit/types"
+)
+
+// loopsRequest is the body of a Loops POST /api/v1/transactional request.
+// Sender, subject and content live in the transactional email on Loops.
+type loopsRequest struct {
+	TransactionalID string                 `json:"transactionalId"`
+	Email           string                 `json:"email"`
+	AddToAudience   *bool                  `json:"addToAudience"`
+	DataVariables   map[string]interface{} `json:"dataVariables"`
+	Attachments     []loopsAttachment      `json:"attachments"`
+}
+
+type loopsAttachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+	Data        string `json:"data"`
+}
+
+// loopsResponse is the body of every Loops response
+type loopsResponse struct {
+	Success bool   `json:"success"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// loopsProvider emulates the Loops transactional API
+type loopsProvider struct{}
+
+func init() {
+	registerProvider(loopsProvider{})
+}
+
+func (loopsProvider) Name() string { return "loops" }
+
+func (loopsProvider) Routes(s *Server) []Route {
+	return []Route{
+		{Pattern: "/api/v1/transactional", Method: http.MethodPost, Decode: decodeLoopsTransactional, Respond: respondLoopsTransactional},
+	}
+}
+
+func (loopsProvider) WriteError(w http.ResponseWriter, r *http.Request, err *RequestError) {
+	writeJSON(w, err.Status, loopsResponse{Path: err.Field, Message: err.Message})
+}
+
+// decodeLoopsTransactional decodes a POST /api/v1/transactional request.
+// The transactional ID and data variables are recorded as the template.
+func decodeLoopsTransactional(r *http.Request) ([]Message, *RequestError) {
+	if r.Header.Get("Authorization") == "" {
+		return nil, &RequestError{Status: http.StatusUnauthorized, Message: "Invalid API key"}
+	}
+
+	var req loopsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, &RequestError{Status: http.StatusBadRequest, Message: "Invalid JSON body"}
+	}
+	if req.TransactionalID == "" {
+		return nil, &RequestError{Status: http.StatusBadRequest, Field: "transactionalId", Message: "transactionalId is required"}
+	}
+	if !strings.Contains(req.Email, "@") {
+		return nil, &RequestError{Status: http.StatusBadRequest, Field: "email", Message: "Invalid email address"}
+	}
+
+	email := types.Email{
+		To:           []string{req.Email},
+		TemplateID:   req.TransactionalID,
+		TemplateData: req.DataVariables,
+	}
+	if req.AddToAudience != nil {
+		email.Metadata = map[string]string{"addToAudience": strconv.FormatBool(*req.AddToAudience)}
+	}
+	for _, a := range req.Attachments {
+		att := types.Attachment{
+			Filename:    a.Filename,
+			Size:        base64DecodedSize(a.Data),
+			ContentType: a.ContentType,
+			Disposition: "attachment",
+		}
+		if att.ContentType == "" {
+			att.ContentType = contentTypeByFilename(a.Filename)
+		}
+		email.Attachments = append(email.Attachments, att)
+	}
+	return []Message{{Email: email}}, nil
+}
+
+func respondLoopsTransactional(w http.ResponseWriter, r *http.Request, messages []Message) {
+	writeJSON(w, http.StatusOK, loopsResponse{Success: true})
+}
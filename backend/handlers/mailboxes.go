@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/appaka/resendpit/store"
+	"github.com/appaka/resendpit/types"
+)
+
+// MailboxHeader names the mailbox a request's emails are routed into,
+// overriding API key and domain rules
+const MailboxHeader = "X-Resendpit-Mailbox"
+
+// apiKeyHeaders carry the API key of providers that do not use
+// Authorization: Bearer
+var apiKeyHeaders = []string{"X-Postmark-Server-Token", "api-key"}
+
+// routeMailbox returns the mailbox of an email: the one named by header if
+// valid, else the one configured for the API key or the recipients' domains.
+// It returns "" (the default mailbox) if none applies.
+func (s *Server) routeMailbox(header, apiKey string, email types.Email) string {
+	if header = strings.TrimSpace(header); store.ValidMailboxName(header) {
+		return header
+	}
+	recipients := make([]string, 0, len(email.To)+len(email.CC)+len(email.BCC))
+	recipients = append(append(append(recipients, email.To...), email.CC...), email.BCC...)
+	return s.store.MailboxFor(apiKey, recipients)
+}
+
+// requestAPIKey returns the API key of a request: a bearer token (Resend
+// re_xxx keys and most providers), the access key ID of an AWS Signature
+// Version 4, or a provider API key header
+func requestAPIKey(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if token, ok := strings.CutPrefix(auth, "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	if _, credential, ok := strings.Cut(auth, "Credential="); ok && strings.HasPrefix(auth, "AWS4-") {
+		accessKey, _, _ := strings.Cut(credential, "/")
+		return accessKey
+	}
+	for _, header := range apiKeyHeaders {
+		if key := r.Header.Get(header); key != "" {
+			return key
+		}
+	}
+	return ""
+}
+
+// APIMailboxes handles GET /api/mailboxes
+func (s *Server) APIMailboxes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	mailboxes := []map[string]interface{}{}
+	for _, box := range s.store.GetMailboxes() {
+		mailboxes = append(mailboxes, map[string]interface{}{
+			"name":      box.Name,
+			"emails":    box.Emails,
+			"bytes":     box.Bytes,
+			"retention": retentionJSON(box.Retention),
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"mailboxes": mailboxes})
+}
+
+// APIMailboxEmails handles GET/DELETE /api/mailboxes/{name}/emails
+func (s *Server) APIMailboxEmails(w http.ResponseWriter, r *http.Request) {
+	name, ok := mailboxPathValue(w, r)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"emails": s.store.GetMailboxEmails(name),
+		})
+	case http.MethodDelete:
+		s.store.ClearEmails(name)
+		writeJSON(w, http.StatusOK, map[string]bool{"success": true})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// MailboxEvents handles GET /api/mailboxes/{name}/events, the SSE stream of
+// one mailbox's emails
+func (s *Server) MailboxEvents(w http.ResponseWriter, r *http.Request) {
+	name, ok := mailboxPathValue(w, r)
+	if !ok {
+		return
+	}
+	s.streamEvents(w, r, func() types.SSEMessage {
+		return types.SSEMessage{Type: "init", Emails: s.store.GetMailboxEmails(name)}
+	}, func(msg types.SSEMessage) bool {
+		switch msg.Type {
+		case "new-email":
+			return msg.Email.Mailbox == name
+		case "evict-email":
+			return msg.Mailbox == name
+		case "clear":
+			return msg.Mailbox == name || msg.Mailbox == store.AllMailboxes
+		}
+		return false
+	})
+}
+
+// mailboxPathValue returns the {name} of a mailbox path, writing a 400
+// error if it is not a valid mailbox name
+func mailboxPathValue(w http.ResponseWriter, r *http.Request) (string, bool) {
+	name := r.PathValue("name")
+	if !store.ValidMailboxName(name) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid mailbox name"})
+		return "", false
+	}
+	return name, true
+}
@@ -0,0 +1,422 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/appaka/resendpit/types"
+)
+
+// mailerSendMaxBulkSize is the number of messages a bulk request may hold
+const mailerSendMaxBulkSize = 500
+
+// mailerSendMessage is the body of a MailerSend POST /v1/email request and
+// an entry of a /v1/bulk-email request
+type mailerSendMessage struct {
+	From            *mailerSendAddress      `json:"from"`
+	To              []mailerSendAddress     `json:"to"`
+	CC              []mailerSendAddress     `json:"cc"`
+	BCC             []mailerSendAddress     `json:"bcc"`
+	ReplyTo         *mailerSendAddress      `json:"reply_to"`
+	Subject         string                  `json:"subject"`
+	Text            string                  `json:"text"`
+	HTML            string                  `json:"html"`
+	TemplateID      string                  `json:"template_id"`
+	Tags            []string                `json:"tags"`
+	Personalization []mailerSendPersonalize `json:"personalization"`
+	Variables       []mailerSendVariables   `json:"variables"`
+	Attachments     []mailerSendAttachment  `json:"attachments"`
+	Headers         []mailerSendHeader      `json:"headers"`
+	InReplyTo       string                  `json:"in_reply_to"`
+	SendAt          int64                   `json:"send_at"`
+	PrecedenceBulk  *bool                   `json:"precedence_bulk"`
+}
+
+type mailerSendAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+// mailerSendPersonalize holds {{ var }} data for one recipient
+type mailerSendPersonalize struct {
+	Email string                 `json:"email"`
+	Data  map[string]interface{} `json:"data"`
+}
+
+// mailerSendVariables holds the legacy {$var} substitutions for one
+// recipient
+type mailerSendVariables struct {
+	Email         string `json:"email"`
+	Substitutions []struct {
+		Var   string `json:"var"`
+		Value string `json:"value"`
+	} `json:"substitutions"`
+}
+
+type mailerSendAttachment struct {
+	Content     string `json:"content"`
+	Filename    string `json:"filename"`
+	Disposition string `json:"disposition"`
+	ID          string `json:"id"`
+}
+
+type mailerSendHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// mailerSendError is MailerSend's validation error response: a summary
+// message plus the messages of each invalid field
+type mailerSendError struct {
+	Message string              `json:"message"`
+	Errors  map[string][]string `json:"errors,omitempty"`
+}
+
+// mailerSendVariablePattern matches legacy {$var} placeholders
+var mailerSendVariablePattern = regexp.MustCompile(`\{\$(\w+)\}`)
+
+// mailerSendProvider emulates the MailerSend email and bulk email APIs
+type mailerSendProvider struct{}
+
+func init() {
+	registerProvider(mailerSendProvider{})
+}
+
+func (mailerSendProvider) Name() string { return "mailersend" }
+
+func (mailerSendProvider) Routes(s *Server) []Route {
+	return []Route{
+		{Pattern: "/v1/email", Method: http.MethodPost, Decode: decodeMailerSendEmail, Respond: respondMailerSendEmail},
+		{Pattern: "/v1/bulk-email", Method: http.MethodPost, Decode: decodeMailerSendBulkEmail, Respond: s.respondMailerSendBulkEmail},
+		{Pattern: "/v1/bulk-email/{id}", Handler: s.GetMailerSendBulkEmail},
+	}
+}
+
+// WriteError writes the summary message, plus the messages of Field when
+// it is set
+func (mailerSendProvider) WriteError(w http.ResponseWriter, r *http.Request, err *RequestError) {
+	resp := mailerSendError{Message: err.Message}
+	if err.Field != "" {
+		resp.Errors = map[string][]string{err.Field: {err.Message}}
+	}
+	writeJSON(w, err.Status, resp)
+}
+
+// mailerSendBulkEntryError is the Result of a bulk message that failed
+// validation
+type mailerSendBulkEntryError struct {
+	Field   string
+	Message string
+}
+
+// decodeMailerSendEmail decodes a POST /v1/email request
+func decodeMailerSendEmail(r *http.Request) ([]Message, *RequestError) {
+	if err := requireMailerSendToken(r); err != nil {
+		return nil, err
+	}
+	var msg mailerSendMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		return nil, &RequestError{Status: http.StatusBadRequest, Message: "The request body is not valid JSON."}
+	}
+	if field, message := validateMailerSendMessage(&msg); field != "" {
+		return nil, &RequestError{Status: http.StatusUnprocessableEntity, Field: field, Message: message}
+	}
+	messageID := newMailerSendID()
+	var messages []Message
+	for _, email := range mailerSendEmails(&msg, messageID) {
+		messages = append(messages, Message{Email: email, Result: messageID})
+	}
+	return messages, nil
+}
+
+// respondMailerSendEmail answers 202 with the message ID in the
+// X-Message-Id header and no body
+func respondMailerSendEmail(w http.ResponseWriter, r *http.Request, messages []Message) {
+	w.Header().Set("X-Message-Id", messages[0].Result.(string))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// decodeMailerSendBulkEmail decodes a POST /v1/bulk-email request.
+// Messages are validated one by one; invalid ones are skipped and reported
+// by the bulk status, like MailerSend does.
+func decodeMailerSendBulkEmail(r *http.Request) ([]Message, *RequestError) {
+	if err := requireMailerSendToken(r); err != nil {
+		return nil, err
+	}
+	var bulk []mailerSendMessage
+	if err := json.NewDecoder(r.Body).Decode(&bulk); err != nil {
+		return nil, &RequestError{Status: http.StatusBadRequest, Message: "The request body must be an array of email objects."}
+	}
+	if len(bulk) > mailerSendMaxBulkSize {
+		return nil, &RequestError{Status: http.StatusUnprocessableEntity, Message: "The bulk request may not have more than " + strconv.Itoa(mailerSendMaxBulkSize) + " emails."}
+	}
+
+	messages := make([]Message, 0, len(bulk))
+	for i, msg := range bulk {
+		if field, message := validateMailerSendMessage(&msg); field != "" {
+			messages = append(messages, Message{Skip: true, Result: mailerSendBulkEntryError{
+				Field:   "message." + strconv.Itoa(i) + "." + field,
+				Message: message,
+			}})
+			continue
+		}
+		messageID := newMailerSendID()
+		for _, email := range mailerSendEmails(&msg, messageID) {
+			messages = append(messages, Message{Email: email, Result: messageID})
+		}
+	}
+	return messages, nil
+}
+
+// respondMailerSendBulkEmail records the bulk status and answers 202 with
+// its ID
+func (s *Server) respondMailerSendBulkEmail(w http.ResponseWriter, r *http.Request, messages []Message) {
+	now := time.Now().UTC()
+	bulk := types.BulkEmail{
+		ID:               newMailerSendID(),
+		State:            "completed",
+		ValidationErrors: map[string][]string{},
+		MessageIDs:       []string{},
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	for _, m := range messages {
+		if m.Skip {
+			invalid := m.Result.(mailerSendBulkEntryError)
+			bulk.ValidationErrors[invalid.Field] = []string{invalid.Message}
+			continue
+		}
+		// A personalized message is captured once per recipient
+		if id := m.Result.(string); len(bulk.MessageIDs) == 0 || bulk.MessageIDs[len(bulk.MessageIDs)-1] != id {
+			bulk.MessageIDs = append(bulk.MessageIDs, id)
+		}
+		bulk.TotalRecipients += len(m.Email.To) + len(m.Email.CC) + len(m.Email.BCC)
+	}
+	s.store.AddBulkEmail(bulk)
+
+	writeJSON(w, http.StatusAccepted, map[string]string{
+		"message":       "The bulk email is being processed.",
+		"bulk_email_id": bulk.ID,
+	})
+}
+
+// GetMailerSendBulkEmail handles GET /v1/bulk-email/{id}
+func (s *Server) GetMailerSendBulkEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := requireMailerSendToken(r); err != nil {
+		mailerSendProvider{}.WriteError(w, r, err)
+		return
+	}
+	bulk, ok := s.store.GetBulkEmail(r.PathValue("id"))
+	if !ok {
+		mailerSendProvider{}.WriteError(w, r, &RequestError{Status: http.StatusNotFound, Message: "Resource not found."})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"id":                          bulk.ID,
+			"state":                       bulk.State,
+			"total_recipients_count":      bulk.TotalRecipients,
+			"suppressed_recipients_count": 0,
+			"suppressed_recipients":       nil,
+			"validation_errors_count":     len(bulk.ValidationErrors),
+			"validation_errors":           bulk.ValidationErrors,
+			"messages_id":                 bulk.MessageIDs,
+			"created_at":                  bulk.CreatedAt.Format(time.RFC3339Nano),
+			"updated_at":                  bulk.UpdatedAt.Format(time.RFC3339Nano),
+		},
+	})
+}
+
+// validateMailerSendMessage returns the invalid field and its message.
+// With a template, the sender, subject and content may come from it.
+func validateMailerSendMessage(msg *mailerSendMessage) (string, string) {
+	if msg.TemplateID == "" && (msg.From == nil || msg.From.Email == "") {
+		return "from.email", "The from.email field is required."
+	}
+	if len(msg.To) == 0 {
+		return "to", "The to field is required."
+	}
+	for i, to := range msg.To {
+		if !strings.Contains(to.Email, "@") {
+			field := "to." + strconv.Itoa(i) + ".email"
+			return field, "The " + field + " must be a valid email address."
+		}
+	}
+	if msg.TemplateID == "" {
+		if msg.Subject == "" {
+			return "subject", "The subject field is required when no template_id is present."
+		}
+		if msg.Text == "" && msg.HTML == "" {
+			return "text", "The text field is required when neither html nor template_id is present."
+		}
+	}
+	return "", ""
+}
+
+// mailerSendEmail builds the captured email. Personalization data of the
+// To recipients replaces {{ var }} placeholders and legacy variables
+// replace {$var}; with a template they are recorded as template data.
+// mailerSendEmails returns the captures of a message. A message with
+// personalization or variables is captured once per To recipient, with only
+// that recipient's data, and its CC and BCC recipients on the first capture.
+func mailerSendEmails(msg *mailerSendMessage, messageID string) []types.Email {
+	if len(msg.To) <= 1 || len(msg.Personalization) == 0 && len(msg.Variables) == 0 {
+		return []types.Email{mailerSendEmail(msg, messageID, msg.To)}
+	}
+	emails := make([]types.Email, 0, len(msg.To))
+	for i, to := range msg.To {
+		email := mailerSendEmail(msg, messageID, []mailerSendAddress{to})
+		if i > 0 {
+			email.CC, email.BCC = nil, nil
+		}
+		emails = append(emails, email)
+	}
+	return emails
+}
+
+// mailerSendEmail captures a message sent to the given To recipients, with
+// their personalization and variables
+func mailerSendEmail(msg *mailerSendMessage, messageID string, recipients []mailerSendAddress) types.Email {
+	email := types.Email{
+		To:       mailerSendAddresses(recipients),
+		CC:       mailerSendAddresses(msg.CC),
+		BCC:      mailerSendAddresses(msg.BCC),
+		Subject:  msg.Subject,
+		HTML:     msg.HTML,
+		Text:     msg.Text,
+		Metadata: map[string]string{"messageId": messageID},
+	}
+	if msg.From != nil && msg.From.Email != "" {
+		email.From = formatAddress(msg.From.Name, msg.From.Email)
+	}
+	if msg.ReplyTo != nil && msg.ReplyTo.Email != "" {
+		email.ReplyTo = []string{formatAddress(msg.ReplyTo.Name, msg.ReplyTo.Email)}
+	}
+	if msg.SendAt != 0 {
+		t := time.Unix(msg.SendAt, 0).UTC()
+		email.ScheduledAt = &t
+	}
+
+	data := map[string]interface{}{}
+	substitutions := map[string]string{}
+	for _, to := range recipients {
+		for _, p := range msg.Personalization {
+			if strings.EqualFold(p.Email, to.Email) {
+				for k, v := range p.Data {
+					data[k] = v
+				}
+			}
+		}
+		for _, v := range msg.Variables {
+			if strings.EqualFold(v.Email, to.Email) {
+				for _, s := range v.Substitutions {
+					substitutions[s.Var] = s.Value
+				}
+			}
+		}
+	}
+	if msg.TemplateID != "" {
+		email.TemplateID = msg.TemplateID
+		templateData := make(map[string]interface{}, len(data)+len(substitutions))
+		for k, v := range data {
+			templateData[k] = v
+		}
+		for k, v := range substitutions {
+			templateData[k] = v
+		}
+		if len(templateData) > 0 {
+			email.TemplateData = templateData
+		}
+	}
+	email.Subject = renderMailerSendContent(email.Subject, data, substitutions, false)
+	email.HTML = renderMailerSendContent(email.HTML, data, substitutions, true)
+	email.Text = renderMailerSendContent(email.Text, data, substitutions, false)
+
+	for _, tag := range msg.Tags {
+		email.Tags = append(email.Tags, types.Tag{Name: "tag", Value: tag})
+	}
+	for _, h := range msg.Headers {
+		if email.Headers == nil {
+			email.Headers = map[string]string{}
+		}
+		email.Headers[h.Name] = h.Value
+	}
+	if msg.InReplyTo != "" {
+		if email.Headers == nil {
+			email.Headers = map[string]string{}
+		}
+		email.Headers["In-Reply-To"] = msg.InReplyTo
+	}
+	if msg.PrecedenceBulk != nil {
+		email.Metadata["precedenceBulk"] = strconv.FormatBool(*msg.PrecedenceBulk)
+	}
+	for _, a := range msg.Attachments {
+		att := types.Attachment{
+			Filename:    a.Filename,
+			Size:        base64DecodedSize(a.Content),
+			ContentType: contentTypeByFilename(a.Filename),
+			Disposition: "attachment",
+		}
+		if a.Disposition == "inline" {
+			att.Disposition = "inline"
+			att.ContentID = a.ID
+		}
+		email.Attachments = append(email.Attachments, att)
+	}
+	return email
+}
+
+func renderMailerSendContent(s string, data map[string]interface{}, substitutions map[string]string, escapeHTML bool) string {
+	if s == "" {
+		return s
+	}
+	if len(data) > 0 {
+		s = renderMustachio(s, data, escapeHTML)
+	}
+	if len(substitutions) > 0 {
+		s = mailerSendVariablePattern.ReplaceAllStringFunc(s, func(match string) string {
+			if value, ok := substitutions[mailerSendVariablePattern.FindStringSubmatch(match)[1]]; ok {
+				return value
+			}
+			return match
+		})
+	}
+	return s
+}
+
+func mailerSendAddresses(list []mailerSendAddress) []string {
+	if len(list) == 0 {
+		return nil
+	}
+	result := make([]string, 0, len(list))
+	for _, addr := range list {
+		result = append(result, formatAddress(addr.Name, addr.Email))
+	}
+	return result
+}
+
+// requireMailerSendToken rejects requests without a bearer token. Any
+// token is accepted.
+func requireMailerSendToken(r *http.Request) *RequestError {
+	if r.Header.Get("Authorization") == "" {
+		return &RequestError{Status: http.StatusUnauthorized, Message: "Unauthenticated."}
+	}
+	return nil
+}
+
+// newMailerSendID returns a 24 character hex ID like MailerSend's
+func newMailerSendID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/appaka/resendpit/types"
+)
+
+// mailgunMaxMemory is how much of a multipart request is kept in memory
+// before attachments spill to temporary files
+const mailgunMaxMemory = 32 << 20
+
+// mailgunProvider emulates the Mailgun Messages API
+type mailgunProvider struct{}
+
+func init() {
+	registerProvider(mailgunProvider{})
+}
+
+func (mailgunProvider) Name() string { return "mailgun" }
+
+func (mailgunProvider) Routes(s *Server) []Route {
+	return []Route{
+		{Pattern: "/v3/{domain}/messages", Method: http.MethodPost, Decode: decodeMailgunMessage, Respond: respondMailgunMessage},
+		{Pattern: "/v3/{domain}/messages.mime", Method: http.MethodPost, Decode: decodeMailgunMIMEMessage, Respond: respondMailgunMessage},
+	}
+}
+
+func (mailgunProvider) WriteError(w http.ResponseWriter, r *http.Request, err *RequestError) {
+	writeMailgunError(w, err.Status, err.Message)
+}
+
+// decodeMailgunMessage decodes a POST /v3/{domain}/messages request. A
+// batch send with recipient-variables is captured once per To recipient.
+func decodeMailgunMessage(r *http.Request) ([]Message, *RequestError) {
+	return decodeMailgunSend(r, false)
+}
+
+// decodeMailgunMIMEMessage decodes a POST /v3/{domain}/messages.mime
+// request, where the message is a complete MIME document in the "message"
+// field
+func decodeMailgunMIMEMessage(r *http.Request) ([]Message, *RequestError) {
+	return decodeMailgunSend(r, true)
+}
+
+func decodeMailgunSend(r *http.Request, isMIME bool) ([]Message, *RequestError) {
+	if err := r.ParseMultipartForm(mailgunMaxMemory); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return nil, mailgunBadRequest("Invalid request body")
+	}
+	if r.MultipartForm != nil {
+		defer r.MultipartForm.RemoveAll()
+	}
+
+	domain := r.PathValue("domain")
+	to := splitAddressList(r.Form["to"])
+	if len(to) == 0 {
+		return nil, mailgunBadRequest("to parameter is missing")
+	}
+
+	var email types.Email
+	if isMIME {
+		data, ok := mailgunMIMEField(r)
+		if !ok {
+			return nil, mailgunBadRequest("message parameter is missing")
+		}
+		parsed := parseMIME(data)
+		email = types.Email{
+			From:        parsed.From,
+			Subject:     parsed.Subject,
+			HTML:        parsed.HTML,
+			Text:        parsed.Text,
+			ReplyTo:     parsed.ReplyTo,
+			Headers:     parsed.Headers,
+			Attachments: parsed.Attachments,
+		}
+		email.To, email.CC, email.BCC = parsed.envelopeRecipients(to)
+	} else {
+		email = types.Email{
+			From:       r.FormValue("from"),
+			To:         to,
+			CC:         splitAddressList(r.Form["cc"]),
+			BCC:        splitAddressList(r.Form["bcc"]),
+			Subject:    r.FormValue("subject"),
+			HTML:       r.FormValue("html"),
+			Text:       r.FormValue("text"),
+			TemplateID: r.FormValue("template"),
+		}
+		if email.From == "" {
+			return nil, mailgunBadRequest("from parameter is missing")
+		}
+		if email.HTML == "" && email.Text == "" && email.TemplateID == "" {
+			return nil, mailgunBadRequest("Need at least one of 'text', 'html' or 'template' parameters specified")
+		}
+		if vars := r.FormValue("t:variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &email.TemplateData); err != nil {
+				return nil, mailgunBadRequest("t:variables parameter is not a valid JSON")
+			}
+		}
+		if r.MultipartForm != nil {
+			email.Attachments = append(email.Attachments, mailgunAttachments(r.MultipartForm.File["attachment"], "attachment")...)
+			email.Attachments = append(email.Attachments, mailgunAttachments(r.MultipartForm.File["inline"], "inline")...)
+		}
+	}
+
+	var recipientVariables map[string]map[string]interface{}
+	if vars := r.FormValue("recipient-variables"); vars != "" {
+		if err := json.Unmarshal([]byte(vars), &recipientVariables); err != nil {
+			return nil, mailgunBadRequest("recipient-variables parameter is not a valid JSON")
+		}
+	}
+
+	messageID := newMailgunMessageID(domain)
+	email.Metadata = map[string]string{"messageId": messageID, "domain": domain}
+
+	for key, values := range r.Form {
+		if len(values) == 0 {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(key, "h:"):
+			if email.Headers == nil {
+				email.Headers = map[string]string{}
+			}
+			email.Headers[strings.TrimPrefix(key, "h:")] = values[0]
+		case strings.HasPrefix(key, "v:"):
+			email.Metadata[strings.TrimPrefix(key, "v:")] = values[0]
+		case key == "o:tag":
+			for _, tag := range values {
+				email.Tags = append(email.Tags, types.Tag{Name: "tag", Value: tag})
+			}
+		case key == "o:deliverytime":
+			if t, err := mail.ParseDate(values[0]); err == nil {
+				t = t.UTC()
+				email.ScheduledAt = &t
+			}
+		}
+	}
+
+	if len(recipientVariables) == 0 {
+		return []Message{{Email: email, Result: messageID}}, nil
+	}
+
+	// Batch send: every To recipient gets its own message, with
+	// %recipient.name% placeholders replaced by its variables. CC and BCC
+	// recipients are recorded on the first message only, so each is
+	// captured once.
+	messages := make([]Message, 0, len(email.To))
+	for i, recipient := range email.To {
+		batch := cloneEmail(email)
+		batch.To = []string{recipient}
+		if i > 0 {
+			batch.CC, batch.BCC = nil, nil
+		}
+		vars := recipientVariables[extractAddress(recipient)]
+		batch.Subject = replaceMailgunRecipientVariables(email.Subject, vars)
+		batch.HTML = replaceMailgunRecipientVariables(email.HTML, vars)
+		batch.Text = replaceMailgunRecipientVariables(email.Text, vars)
+		messages = append(messages, Message{Email: batch, Result: messageID})
+	}
+	return messages, nil
+}
+
+func respondMailgunMessage(w http.ResponseWriter, r *http.Request, messages []Message) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"id":      messages[0].Result.(string),
+		"message": "Queued. Thank you.",
+	})
+}
+
+func mailgunBadRequest(message string) *RequestError {
+	return &RequestError{Status: http.StatusBadRequest, Message: message}
+}
+
+// mailgunMIMEField returns the MIME document of a messages.mime request,
+// sent as a file or as a plain field
+func mailgunMIMEField(r *http.Request) ([]byte, bool) {
+	if r.MultipartForm != nil {
+		if files := r.MultipartForm.File["message"]; len(files) > 0 {
+			f, err := files[0].Open()
+			if err != nil {
+				return nil, false
+			}
+			defer f.Close()
+			data, err := io.ReadAll(f)
+			return data, err == nil
+		}
+	}
+	if message := r.FormValue("message"); message != "" {
+		return []byte(message), true
+	}
+	return nil, false
+}
+
+func mailgunAttachments(files []*multipart.FileHeader, disposition string) []types.Attachment {
+	var result []types.Attachment
+	for _, f := range files {
+		size := int(f.Size)
+		att := types.Attachment{
+			Filename:    f.Filename,
+			Size:        &size,
+			ContentType: f.Header.Get("Content-Type"),
+			Disposition: disposition,
+		}
+		if att.ContentType == "" || att.ContentType == "application/octet-stream" {
+			if guessed := contentTypeByFilename(f.Filename); guessed != "" {
+				att.ContentType = guessed
+			}
+		}
+		if disposition == "inline" {
+			// Inline images are referenced as cid:filename
+			att.ContentID = f.Filename
+		}
+		result = append(result, att)
+	}
+	return result
+}
+
+// replaceMailgunRecipientVariables replaces %recipient.name% placeholders
+func replaceMailgunRecipientVariables(s string, vars map[string]interface{}) string {
+	for name, value := range vars {
+		s = strings.ReplaceAll(s, "%recipient."+name+"%", fmt.Sprint(value))
+	}
+	return s
+}
+
+// newMailgunMessageID returns an ID in the format Mailgun uses,
+// e.g. <20260102150405.1a2b3c4d5e6f7a8b@example.com>
+func newMailgunMessageID(domain string) string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return fmt.Sprintf("<%s.%s@%s>", time.Now().UTC().Format("20060102150405"), hex.EncodeToString(b), domain)
+}
+
+func writeMailgunError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
@@ -0,0 +1,464 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/appaka/resendpit/types"
+)
+
+// mandrillSendAtLayout is the format of send_at (always UTC)
+const mandrillSendAtLayout = "2006-01-02 15:04:05"
+
+// mandrillMessage is the message of send and send-template requests
+type mandrillMessage struct {
+	HTML               string                 `json:"html"`
+	Text               string                 `json:"text"`
+	Subject            string                 `json:"subject"`
+	FromEmail          string                 `json:"from_email"`
+	FromName           string                 `json:"from_name"`
+	To                 []mandrillRecipient    `json:"to"`
+	Headers            map[string]string      `json:"headers"`
+	TrackOpens         *bool                  `json:"track_opens"`
+	TrackClicks        *bool                  `json:"track_clicks"`
+	PreserveRecipients bool                   `json:"preserve_recipients"`
+	Merge              *bool                  `json:"merge"`
+	MergeLanguage      string                 `json:"merge_language"`
+	GlobalMergeVars    []mandrillVar          `json:"global_merge_vars"`
+	MergeVars          []mandrillRcptVars     `json:"merge_vars"`
+	Tags               []string               `json:"tags"`
+	Subaccount         string                 `json:"subaccount"`
+	Metadata           map[string]interface{} `json:"metadata"`
+	RecipientMetadata  []mandrillRcptMetadata `json:"recipient_metadata"`
+	Attachments        []mandrillFile         `json:"attachments"`
+	Images             []mandrillFile         `json:"images"`
+}
+
+// mandrillRecipient is a recipient; Type is "to" (default), "cc" or "bcc"
+type mandrillRecipient struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+}
+
+type mandrillVar struct {
+	Name    string      `json:"name"`
+	Content interface{} `json:"content"`
+}
+
+type mandrillRcptVars struct {
+	Rcpt string        `json:"rcpt"`
+	Vars []mandrillVar `json:"vars"`
+}
+
+type mandrillRcptMetadata struct {
+	Rcpt   string                 `json:"rcpt"`
+	Values map[string]interface{} `json:"values"`
+}
+
+type mandrillFile struct {
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+// mandrillSendResult is the status of one recipient: sent, queued,
+// scheduled, rejected or invalid
+type mandrillSendResult struct {
+	Email        string  `json:"email"`
+	Status       string  `json:"status"`
+	ID           string  `json:"_id"`
+	RejectReason *string `json:"reject_reason"`
+}
+
+// mandrillError is Mandrill's error response, sent with status 500
+type mandrillError struct {
+	Status  string `json:"status"`
+	Code    int    `json:"code"`
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+// mandrillMergeTag matches *|NAME|* merge tags
+var mandrillMergeTag = regexp.MustCompile(`\*\|([A-Za-z0-9_:\-]+)\|\*`)
+
+// mandrillProvider emulates the Mandrill messages and rejects APIs. Every
+// route is served with and without the .json suffix.
+type mandrillProvider struct{}
+
+func init() {
+	registerProvider(mandrillProvider{})
+}
+
+func (mandrillProvider) Name() string { return "mandrill" }
+
+func (mandrillProvider) Routes(s *Server) []Route {
+	var routes []Route
+	for _, route := range []Route{
+		{Pattern: "/api/1.0/messages/send", Method: http.MethodPost, Decode: s.decodeMandrillSend, Respond: respondMandrillSend},
+		{Pattern: "/api/1.0/messages/send-template", Method: http.MethodPost, Decode: s.decodeMandrillSendTemplate, Respond: respondMandrillSend},
+		{Pattern: "/api/1.0/messages/send-raw", Method: http.MethodPost, Decode: s.decodeMandrillSendRaw, Respond: respondMandrillSend},
+		{Pattern: "/api/1.0/rejects/add", Handler: s.PostMandrillRejectsAdd},
+		{Pattern: "/api/1.0/rejects/list", Handler: s.PostMandrillRejectsList},
+		{Pattern: "/api/1.0/rejects/delete", Handler: s.PostMandrillRejectsDelete},
+	} {
+		suffixed := route
+		suffixed.Pattern += ".json"
+		routes = append(routes, route, suffixed)
+	}
+	return routes
+}
+
+// WriteError writes Mandrill's error response, always with status 500.
+// Code is the error name; Invalid_Key has code -1, anything else -2.
+func (mandrillProvider) WriteError(w http.ResponseWriter, r *http.Request, err *RequestError) {
+	if err.Status == http.StatusMethodNotAllowed {
+		http.Error(w, err.Message, err.Status)
+		return
+	}
+	code := -2
+	if err.Code == "Invalid_Key" {
+		code = -1
+	}
+	writeJSON(w, http.StatusInternalServerError, mandrillError{
+		Status:  "error",
+		Code:    code,
+		Name:    err.Code,
+		Message: err.Message,
+	})
+}
+
+// decodeMandrillSend decodes a POST /api/1.0/messages/send.json request
+func (s *Server) decodeMandrillSend(r *http.Request) ([]Message, *RequestError) {
+	var req struct {
+		Key     string           `json:"key"`
+		Message *mandrillMessage `json:"message"`
+		Async   bool             `json:"async"`
+		SendAt  string           `json:"send_at"`
+	}
+	if err := decodeMandrillRequest(r, &req, func() string { return req.Key }); err != nil {
+		return nil, err
+	}
+	if req.Message == nil {
+		return nil, mandrillValidationError(`Validation error: {"message":"Sorry, this field can't be left blank."}`)
+	}
+	return s.mandrillMessages(req.Message, "", nil, req.Async, req.SendAt)
+}
+
+// decodeMandrillSendTemplate decodes a POST
+// /api/1.0/messages/send-template.json request. Templates live in Mandrill,
+// so the template name, its editable regions and the merge vars are
+// recorded on the email rather than rendered.
+func (s *Server) decodeMandrillSendTemplate(r *http.Request) ([]Message, *RequestError) {
+	var req struct {
+		Key             string           `json:"key"`
+		TemplateName    string           `json:"template_name"`
+		TemplateContent []mandrillVar    `json:"template_content"`
+		Message         *mandrillMessage `json:"message"`
+		Async           bool             `json:"async"`
+		SendAt          string           `json:"send_at"`
+	}
+	if err := decodeMandrillRequest(r, &req, func() string { return req.Key }); err != nil {
+		return nil, err
+	}
+	if req.TemplateName == "" {
+		return nil, mandrillValidationError(`Validation error: {"template_name":"Sorry, this field can't be left blank."}`)
+	}
+	if req.Message == nil {
+		return nil, mandrillValidationError(`Validation error: {"message":"Sorry, this field can't be left blank."}`)
+	}
+	content := map[string]interface{}{}
+	for _, region := range req.TemplateContent {
+		content[region.Name] = region.Content
+	}
+	return s.mandrillMessages(req.Message, req.TemplateName, content, req.Async, req.SendAt)
+}
+
+// decodeMandrillSendRaw decodes a POST /api/1.0/messages/send-raw.json
+// request. The optional to list is the envelope; otherwise the message
+// headers are used.
+func (s *Server) decodeMandrillSendRaw(r *http.Request) ([]Message, *RequestError) {
+	var req struct {
+		Key        string   `json:"key"`
+		RawMessage string   `json:"raw_message"`
+		FromEmail  string   `json:"from_email"`
+		FromName   string   `json:"from_name"`
+		To         []string `json:"to"`
+		Async      bool     `json:"async"`
+		SendAt     string   `json:"send_at"`
+	}
+	if err := decodeMandrillRequest(r, &req, func() string { return req.Key }); err != nil {
+		return nil, err
+	}
+	if req.RawMessage == "" {
+		return nil, mandrillValidationError(`Validation error: {"raw_message":"Sorry, this field can't be left blank."}`)
+	}
+	status, scheduledAt, err := mandrillSendStatus(req.Async, req.SendAt)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed := parseMIME([]byte(req.RawMessage))
+	envelope := req.To
+	if len(envelope) == 0 {
+		envelope = append(append(append([]string{}, parsed.To...), parsed.CC...), parsed.BCC...)
+	}
+	from := parsed.From
+	if req.FromEmail != "" {
+		from = formatAddress(req.FromName, req.FromEmail)
+	}
+
+	messages := make([]Message, 0, len(envelope))
+	for _, rcpt := range envelope {
+		messages = append(messages, s.mandrillRecipientMessage(extractAddress(rcpt), status, func(id string) types.Email {
+			email := types.Email{
+				From:        from,
+				Subject:     parsed.Subject,
+				HTML:        parsed.HTML,
+				Text:        parsed.Text,
+				ReplyTo:     parsed.ReplyTo,
+				Headers:     parsed.Headers,
+				Attachments: parsed.Attachments,
+				ScheduledAt: scheduledAt,
+				Metadata:    map[string]string{"messageId": id},
+			}
+			email.To, email.CC, email.BCC = parsed.envelopeRecipients([]string{rcpt})
+			return email
+		}))
+	}
+	return messages, nil
+}
+
+// mandrillMessages builds one email per recipient, with the merge vars of
+// that recipient applied
+func (s *Server) mandrillMessages(msg *mandrillMessage, templateName string, templateContent map[string]interface{}, async bool, sendAt string) ([]Message, *RequestError) {
+	if len(msg.To) == 0 {
+		return nil, mandrillValidationError(`Validation error: {"message":{"to":"Sorry, this field can't be left blank."}}`)
+	}
+	status, scheduledAt, err := mandrillSendStatus(async, sendAt)
+	if err != nil {
+		return nil, err
+	}
+
+	var to, cc []string
+	for _, rcpt := range msg.To {
+		switch rcpt.Type {
+		case "cc":
+			cc = append(cc, formatAddress(rcpt.Name, rcpt.Email))
+		case "bcc":
+		default:
+			to = append(to, formatAddress(rcpt.Name, rcpt.Email))
+		}
+	}
+
+	messages := make([]Message, 0, len(msg.To))
+	for _, rcpt := range msg.To {
+		messages = append(messages, s.mandrillRecipientMessage(rcpt.Email, status, func(id string) types.Email {
+			email := types.Email{
+				From:        formatAddress(msg.FromName, msg.FromEmail),
+				Subject:     msg.Subject,
+				HTML:        msg.HTML,
+				Text:        msg.Text,
+				Headers:     msg.Headers,
+				ScheduledAt: scheduledAt,
+				Metadata:    map[string]string{"messageId": id},
+			}
+
+			// Without preserve_recipients every recipient only sees itself
+			address := formatAddress(rcpt.Name, rcpt.Email)
+			if !msg.PreserveRecipients {
+				email.To = []string{address}
+			} else {
+				email.To, email.CC = to, cc
+				if rcpt.Type == "bcc" {
+					email.BCC = []string{address}
+				}
+			}
+			if replyTo := msg.Headers["Reply-To"]; replyTo != "" {
+				email.ReplyTo = splitAddressList([]string{replyTo})
+			}
+
+			vars := mandrillRecipientVars(msg, rcpt.Email)
+			if templateName != "" {
+				email.TemplateID = templateName
+				email.TemplateData = vars
+				if len(templateContent) > 0 {
+					email.TemplateData["template_content"] = templateContent
+				}
+			}
+			if msg.Merge == nil || *msg.Merge {
+				email.Subject = renderMandrillMergeVars(email.Subject, vars, msg.MergeLanguage, false)
+				email.HTML = renderMandrillMergeVars(email.HTML, vars, msg.MergeLanguage, true)
+				email.Text = renderMandrillMergeVars(email.Text, vars, msg.MergeLanguage, false)
+			}
+
+			for k, v := range msg.Metadata {
+				email.Metadata[k] = metadataString(v)
+			}
+			for _, rm := range msg.RecipientMetadata {
+				if strings.EqualFold(rm.Rcpt, rcpt.Email) {
+					for k, v := range rm.Values {
+						email.Metadata[k] = metadataString(v)
+					}
+				}
+			}
+			if msg.Subaccount != "" {
+				email.Metadata["subaccount"] = msg.Subaccount
+			}
+			for _, tag := range msg.Tags {
+				email.Tags = append(email.Tags, types.Tag{Name: "tag", Value: tag})
+			}
+			for _, f := range msg.Attachments {
+				email.Attachments = append(email.Attachments, mandrillAttachment(f, "attachment"))
+			}
+			for _, f := range msg.Images {
+				email.Attachments = append(email.Attachments, mandrillAttachment(f, "inline"))
+			}
+			return email
+		}))
+	}
+	return messages, nil
+}
+
+// mandrillRecipientMessage builds the message for a recipient. Invalid
+// addresses and addresses on the rejection denylist are not delivered.
+func (s *Server) mandrillRecipientMessage(address, status string, build func(id string) types.Email) Message {
+	result := mandrillSendResult{Email: address, Status: status, ID: newMandrillID()}
+	if !strings.Contains(address, "@") {
+		result.Status = "invalid"
+		return Message{Skip: true, Result: result}
+	}
+	if reject, ok := s.store.GetReject(address); ok {
+		reason := reject.Reason
+		result.Status = "rejected"
+		result.RejectReason = &reason
+		return Message{Skip: true, Result: result}
+	}
+	return Message{Email: build(result.ID), Result: result}
+}
+
+// respondMandrillSend writes the status array, one entry per recipient
+func respondMandrillSend(w http.ResponseWriter, r *http.Request, messages []Message) {
+	results := make([]mandrillSendResult, 0, len(messages))
+	for _, m := range messages {
+		results = append(results, m.Result.(mandrillSendResult))
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+// mandrillSendStatus returns the status of accepted recipients: scheduled
+// with send_at, queued for async sends, sent otherwise
+func mandrillSendStatus(async bool, sendAt string) (string, *time.Time, *RequestError) {
+	if sendAt != "" {
+		t, err := time.Parse(mandrillSendAtLayout, sendAt)
+		if err != nil {
+			return "", nil, mandrillValidationError(`Validation error: {"send_at":"Please enter a valid date in the format YYYY-MM-DD HH:MM:SS"}`)
+		}
+		return "scheduled", &t, nil
+	}
+	if async {
+		return "queued", nil, nil
+	}
+	return "sent", nil, nil
+}
+
+// mandrillRecipientVars merges the global merge vars with those of the
+// recipient
+func mandrillRecipientVars(msg *mandrillMessage, rcpt string) map[string]interface{} {
+	vars := map[string]interface{}{}
+	for _, v := range msg.GlobalMergeVars {
+		vars[v.Name] = v.Content
+	}
+	for _, rv := range msg.MergeVars {
+		if strings.EqualFold(rv.Rcpt, rcpt) {
+			for _, v := range rv.Vars {
+				vars[v.Name] = v.Content
+			}
+		}
+	}
+	return vars
+}
+
+// renderMandrillMergeVars applies merge vars with the *|VAR|* syntax
+// (names are case-insensitive) or, for the handlebars merge language, with
+// {{var}}. Unknown merge tags are left in place.
+func renderMandrillMergeVars(s string, vars map[string]interface{}, language string, escapeHTML bool) string {
+	if s == "" || len(vars) == 0 {
+		return s
+	}
+	if language == "handlebars" {
+		return renderMustachio(s, vars, escapeHTML)
+	}
+	upper := make(map[string]interface{}, len(vars))
+	for k, v := range vars {
+		upper[strings.ToUpper(k)] = v
+	}
+	return mandrillMergeTag.ReplaceAllStringFunc(s, func(tag string) string {
+		name := strings.ToUpper(mandrillMergeTag.FindStringSubmatch(tag)[1])
+		if value, ok := upper[name]; ok {
+			return mustachioString(value)
+		}
+		return tag
+	})
+}
+
+func mandrillAttachment(f mandrillFile, disposition string) types.Attachment {
+	att := types.Attachment{
+		Filename:    f.Name,
+		Size:        base64DecodedSize(f.Content),
+		ContentType: f.Type,
+		Disposition: disposition,
+	}
+	if disposition == "inline" {
+		// Images are referenced as cid:name
+		att.ContentID = f.Name
+	}
+	if att.ContentType == "" {
+		att.ContentType = contentTypeByFilename(f.Name)
+	}
+	return att
+}
+
+// decodeMandrillRequest decodes the body and checks the key it carries
+func decodeMandrillRequest(r *http.Request, req interface{}, key func() string) *RequestError {
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return mandrillValidationError("You must specify a key value")
+	}
+	if key() == "" {
+		return &RequestError{Status: http.StatusInternalServerError, Code: "Invalid_Key", Message: "Invalid API key"}
+	}
+	return nil
+}
+
+// readMandrillRequest decodes the request of an endpoint that is not a
+// send. It writes the error response and returns false when the request
+// cannot proceed.
+func readMandrillRequest(w http.ResponseWriter, r *http.Request, req interface{}, key func() string) bool {
+	var err *RequestError
+	if r.Method != http.MethodPost {
+		err = &RequestError{Status: http.StatusMethodNotAllowed, Message: "Method not allowed"}
+	} else {
+		err = decodeMandrillRequest(r, req, key)
+	}
+	if err != nil {
+		mandrillProvider{}.WriteError(w, r, err)
+		return false
+	}
+	return true
+}
+
+// newMandrillID returns a 32 character hex ID like Mandrill's _id
+func newMandrillID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func mandrillValidationError(message string) *RequestError {
+	return &RequestError{Status: http.StatusInternalServerError, Code: "ValidationError", Message: message}
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/appaka/resendpit/types"
+)
+
+// mandrillRejectInfo is a denylist entry as returned by rejects/list
+type mandrillRejectInfo struct {
+	Email       string  `json:"email"`
+	Reason      string  `json:"reason"`
+	Detail      string  `json:"detail"`
+	CreatedAt   string  `json:"created_at"`
+	LastEventAt string  `json:"last_event_at"`
+	ExpiresAt   *string `json:"expires_at"`
+	Expired     bool    `json:"expired"`
+}
+
+// PostMandrillRejectsAdd handles POST /api/1.0/rejects/add.json. Sends to
+// the address are then rejected with reject_reason "custom".
+func (s *Server) PostMandrillRejectsAdd(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Key     string `json:"key"`
+		Email   string `json:"email"`
+		Comment string `json:"comment"`
+	}
+	if !readMandrillRequest(w, r, &req, func() string { return req.Key }) {
+		return
+	}
+	if !strings.Contains(req.Email, "@") {
+		mandrillProvider{}.WriteError(w, r, mandrillValidationError(`Validation error: {"email":"An email address must contain a single @"}`))
+		return
+	}
+	s.store.PutReject(types.Reject{
+		Email:     req.Email,
+		Reason:    "custom",
+		Detail:    req.Comment,
+		CreatedAt: time.Now().UTC(),
+	})
+	writeJSON(w, http.StatusOK, map[string]interface{}{"email": req.Email, "added": true})
+}
+
+// PostMandrillRejectsList handles POST /api/1.0/rejects/list.json,
+// optionally filtered by email
+func (s *Server) PostMandrillRejectsList(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Key   string `json:"key"`
+		Email string `json:"email"`
+	}
+	if !readMandrillRequest(w, r, &req, func() string { return req.Key }) {
+		return
+	}
+	results := []mandrillRejectInfo{}
+	for _, reject := range s.store.GetRejects() {
+		if req.Email != "" && !strings.EqualFold(reject.Email, req.Email) {
+			continue
+		}
+		created := reject.CreatedAt.Format(mandrillSendAtLayout)
+		results = append(results, mandrillRejectInfo{
+			Email:       reject.Email,
+			Reason:      reject.Reason,
+			Detail:      reject.Detail,
+			CreatedAt:   created,
+			LastEventAt: created,
+		})
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+// PostMandrillRejectsDelete handles POST /api/1.0/rejects/delete.json
+func (s *Server) PostMandrillRejectsDelete(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Key   string `json:"key"`
+		Email string `json:"email"`
+	}
+	if !readMandrillRequest(w, r, &req, func() string { return req.Key }) {
+		return
+	}
+	deleted := s.store.DeleteReject(req.Email)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"email": req.Email, "deleted": deleted})
+}
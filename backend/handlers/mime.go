@@ -1,76 +1,274 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/base64"
 	"io"
 	"mime"
 	"mime/multipart"
+	"mime/quotedprintable"
 	"net/mail"
+	"net/textproto"
 	"strings"
+
+	"github.com/appaka/resendpit/types"
 )
 
-// parseRawMIME decodes a base64-encoded MIME message and extracts subject, HTML, and text.
-func parseRawMIME(raw string) (subject, html, text string) {
+// parsedMIME is the content extracted from a raw MIME message
+type parsedMIME struct {
+	From        string
+	To          []string
+	CC          []string
+	BCC         []string
+	ReplyTo     []string
+	Subject     string
+	HTML        string
+	Text        string
+	Headers     map[string]string
+	Attachments []types.Attachment
+}
+
+// mimeStandardHeaders are stored in dedicated email fields, or only describe
+// the MIME structure, so they are not copied into Email.Headers
+var mimeStandardHeaders = map[string]bool{
+	"From":                      true,
+	"To":                        true,
+	"Cc":                        true,
+	"Bcc":                       true,
+	"Reply-To":                  true,
+	"Subject":                   true,
+	"Mime-Version":              true,
+	"Content-Type":              true,
+	"Content-Transfer-Encoding": true,
+}
+
+var headerDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+// parseRawMIME decodes a base64-encoded MIME message and extracts its content.
+func parseRawMIME(raw string) parsedMIME {
 	decoded, err := base64.StdEncoding.DecodeString(raw)
 	if err != nil {
-		return "", "", ""
+		return parsedMIME{}
 	}
+	return parseMIME(decoded)
+}
 
-	msg, err := mail.ReadMessage(strings.NewReader(string(decoded)))
+// parseMIME extracts addresses, subject, bodies, custom headers and
+// attachments from an RFC 822 message.
+func parseMIME(data []byte) parsedMIME {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
 	if err != nil {
-		return "", "", ""
+		return parsedMIME{}
+	}
+
+	result := parsedMIME{
+		To:      parseAddressHeader(msg.Header, "To"),
+		ReplyTo: parseAddressHeader(msg.Header, "Reply-To"),
+		CC:      parseAddressHeader(msg.Header, "Cc"),
+		BCC:     parseAddressHeader(msg.Header, "Bcc"),
+		Subject: decodeHeader(msg.Header.Get("Subject")),
+	}
+	if from := parseAddressHeader(msg.Header, "From"); len(from) > 0 {
+		result.From = from[0]
+	}
+	for key, values := range msg.Header {
+		key = textproto.CanonicalMIMEHeaderKey(key)
+		if mimeStandardHeaders[key] || len(values) == 0 {
+			continue
+		}
+		if result.Headers == nil {
+			result.Headers = map[string]string{}
+		}
+		result.Headers[key] = decodeHeader(values[0])
+	}
+
+	parseMIMEPart(&result, textproto.MIMEHeader(msg.Header), msg.Body)
+	return result
+}
+
+// envelopeRecipients splits the envelope recipients of a message into
+// To, Cc and Bcc. The envelope is authoritative: header recipients that are
+// not in the envelope are dropped, and envelope recipients missing from the
+// headers are Bcc (or To, when the headers name none of them).
+func (p parsedMIME) envelopeRecipients(envelope []string) (to, cc, bcc []string) {
+	recipients := make(map[string]bool, len(envelope))
+	for _, addr := range envelope {
+		recipients[strings.ToLower(extractAddress(addr))] = true
+	}
+	seen := map[string]bool{}
+	pick := func(addrs []string) []string {
+		var result []string
+		for _, addr := range addrs {
+			key := strings.ToLower(extractAddress(addr))
+			if recipients[key] && !seen[key] {
+				seen[key] = true
+				result = append(result, addr)
+			}
+		}
+		return result
 	}
 
-	subject = msg.Header.Get("Subject")
+	to = pick(p.To)
+	cc = pick(p.CC)
+	var hidden []string
+	for _, addr := range envelope {
+		if key := strings.ToLower(extractAddress(addr)); !seen[key] {
+			seen[key] = true
+			hidden = append(hidden, addr)
+		}
+	}
+	if len(to) == 0 && len(cc) == 0 {
+		return hidden, nil, nil
+	}
+	return to, cc, hidden
+}
 
-	contentType := msg.Header.Get("Content-Type")
-	mediaType, params, err := mime.ParseMediaType(contentType)
+// parseMIMEPart walks a (possibly multipart) entity, collecting bodies and
+// attachments into result
+func parseMIMEPart(result *parsedMIME, header textproto.MIMEHeader, body io.Reader) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
 	if err != nil {
-		// Try reading body as plain text
-		body, _ := io.ReadAll(msg.Body)
-		return subject, "", string(body)
+		mediaType = "text/plain"
 	}
 
 	if strings.HasPrefix(mediaType, "multipart/") {
-		html, text = parseMIMEParts(msg.Body, params["boundary"])
-	} else if strings.Contains(mediaType, "html") {
-		body, _ := io.ReadAll(msg.Body)
-		html = string(body)
-	} else {
-		body, _ := io.ReadAll(msg.Body)
-		text = string(body)
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err != nil {
+				break
+			}
+			parseMIMEPart(result, part.Header, part)
+		}
+		return
+	}
+
+	content, err := io.ReadAll(decodeTransferEncoding(header.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return
 	}
 
-	return subject, html, text
+	disposition, dispParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	filename := decodeHeader(dispParams["filename"])
+	if filename == "" {
+		filename = decodeHeader(params["name"])
+	}
+
+	isBody := disposition != "attachment" && filename == "" &&
+		(mediaType == "text/html" || mediaType == "text/plain")
+	if isBody {
+		text := decodeCharset(content, params["charset"])
+		if mediaType == "text/html" {
+			if result.HTML == "" {
+				result.HTML = text
+			}
+		} else if result.Text == "" {
+			result.Text = text
+		}
+		return
+	}
+
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	size := len(content)
+	result.Attachments = append(result.Attachments, types.Attachment{
+		Filename:    filename,
+		Size:        &size,
+		ContentType: mediaType,
+		ContentID:   strings.Trim(header.Get("Content-Id"), "<>"),
+		Disposition: disposition,
+	})
 }
 
-func parseMIMEParts(r io.Reader, boundary string) (html, text string) {
-	mr := multipart.NewReader(r, boundary)
+func decodeTransferEncoding(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &newlineStripper{r: r})
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+// newlineStripper removes line breaks so base64 bodies wrapped at 76
+// columns can be decoded with encoding/base64
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (n *newlineStripper) Read(p []byte) (int, error) {
 	for {
-		part, err := mr.NextPart()
-		if err != nil {
-			break
+		count, err := n.r.Read(p)
+		kept := 0
+		for _, b := range p[:count] {
+			if b != '\r' && b != '\n' && b != ' ' && b != '\t' {
+				p[kept] = b
+				kept++
+			}
 		}
-		ct := part.Header.Get("Content-Type")
-		body, err := io.ReadAll(part)
-		if err != nil {
-			continue
+		if kept > 0 || err != nil {
+			return kept, err
 		}
+	}
+}
 
-		mediaType, params, _ := mime.ParseMediaType(ct)
-		if strings.HasPrefix(mediaType, "multipart/") {
-			h, t := parseMIMEParts(strings.NewReader(string(body)), params["boundary"])
-			if h != "" {
-				html = h
-			}
-			if t != "" {
-				text = t
+// decodeHeader decodes RFC 2047 encoded words, returning the raw value if it
+// cannot be decoded
+func decodeHeader(value string) string {
+	decoded, err := headerDecoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+// parseAddressHeader returns the addresses of a header, formatted as
+// "Name <addr>" when a display name is present
+func parseAddressHeader(header mail.Header, key string) []string {
+	if header.Get(key) == "" {
+		return nil
+	}
+	list, err := header.AddressList(key)
+	if err != nil {
+		return []string{decodeHeader(header.Get(key))}
+	}
+	result := make([]string, 0, len(list))
+	for _, addr := range list {
+		result = append(result, formatAddress(addr.Name, addr.Address))
+	}
+	return result
+}
+
+// formatAddress formats an address as "Name <addr>", or just addr without
+// a display name
+func formatAddress(name, address string) string {
+	if name == "" {
+		return address
+	}
+	return name + " <" + address + ">"
+}
+
+// splitAddressList flattens repeated and comma-separated address fields,
+// formatting each address as "Name <addr>"
+func splitAddressList(values []string) []string {
+	var result []string
+	for _, value := range values {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		list, err := mail.ParseAddressList(value)
+		if err != nil {
+			for _, addr := range strings.Split(value, ",") {
+				if addr = strings.TrimSpace(addr); addr != "" {
+					result = append(result, addr)
+				}
 			}
-		} else if strings.Contains(ct, "html") {
-			html = string(body)
-		} else if strings.Contains(ct, "plain") {
-			text = string(body)
+			continue
+		}
+		for _, addr := range list {
+			result = append(result, formatAddress(addr.Name, addr.Address))
 		}
 	}
-	return html, text
+	return result
 }
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/appaka/resendpit/types"
+)
+
+// graphMessage is a Microsoft Graph message resource
+type graphMessage struct {
+	Subject                string            `json:"subject"`
+	Body                   graphItemBody     `json:"body"`
+	From                   *graphRecipient   `json:"from"`
+	ToRecipients           []graphRecipient  `json:"toRecipients"`
+	CcRecipients           []graphRecipient  `json:"ccRecipients"`
+	BccRecipients          []graphRecipient  `json:"bccRecipients"`
+	ReplyTo                []graphRecipient  `json:"replyTo"`
+	InternetMessageHeaders []graphHeader     `json:"internetMessageHeaders"`
+	Attachments            []graphAttachment `json:"attachments"`
+	Importance             string            `json:"importance"`
+	Categories             []string          `json:"categories"`
+}
+
+// graphItemBody is the message body; ContentType is "Text" or "HTML"
+type graphItemBody struct {
+	ContentType string `json:"contentType"`
+	Content     string `json:"content"`
+}
+
+type graphRecipient struct {
+	EmailAddress struct {
+		Address string `json:"address"`
+		Name    string `json:"name"`
+	} `json:"emailAddress"`
+}
+
+type graphHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type graphAttachment struct {
+	ODataType    string `json:"@odata.type"`
+	Name         string `json:"name"`
+	ContentType  string `json:"contentType"`
+	ContentBytes string `json:"contentBytes"`
+	ContentID    string `json:"contentId"`
+	IsInline     bool   `json:"isInline"`
+}
+
+// graphError is the Microsoft Graph error response
+type graphError struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// graphProvider emulates Microsoft Graph sendMail
+type graphProvider struct{}
+
+func init() {
+	registerProvider(graphProvider{})
+}
+
+func (graphProvider) Name() string { return "msgraph" }
+
+func (graphProvider) Routes(s *Server) []Route {
+	return []Route{
+		{Pattern: "/v1.0/users/{id}/sendMail", Method: http.MethodPost, Decode: decodeGraphSendMail, Respond: respondGraphSendMail},
+		{Pattern: "/v1.0/me/sendMail", Method: http.MethodPost, Decode: decodeGraphSendMail, Respond: respondGraphSendMail},
+	}
+}
+
+func (graphProvider) WriteError(w http.ResponseWriter, r *http.Request, err *RequestError) {
+	var resp graphError
+	resp.Error.Code = err.Code
+	resp.Error.Message = err.Message
+	writeJSON(w, err.Status, resp)
+}
+
+// decodeGraphSendMail decodes a POST /v1.0/users/{id}/sendMail or
+// /v1.0/me/sendMail request. The body is a JSON message or, with a
+// text/plain content type, a base64 encoded MIME message.
+func decodeGraphSendMail(r *http.Request) ([]Message, *RequestError) {
+	if r.Header.Get("Authorization") == "" {
+		return nil, &RequestError{Status: http.StatusUnauthorized, Code: "InvalidAuthenticationToken", Message: "Access token is empty."}
+	}
+
+	// The user is a mailbox address or an object ID; only an address can
+	// stand in for a missing from
+	user := r.PathValue("id")
+	if !strings.Contains(user, "@") {
+		user = ""
+	}
+
+	var email types.Email
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "text/plain" {
+		invalid := &RequestError{Status: http.StatusBadRequest, Code: "ErrorMimeContentInvalidBase64String", Message: "Invalid base64 string for MIME content."}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, invalid
+		}
+		data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(body)))
+		if err != nil {
+			return nil, invalid
+		}
+		email = graphMIMEEmail(data)
+	} else {
+		var req struct {
+			Message         *graphMessage `json:"message"`
+			SaveToSentItems *bool         `json:"saveToSentItems"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Message == nil {
+			return nil, &RequestError{Status: http.StatusBadRequest, Code: "ErrorInvalidRequest", Message: "Empty Payload. JSON content expected."}
+		}
+		email = graphEmail(req.Message)
+	}
+
+	if len(email.To)+len(email.CC)+len(email.BCC) == 0 {
+		return nil, &RequestError{Status: http.StatusBadRequest, Code: "ErrorInvalidRecipients", Message: "At least one recipient isn't valid., A message can't be sent because it contains no recipients."}
+	}
+	if email.From == "" {
+		email.From = user
+	}
+	if email.To == nil {
+		// Bcc-only messages still list an (empty) To
+		email.To = []string{}
+	}
+	return []Message{{Email: email}}, nil
+}
+
+// respondGraphSendMail answers 202 with no body, like Graph
+func respondGraphSendMail(w http.ResponseWriter, r *http.Request, messages []Message) {
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// graphEmail maps a Graph JSON message
+func graphEmail(msg *graphMessage) types.Email {
+	email := types.Email{
+		To:      graphAddresses(msg.ToRecipients),
+		CC:      graphAddresses(msg.CcRecipients),
+		BCC:     graphAddresses(msg.BccRecipients),
+		ReplyTo: graphAddresses(msg.ReplyTo),
+		Subject: msg.Subject,
+	}
+	if msg.From != nil {
+		email.From = formatAddress(msg.From.EmailAddress.Name, msg.From.EmailAddress.Address)
+	}
+	if strings.EqualFold(msg.Body.ContentType, "html") {
+		email.HTML = msg.Body.Content
+	} else {
+		email.Text = msg.Body.Content
+	}
+
+	for _, h := range msg.InternetMessageHeaders {
+		if email.Headers == nil {
+			email.Headers = map[string]string{}
+		}
+		email.Headers[h.Name] = h.Value
+	}
+	for _, category := range msg.Categories {
+		email.Tags = append(email.Tags, types.Tag{Name: "category", Value: category})
+	}
+	if msg.Importance != "" {
+		email.Metadata = map[string]string{"importance": msg.Importance}
+	}
+	for _, a := range msg.Attachments {
+		att := types.Attachment{
+			Filename:    a.Name,
+			Size:        base64DecodedSize(a.ContentBytes),
+			ContentType: a.ContentType,
+			ContentID:   a.ContentID,
+			Disposition: "attachment",
+		}
+		if a.IsInline {
+			att.Disposition = "inline"
+		}
+		if att.ContentType == "" {
+			att.ContentType = contentTypeByFilename(a.Name)
+		}
+		email.Attachments = append(email.Attachments, att)
+	}
+	return email
+}
+
+// graphMIMEEmail maps a MIME message sent to sendMail
+func graphMIMEEmail(data []byte) types.Email {
+	parsed := parseMIME(data)
+	return types.Email{
+		From:        parsed.From,
+		To:          parsed.To,
+		CC:          parsed.CC,
+		BCC:         parsed.BCC,
+		Subject:     parsed.Subject,
+		HTML:        parsed.HTML,
+		Text:        parsed.Text,
+		ReplyTo:     parsed.ReplyTo,
+		Headers:     parsed.Headers,
+		Attachments: parsed.Attachments,
+	}
+}
+
+func graphAddresses(list []graphRecipient) []string {
+	if len(list) == 0 {
+		return nil
+	}
+	result := make([]string, 0, len(list))
+	for _, r := range list {
+		result = append(result, formatAddress(r.EmailAddress.Name, r.EmailAddress.Address))
+	}
+	return result
+}
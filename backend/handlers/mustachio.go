@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// mustachioNode is a parsed piece of a Mustachio template (the Mustache
+// dialect Postmark templates use)
+type mustachioNode struct {
+	text     string
+	name     string
+	kind     mustachioKind
+	children []mustachioNode
+}
+
+type mustachioKind int
+
+const (
+	mustachioText mustachioKind = iota
+	mustachioVariable
+	mustachioRawVariable
+	mustachioSection
+	mustachioInverted
+	mustachioEach
+)
+
+// renderMustachio renders a template against a model. Supported tags are
+// {{var}} and {{nested.path}}, {{{raw}}}, {{#section}}, {{^inverted}},
+// {{#each list}}, {{.}}, {{../parent}} and {{! comments}}. {{var}} is
+// HTML-escaped when escapeHTML is set.
+func renderMustachio(template string, model interface{}, escapeHTML bool) string {
+	nodes, _ := parseMustachio(template, "")
+	var b strings.Builder
+	renderMustachioNodes(&b, nodes, []interface{}{model}, escapeHTML)
+	return b.String()
+}
+
+// parseMustachio parses until the closing tag of section (or the end of the
+// template) and returns the nodes and the unparsed rest
+func parseMustachio(s, section string) ([]mustachioNode, string) {
+	var nodes []mustachioNode
+	for {
+		start := strings.Index(s, "{{")
+		if start < 0 {
+			if s != "" {
+				nodes = append(nodes, mustachioNode{kind: mustachioText, text: s})
+			}
+			return nodes, ""
+		}
+		if start > 0 {
+			nodes = append(nodes, mustachioNode{kind: mustachioText, text: s[:start]})
+		}
+		s = s[start:]
+
+		if strings.HasPrefix(s, "{{{") {
+			end := strings.Index(s, "}}}")
+			if end < 0 {
+				nodes = append(nodes, mustachioNode{kind: mustachioText, text: s})
+				return nodes, ""
+			}
+			nodes = append(nodes, mustachioNode{kind: mustachioRawVariable, name: strings.TrimSpace(s[3:end])})
+			s = s[end+3:]
+			continue
+		}
+
+		end := strings.Index(s, "}}")
+		if end < 0 {
+			nodes = append(nodes, mustachioNode{kind: mustachioText, text: s})
+			return nodes, ""
+		}
+		tag := strings.TrimSpace(s[2:end])
+		s = s[end+2:]
+
+		switch {
+		case tag == "":
+		case tag[0] == '!':
+		case tag[0] == '/':
+			if section != "" {
+				return nodes, s
+			}
+		case tag[0] == '#' || tag[0] == '^':
+			name := strings.TrimSpace(tag[1:])
+			kind := mustachioSection
+			if tag[0] == '^' {
+				kind = mustachioInverted
+			} else if rest, ok := strings.CutPrefix(name, "each "); ok {
+				kind = mustachioEach
+				name = strings.TrimSpace(rest)
+			}
+			var children []mustachioNode
+			children, s = parseMustachio(s, name)
+			nodes = append(nodes, mustachioNode{kind: kind, name: name, children: children})
+		case tag[0] == '&':
+			nodes = append(nodes, mustachioNode{kind: mustachioRawVariable, name: strings.TrimSpace(tag[1:])})
+		default:
+			nodes = append(nodes, mustachioNode{kind: mustachioVariable, name: tag})
+		}
+	}
+}
+
+func renderMustachioNodes(b *strings.Builder, nodes []mustachioNode, stack []interface{}, escapeHTML bool) {
+	for _, node := range nodes {
+		switch node.kind {
+		case mustachioText:
+			b.WriteString(node.text)
+		case mustachioVariable:
+			value := mustachioString(lookupMustachio(stack, node.name))
+			if escapeHTML {
+				value = html.EscapeString(value)
+			}
+			b.WriteString(value)
+		case mustachioRawVariable:
+			b.WriteString(mustachioString(lookupMustachio(stack, node.name)))
+		case mustachioSection, mustachioEach:
+			value := lookupMustachio(stack, node.name)
+			if list, ok := value.([]interface{}); ok {
+				for _, item := range list {
+					renderMustachioNodes(b, node.children, append(stack, item), escapeHTML)
+				}
+			} else if node.kind == mustachioSection && mustachioTruthy(value) {
+				renderMustachioNodes(b, node.children, append(stack, value), escapeHTML)
+			}
+		case mustachioInverted:
+			if !mustachioTruthy(lookupMustachio(stack, node.name)) {
+				renderMustachioNodes(b, node.children, stack, escapeHTML)
+			}
+		}
+	}
+}
+
+// lookupMustachio resolves a dotted path. The first segment is searched
+// from the innermost scope outwards; each "../" prefix starts one scope up.
+func lookupMustachio(stack []interface{}, path string) interface{} {
+	for strings.HasPrefix(path, "../") {
+		path = path[3:]
+		if len(stack) > 1 {
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if path == "." || path == "this" {
+		return stack[len(stack)-1]
+	}
+
+	segments := strings.Split(path, ".")
+	for i := len(stack) - 1; i >= 0; i-- {
+		scope, ok := stack[i].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		value, ok := scope[segments[0]]
+		if !ok {
+			continue
+		}
+		for _, segment := range segments[1:] {
+			nested, ok := value.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			value = nested[segment]
+		}
+		return value
+	}
+	return nil
+}
+
+func mustachioTruthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case float64:
+		return v != 0
+	case []interface{}:
+		return len(v) > 0
+	}
+	return true
+}
+
+func mustachioString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
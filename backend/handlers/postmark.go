@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/appaka/resendpit/types"
+	"github.com/google/uuid"
+)
+
+// Postmark error codes
+const (
+	postmarkErrorNoToken          = 10
+	postmarkErrorInvalidRequest   = 300
+	postmarkErrorInvalidJSON      = 402
+	postmarkErrorTemplateNotFound = 1101
+	postmarkErrorTemplateField    = 1120
+	postmarkErrorTemplateAlias    = 1122
+)
+
+// postmarkMaxRecipients is the limit of To, Cc and Bcc recipients together
+const postmarkMaxRecipients = 50
+
+// postmarkMaxBatchSize is the number of messages a batch may hold
+const postmarkMaxBatchSize = 500
+
+// postmarkMessage is a Postmark email, with or without a template
+type postmarkMessage struct {
+	From          string               `json:"From"`
+	To            string               `json:"To"`
+	Cc            string               `json:"Cc"`
+	Bcc           string               `json:"Bcc"`
+	Subject       string               `json:"Subject"`
+	Tag           string               `json:"Tag"`
+	HtmlBody      string               `json:"HtmlBody"`
+	TextBody      string               `json:"TextBody"`
+	ReplyTo       string               `json:"ReplyTo"`
+	Headers       []postmarkHeader     `json:"Headers"`
+	TrackOpens    *bool                `json:"TrackOpens"`
+	TrackLinks    string               `json:"TrackLinks"`
+	Metadata      map[string]string    `json:"Metadata"`
+	Attachments   []postmarkAttachment `json:"Attachments"`
+	MessageStream string               `json:"MessageStream"`
+
+	TemplateId    int                    `json:"TemplateId"`
+	TemplateAlias string                 `json:"TemplateAlias"`
+	TemplateModel map[string]interface{} `json:"TemplateModel"`
+}
+
+type postmarkHeader struct {
+	Name  string `json:"Name"`
+	Value string `json:"Value"`
+}
+
+type postmarkAttachment struct {
+	Name        string `json:"Name"`
+	Content     string `json:"Content"`
+	ContentType string `json:"ContentType"`
+	ContentID   string `json:"ContentID"`
+}
+
+// postmarkSendResult is the response for one message
+type postmarkSendResult struct {
+	To          string `json:"To,omitempty"`
+	SubmittedAt string `json:"SubmittedAt,omitempty"`
+	MessageID   string `json:"MessageID,omitempty"`
+	ErrorCode   int    `json:"ErrorCode"`
+	Message     string `json:"Message"`
+}
+
+// postmarkProvider emulates the Postmark email, batch and templates APIs
+type postmarkProvider struct{}
+
+func init() {
+	registerProvider(postmarkProvider{})
+}
+
+func (postmarkProvider) Name() string { return "postmark" }
+
+func (postmarkProvider) Routes(s *Server) []Route {
+	return []Route{
+		{Pattern: "/email", Method: http.MethodPost, Decode: s.decodePostmarkEmail, Respond: respondPostmarkEmail},
+		{Pattern: "/email/withTemplate", Method: http.MethodPost, Decode: s.decodePostmarkEmailWithTemplate, Respond: respondPostmarkEmail},
+		{Pattern: "/email/batch", Method: http.MethodPost, Decode: s.decodePostmarkEmailBatch, Respond: respondPostmarkBatch},
+		{Pattern: "/email/batchWithTemplates", Method: http.MethodPost, Decode: s.decodePostmarkEmailBatchWithTemplates, Respond: respondPostmarkBatch},
+		{Pattern: "/templates", Handler: s.PostmarkTemplates},
+		{Pattern: "/templates/{idOrAlias}", Handler: s.PostmarkTemplate},
+	}
+}
+
+func (postmarkProvider) WriteError(w http.ResponseWriter, r *http.Request, err *RequestError) {
+	code, _ := strconv.Atoi(err.Code)
+	writePostmarkError(w, err.Status, code, err.Message)
+}
+
+// decodePostmarkEmail decodes a POST /email request
+func (s *Server) decodePostmarkEmail(r *http.Request) ([]Message, *RequestError) {
+	return s.decodePostmarkSend(r, false)
+}
+
+// decodePostmarkEmailWithTemplate decodes a POST /email/withTemplate
+// request
+func (s *Server) decodePostmarkEmailWithTemplate(r *http.Request) ([]Message, *RequestError) {
+	return s.decodePostmarkSend(r, true)
+}
+
+// decodePostmarkEmailBatch decodes a POST /email/batch request. Each
+// message gets its own result; the request succeeds even if some messages
+// are rejected.
+func (s *Server) decodePostmarkEmailBatch(r *http.Request) ([]Message, *RequestError) {
+	if err := requirePostmarkToken(r); err != nil {
+		return nil, err
+	}
+	var messages []postmarkMessage
+	if err := json.NewDecoder(r.Body).Decode(&messages); err != nil {
+		return nil, postmarkInvalidJSON()
+	}
+	return s.decodePostmarkBatch(messages, false)
+}
+
+// decodePostmarkEmailBatchWithTemplates decodes a POST
+// /email/batchWithTemplates request
+func (s *Server) decodePostmarkEmailBatchWithTemplates(r *http.Request) ([]Message, *RequestError) {
+	if err := requirePostmarkToken(r); err != nil {
+		return nil, err
+	}
+	var req struct {
+		Messages []postmarkMessage `json:"Messages"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, postmarkInvalidJSON()
+	}
+	return s.decodePostmarkBatch(req.Messages, true)
+}
+
+func (s *Server) decodePostmarkSend(r *http.Request, withTemplate bool) ([]Message, *RequestError) {
+	if err := requirePostmarkToken(r); err != nil {
+		return nil, err
+	}
+	var msg postmarkMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		return nil, postmarkInvalidJSON()
+	}
+
+	email, result := s.postmarkEmail(msg, withTemplate)
+	if result.ErrorCode != 0 {
+		return nil, &RequestError{Status: http.StatusUnprocessableEntity, Code: strconv.Itoa(result.ErrorCode), Message: result.Message}
+	}
+	return []Message{{Email: email, Result: result}}, nil
+}
+
+func (s *Server) decodePostmarkBatch(msgs []postmarkMessage, withTemplate bool) ([]Message, *RequestError) {
+	if len(msgs) > postmarkMaxBatchSize {
+		return nil, &RequestError{
+			Status:  http.StatusUnprocessableEntity,
+			Code:    strconv.Itoa(postmarkErrorInvalidRequest),
+			Message: "Batch messages are limited to " + strconv.Itoa(postmarkMaxBatchSize) + " messages.",
+		}
+	}
+	messages := make([]Message, 0, len(msgs))
+	for _, msg := range msgs {
+		email, result := s.postmarkEmail(msg, withTemplate)
+		messages = append(messages, Message{Email: email, Skip: result.ErrorCode != 0, Result: result})
+	}
+	return messages, nil
+}
+
+func respondPostmarkEmail(w http.ResponseWriter, r *http.Request, messages []Message) {
+	writeJSON(w, http.StatusOK, messages[0].Result)
+}
+
+func respondPostmarkBatch(w http.ResponseWriter, r *http.Request, messages []Message) {
+	results := make([]postmarkSendResult, 0, len(messages))
+	for _, m := range messages {
+		results = append(results, m.Result.(postmarkSendResult))
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+func postmarkInvalidJSON() *RequestError {
+	return &RequestError{
+		Status:  http.StatusUnprocessableEntity,
+		Code:    strconv.Itoa(postmarkErrorInvalidJSON),
+		Message: "Received invalid JSON input.",
+	}
+}
+
+// requirePostmarkToken rejects requests without a server token. Any token
+// is accepted.
+func requirePostmarkToken(r *http.Request) *RequestError {
+	if r.Header.Get("X-Postmark-Server-Token") == "" {
+		return &RequestError{
+			Status:  http.StatusUnauthorized,
+			Code:    strconv.Itoa(postmarkErrorNoToken),
+			Message: "No Account or Server API tokens were supplied in the HTTP headers. Please add a header for either X-Postmark-Server-Token or X-Postmark-Account-Token.",
+		}
+	}
+	return nil
+}
+
+// postmarkEmail validates and renders one message. The result has a
+// non-zero ErrorCode when the message is rejected.
+func (s *Server) postmarkEmail(msg postmarkMessage, withTemplate bool) (types.Email, postmarkSendResult) {
+	if withTemplate {
+		idOrAlias := msg.TemplateAlias
+		if msg.TemplateId != 0 {
+			idOrAlias = strconv.Itoa(msg.TemplateId)
+		}
+		if idOrAlias == "" {
+			return types.Email{}, postmarkSendResult{ErrorCode: postmarkErrorTemplateNotFound, Message: "A TemplateId or TemplateAlias must be specified."}
+		}
+		template, ok := s.store.GetTemplate(idOrAlias)
+		if !ok || template.TemplateType == "Layout" {
+			return types.Email{}, postmarkSendResult{ErrorCode: postmarkErrorTemplateNotFound, Message: "The Template's 'TemplateId' associated with this request is not valid or was not found."}
+		}
+		msg.Subject, msg.HtmlBody, msg.TextBody = s.renderPostmarkTemplate(template, msg.TemplateModel)
+	}
+
+	if strings.TrimSpace(msg.From) == "" {
+		return types.Email{}, postmarkSendResult{ErrorCode: postmarkErrorInvalidRequest, Message: "Invalid 'From' address: ''."}
+	}
+	to := splitAddressList([]string{msg.To})
+	cc := splitAddressList([]string{msg.Cc})
+	bcc := splitAddressList([]string{msg.Bcc})
+	recipients := len(to) + len(cc) + len(bcc)
+	if recipients == 0 {
+		return types.Email{}, postmarkSendResult{ErrorCode: postmarkErrorInvalidRequest, Message: "Zero recipients specified"}
+	}
+	if recipients > postmarkMaxRecipients {
+		return types.Email{}, postmarkSendResult{ErrorCode: postmarkErrorInvalidRequest, Message: "You may not have more than 50 total recipients (To, Cc, Bcc)."}
+	}
+	if msg.HtmlBody == "" && msg.TextBody == "" {
+		return types.Email{}, postmarkSendResult{ErrorCode: postmarkErrorInvalidRequest, Message: "Provide either email TextBody or HtmlBody or both."}
+	}
+
+	messageID := uuid.NewString()
+	now := time.Now()
+	stream := msg.MessageStream
+	if stream == "" {
+		stream = "outbound"
+	}
+
+	email := types.Email{
+		From:      msg.From,
+		To:        to,
+		CC:        cc,
+		BCC:       bcc,
+		Subject:   msg.Subject,
+		HTML:      msg.HtmlBody,
+		Text:      msg.TextBody,
+		ReplyTo:   splitAddressList([]string{msg.ReplyTo}),
+		CreatedAt: now.UTC(),
+		Metadata:  map[string]string{"messageId": messageID, "messageStream": stream},
+	}
+	if withTemplate {
+		email.TemplateID = msg.TemplateAlias
+		if msg.TemplateId != 0 {
+			email.TemplateID = strconv.Itoa(msg.TemplateId)
+		}
+		email.TemplateData = msg.TemplateModel
+	}
+	for key, value := range msg.Metadata {
+		email.Metadata[key] = value
+	}
+	if msg.TrackOpens != nil {
+		email.Metadata["trackOpens"] = strconv.FormatBool(*msg.TrackOpens)
+	}
+	if msg.TrackLinks != "" {
+		email.Metadata["trackLinks"] = msg.TrackLinks
+	}
+	if msg.Tag != "" {
+		email.Tags = []types.Tag{{Name: "tag", Value: msg.Tag}}
+	}
+	for _, h := range msg.Headers {
+		if email.Headers == nil {
+			email.Headers = map[string]string{}
+		}
+		email.Headers[h.Name] = h.Value
+	}
+	for _, a := range msg.Attachments {
+		att := types.Attachment{
+			Filename:    a.Name,
+			Size:        base64DecodedSize(a.Content),
+			ContentType: a.ContentType,
+			ContentID:   strings.TrimPrefix(a.ContentID, "cid:"),
+			Disposition: "attachment",
+		}
+		if att.ContentID != "" {
+			att.Disposition = "inline"
+		}
+		if att.ContentType == "" {
+			att.ContentType = contentTypeByFilename(a.Name)
+		}
+		email.Attachments = append(email.Attachments, att)
+	}
+
+	return email, postmarkSendResult{
+		To:          msg.To,
+		SubmittedAt: now.Format(time.RFC3339Nano),
+		MessageID:   messageID,
+		ErrorCode:   0,
+		Message:     "OK",
+	}
+}
+
+// renderPostmarkTemplate renders the subject and bodies of a template,
+// wrapping the bodies in the template's layout if it has one
+func (s *Server) renderPostmarkTemplate(template types.Template, model map[string]interface{}) (subject, htmlBody, textBody string) {
+	if model == nil {
+		model = map[string]interface{}{}
+	}
+	subject = renderMustachio(template.Subject, model, false)
+	htmlBody = renderMustachio(template.HTMLBody, model, true)
+	textBody = renderMustachio(template.TextBody, model, false)
+
+	if template.LayoutTemplate == "" {
+		return subject, htmlBody, textBody
+	}
+	layout, ok := s.store.GetTemplate(template.LayoutTemplate)
+	if !ok {
+		return subject, htmlBody, textBody
+	}
+	layoutModel := make(map[string]interface{}, len(model)+1)
+	for k, v := range model {
+		layoutModel[k] = v
+	}
+	if layout.HTMLBody != "" && htmlBody != "" {
+		layoutModel["@content"] = htmlBody
+		htmlBody = renderMustachio(layout.HTMLBody, layoutModel, true)
+	}
+	if layout.TextBody != "" && textBody != "" {
+		layoutModel["@content"] = textBody
+		textBody = renderMustachio(layout.TextBody, layoutModel, false)
+	}
+	return subject, htmlBody, textBody
+}
+
+func writePostmarkError(w http.ResponseWriter, status int, code int, message string) {
+	writeJSON(w, status, postmarkSendResult{ErrorCode: code, Message: message})
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/appaka/resendpit/types"
+)
+
+// postmarkTemplateRequest is the body of a create or edit template request
+type postmarkTemplateRequest struct {
+	Name           *string `json:"Name"`
+	Alias          *string `json:"Alias"`
+	Subject        *string `json:"Subject"`
+	HtmlBody       *string `json:"HtmlBody"`
+	TextBody       *string `json:"TextBody"`
+	TemplateType   string  `json:"TemplateType"`
+	LayoutTemplate *string `json:"LayoutTemplate"`
+}
+
+// postmarkTemplateSummary is a template as returned by create, edit and list
+type postmarkTemplateSummary struct {
+	TemplateId     int     `json:"TemplateId"`
+	Name           string  `json:"Name"`
+	Active         bool    `json:"Active"`
+	Alias          *string `json:"Alias"`
+	TemplateType   string  `json:"TemplateType"`
+	LayoutTemplate *string `json:"LayoutTemplate"`
+}
+
+// postmarkTemplateDetail is a template as returned by GET /templates/{id}
+type postmarkTemplateDetail struct {
+	postmarkTemplateSummary
+	Subject            string `json:"Subject"`
+	HtmlBody           string `json:"HtmlBody"`
+	TextBody           string `json:"TextBody"`
+	AssociatedServerId int    `json:"AssociatedServerId"`
+}
+
+// PostmarkTemplates handles GET and POST /templates
+func (s *Server) PostmarkTemplates(w http.ResponseWriter, r *http.Request) {
+	if err := requirePostmarkToken(r); err != nil {
+		postmarkProvider{}.WriteError(w, r, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.listPostmarkTemplates(w, r)
+	case http.MethodPost:
+		var req postmarkTemplateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writePostmarkError(w, http.StatusUnprocessableEntity, postmarkErrorInvalidJSON, "Received invalid JSON input.")
+			return
+		}
+		now := time.Now().UTC()
+		template := types.Template{TemplateType: "Standard", CreatedAt: now}
+		if req.TemplateType != "" {
+			template.TemplateType = req.TemplateType
+		}
+		applyPostmarkTemplateRequest(&template, req, now)
+		if code, message := validatePostmarkTemplate(template); code != 0 {
+			writePostmarkError(w, http.StatusUnprocessableEntity, code, message)
+			return
+		}
+		created, ok := s.store.AddTemplate(template)
+		if !ok {
+			writePostmarkError(w, http.StatusUnprocessableEntity, postmarkErrorTemplateAlias,
+				"The alias '"+template.Alias+"' is already in use by another template.")
+			return
+		}
+		writeJSON(w, http.StatusOK, newPostmarkTemplateSummary(created))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// PostmarkTemplate handles GET, PUT and DELETE /templates/{idOrAlias}
+func (s *Server) PostmarkTemplate(w http.ResponseWriter, r *http.Request) {
+	if err := requirePostmarkToken(r); err != nil {
+		postmarkProvider{}.WriteError(w, r, err)
+		return
+	}
+
+	template, ok := s.store.GetTemplate(r.PathValue("idOrAlias"))
+	if !ok {
+		writePostmarkError(w, http.StatusUnprocessableEntity, postmarkErrorTemplateNotFound,
+			"The Template's 'TemplateId' associated with this request is not valid or was not found.")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, postmarkTemplateDetail{
+			postmarkTemplateSummary: newPostmarkTemplateSummary(template),
+			Subject:                 template.Subject,
+			HtmlBody:                template.HTMLBody,
+			TextBody:                template.TextBody,
+			AssociatedServerId:      1,
+		})
+	case http.MethodPut:
+		var req postmarkTemplateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writePostmarkError(w, http.StatusUnprocessableEntity, postmarkErrorInvalidJSON, "Received invalid JSON input.")
+			return
+		}
+		applyPostmarkTemplateRequest(&template, req, time.Now().UTC())
+		if code, message := validatePostmarkTemplate(template); code != 0 {
+			writePostmarkError(w, http.StatusUnprocessableEntity, code, message)
+			return
+		}
+		if !s.store.UpdateTemplate(template) {
+			writePostmarkError(w, http.StatusUnprocessableEntity, postmarkErrorTemplateAlias,
+				"The alias '"+template.Alias+"' is already in use by another template.")
+			return
+		}
+		writeJSON(w, http.StatusOK, newPostmarkTemplateSummary(template))
+	case http.MethodDelete:
+		s.store.DeleteTemplate(template.ID)
+		writeJSON(w, http.StatusOK, postmarkSendResult{
+			ErrorCode: 0,
+			Message:   "Template " + strconv.Itoa(template.ID) + " removed.",
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// listPostmarkTemplates writes a page of templates, filtered by the
+// TemplateType query parameter (All, Standard or Layout)
+func (s *Server) listPostmarkTemplates(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	count, err := strconv.Atoi(query.Get("Count"))
+	if err != nil || count <= 0 {
+		count = 100
+	}
+	offset, _ := strconv.Atoi(query.Get("Offset"))
+	templateType := query.Get("TemplateType")
+
+	var matching []types.Template
+	for _, template := range s.store.GetTemplates() {
+		if templateType == "" || templateType == "All" || template.TemplateType == templateType {
+			matching = append(matching, template)
+		}
+	}
+
+	summaries := []postmarkTemplateSummary{}
+	for i := offset; i >= 0 && i < len(matching) && i < offset+count; i++ {
+		summaries = append(summaries, newPostmarkTemplateSummary(matching[i]))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"TotalCount": len(matching),
+		"Templates":  summaries,
+	})
+}
+
+// applyPostmarkTemplateRequest copies the fields present in req
+func applyPostmarkTemplateRequest(template *types.Template, req postmarkTemplateRequest, now time.Time) {
+	if req.Name != nil {
+		template.Name = *req.Name
+	}
+	if req.Alias != nil {
+		template.Alias = *req.Alias
+	}
+	if req.Subject != nil {
+		template.Subject = *req.Subject
+	}
+	if req.HtmlBody != nil {
+		template.HTMLBody = *req.HtmlBody
+	}
+	if req.TextBody != nil {
+		template.TextBody = *req.TextBody
+	}
+	if req.LayoutTemplate != nil {
+		template.LayoutTemplate = *req.LayoutTemplate
+	}
+	template.UpdatedAt = now
+}
+
+func validatePostmarkTemplate(template types.Template) (int, string) {
+	if template.Name == "" {
+		return postmarkErrorTemplateField, "The 'Name' field is required."
+	}
+	if template.TemplateType != "Standard" && template.TemplateType != "Layout" {
+		return postmarkErrorTemplateField, "The 'TemplateType' field must be 'Standard' or 'Layout'."
+	}
+	if template.HTMLBody == "" && template.TextBody == "" {
+		return postmarkErrorTemplateField, "Either 'HtmlBody' or 'TextBody' must be specified."
+	}
+	if template.TemplateType == "Standard" && template.Subject == "" {
+		return postmarkErrorTemplateField, "The 'Subject' field is required for standard templates."
+	}
+	return 0, ""
+}
+
+func newPostmarkTemplateSummary(template types.Template) postmarkTemplateSummary {
+	summary := postmarkTemplateSummary{
+		TemplateId:   template.ID,
+		Name:         template.Name,
+		Active:       true,
+		TemplateType: template.TemplateType,
+	}
+	if template.Alias != "" {
+		summary.Alias = &template.Alias
+	}
+	if template.LayoutTemplate != "" {
+		summary.LayoutTemplate = &template.LayoutTemplate
+	}
+	return summary
+}
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/appaka/resendpit/types"
+	"github.com/google/uuid"
+)
+
+// Provider is an emulated email or SMS API. Its send endpoints decode
+// requests into normalized messages, which are captured centrally before
+// the provider writes its success response.
+type Provider interface {
+	// Name identifies the provider in RESENDPIT_PROVIDERS and
+	// RESENDPIT_DISABLED_PROVIDERS and on captured emails
+	Name() string
+	// Routes returns the provider's endpoints on s
+	Routes(s *Server) []Route
+	// WriteError writes a rejected request in the provider's format
+	WriteError(w http.ResponseWriter, r *http.Request, err *RequestError)
+}
+
+// Route is an endpoint of a provider. Send endpoints set Decode and
+// Respond; other endpoints (templates, lists, ...) set Handler.
+type Route struct {
+	Pattern string
+	// Match optionally narrows the requests the route takes. Requests it
+	// does not match go to the next route registered for the pattern.
+	Match func(r *http.Request) bool
+
+	// Method is the method of a send endpoint; other methods get a 405
+	// error
+	Method  string
+	Decode  func(r *http.Request) ([]Message, *RequestError)
+	Respond func(w http.ResponseWriter, r *http.Request, messages []Message)
+
+	Handler http.HandlerFunc
+}
+
+// Message is a normalized message decoded from a send request: an email,
+// or a text message when SMS is set
+type Message struct {
+	Email types.Email
+	SMS   *types.SMS
+	// Skip marks messages the provider accepts but does not deliver, such
+	// as rejected recipients or invalid batch entries. They are not
+	// captured.
+	Skip bool
+	// Result holds provider data for the response (IDs, statuses, ...)
+	Result interface{}
+}
+
+// RequestError is a request a provider rejects. Code and Field are in the
+// provider's own terms; WriteError decides how they are written. Details
+// holds anything else the provider reports (e.g. every validation error).
+type RequestError struct {
+	Status  int
+	Code    string
+	Message string
+	Field   string
+	Details interface{}
+}
+
+func (e *RequestError) Error() string {
+	return e.Message
+}
+
+// capturer is implemented by providers that do more than store a captured
+// email (e.g. SES suppression and event notifications)
+type capturer interface {
+	Capture(s *Server, email types.Email)
+}
+
+var (
+	providers []Provider
+	// enabledProviders is nil when every provider is enabled
+	enabledProviders  map[string]bool
+	disabledProviders = map[string]bool{}
+)
+
+func init() {
+	if env := os.Getenv("RESENDPIT_PROVIDERS"); env != "" {
+		enabledProviders = map[string]bool{}
+		for _, name := range strings.Split(env, ",") {
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+				enabledProviders[name] = true
+			}
+		}
+	}
+	for _, name := range strings.Split(os.Getenv("RESENDPIT_DISABLED_PROVIDERS"), ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			disabledProviders[name] = true
+		}
+	}
+}
+
+// registerProvider adds a provider to the registry. Providers register
+// themselves from an init function in their own file.
+func registerProvider(p Provider) {
+	providers = append(providers, p)
+}
+
+// ProviderEnabled reports whether a provider is enabled: listed in
+// RESENDPIT_PROVIDERS (when set) and not in RESENDPIT_DISABLED_PROVIDERS
+func ProviderEnabled(name string) bool {
+	if enabledProviders != nil && !enabledProviders[name] {
+		return false
+	}
+	return !disabledProviders[name]
+}
+
+// ProviderNames reports whether each registered provider is enabled, keyed
+// by name
+func ProviderNames() map[string]bool {
+	result := make(map[string]bool, len(providers))
+	for _, p := range providers {
+		result[p.Name()] = ProviderEnabled(p.Name())
+	}
+	return result
+}
+
+// RegisterProviders adds the routes of all providers to mux. Requests to
+// a disabled provider get a 404 error. fallback serves everything no route
+// takes, including / (the web UI).
+func (s *Server) RegisterProviders(mux *http.ServeMux, fallback http.Handler) {
+	known := map[string]bool{}
+	for _, p := range providers {
+		known[p.Name()] = true
+	}
+	var unknown []string
+	for name := range enabledProviders {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	for name := range disabledProviders {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		log.Printf("Unknown providers in configuration: %s", strings.Join(unknown, ", "))
+	}
+
+	type entry struct {
+		provider Provider
+		route    Route
+	}
+	var patterns []string
+	routes := map[string][]entry{}
+	for _, p := range providers {
+		for _, route := range p.Routes(s) {
+			if _, ok := routes[route.Pattern]; !ok {
+				patterns = append(patterns, route.Pattern)
+			}
+			routes[route.Pattern] = append(routes[route.Pattern], entry{p, route})
+		}
+	}
+	if _, ok := routes["/"]; !ok {
+		patterns = append(patterns, "/")
+	}
+
+	for _, pattern := range patterns {
+		entries := routes[pattern]
+		handlers := make([]http.Handler, len(entries))
+		for i, e := range entries {
+			handlers[i] = s.routeHandler(e.provider, e.route)
+		}
+		mux.Handle(pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for i, e := range entries {
+				if e.route.Match == nil || e.route.Match(r) {
+					handlers[i].ServeHTTP(w, r)
+					return
+				}
+			}
+			fallback.ServeHTTP(w, r)
+		}))
+	}
+}
+
+// routeHandler serves a route of a provider: a send endpoint decodes the
+// request, captures the messages and responds with them
+func (s *Server) routeHandler(p Provider, route Route) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ProviderEnabled(p.Name()) {
+			http.Error(w, "The "+p.Name()+" provider is disabled", http.StatusNotFound)
+			return
+		}
+		if route.Handler != nil {
+			route.Handler(w, r)
+			return
+		}
+		if route.Method != "" && r.Method != route.Method {
+			p.WriteError(w, r, &RequestError{Status: http.StatusMethodNotAllowed, Code: "method_not_allowed", Message: "Method not allowed"})
+			return
+		}
+
+		messages, err := route.Decode(r)
+		if err != nil {
+			p.WriteError(w, r, err)
+			return
+		}
+		for i, m := range messages {
+			switch {
+			case m.Skip:
+			case m.SMS != nil:
+				s.captureSMS(p, m.SMS)
+			default:
+				messages[i].Email = s.captureEmail(p, r, m.Email)
+			}
+		}
+		route.Respond(w, r, messages)
+	})
+}
+
+// captureEmail fills in the ID, provider, creation time and mailbox of a
+// decoded email, then stores it
+func (s *Server) captureEmail(p Provider, r *http.Request, email types.Email) types.Email {
+	if email.ID == "" {
+		email.ID = uuid.NewString()
+	}
+	if email.Provider == "" {
+		email.Provider = p.Name()
+	}
+	if email.CreatedAt.IsZero() {
+		email.CreatedAt = time.Now().UTC()
+	}
+	if email.Mailbox == "" {
+		email.Mailbox = s.routeMailbox(r.Header.Get(MailboxHeader), requestAPIKey(r), email)
+	}
+	if c, ok := p.(capturer); ok {
+		c.Capture(s, email)
+	} else {
+		s.store.AddEmail(email)
+	}
+	return email
+}
+
+// cloneEmail returns a copy of email that shares no maps, slices or pointers
+// with it, for providers that capture one email per recipient
+func cloneEmail(email types.Email) types.Email {
+	email.To = slices.Clone(email.To)
+	email.CC = slices.Clone(email.CC)
+	email.BCC = slices.Clone(email.BCC)
+	email.ReplyTo = slices.Clone(email.ReplyTo)
+	email.Headers = maps.Clone(email.Headers)
+	email.Tags = slices.Clone(email.Tags)
+	email.Attachments = slices.Clone(email.Attachments)
+	for i, a := range email.Attachments {
+		if a.Size != nil {
+			size := *a.Size
+			email.Attachments[i].Size = &size
+		}
+	}
+	email.Metadata = maps.Clone(email.Metadata)
+	email.SuppressedRecipients = slices.Clone(email.SuppressedRecipients)
+	if email.ScheduledAt != nil {
+		t := *email.ScheduledAt
+		email.ScheduledAt = &t
+	}
+	email.TemplateData = maps.Clone(email.TemplateData)
+	return email
+}
+
+// captureSMS fills in the ID, provider and creation time of a decoded text
+// message, then stores it
+func (s *Server) captureSMS(p Provider, sms *types.SMS) {
+	if sms.ID == "" {
+		sms.ID = uuid.NewString()
+	}
+	if sms.Provider == "" {
+		sms.Provider = p.Name()
+	}
+	if sms.CreatedAt.IsZero() {
+		sms.CreatedAt = time.Now().UTC()
+	}
+	s.store.AddSMS(*sms)
+}
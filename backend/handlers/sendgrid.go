@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/appaka/resendpit/types"
+)
+
+// sendGridRequest is the body of a SendGrid v3 Mail Send request
+type sendGridRequest struct {
+	Personalizations []sendGridPersonalization `json:"personalizations"`
+	From             *sendGridAddress          `json:"from"`
+	ReplyTo          *sendGridAddress          `json:"reply_to"`
+	ReplyToList      []sendGridAddress         `json:"reply_to_list"`
+	Subject          string                    `json:"subject"`
+	Content          []sendGridContent         `json:"content"`
+	Attachments      []sendGridAttachment      `json:"attachments"`
+	TemplateID       string                    `json:"template_id"`
+	Headers          map[string]string         `json:"headers"`
+	Categories       []string                  `json:"categories"`
+	CustomArgs       map[string]string         `json:"custom_args"`
+	SendAt           int64                     `json:"send_at"`
+	BatchID          string                    `json:"batch_id"`
+}
+
+type sendGridPersonalization struct {
+	To                  []sendGridAddress      `json:"to"`
+	CC                  []sendGridAddress      `json:"cc"`
+	BCC                 []sendGridAddress      `json:"bcc"`
+	From                *sendGridAddress       `json:"from"`
+	Subject             string                 `json:"subject"`
+	Headers             map[string]string      `json:"headers"`
+	Substitutions       map[string]string      `json:"substitutions"`
+	DynamicTemplateData map[string]interface{} `json:"dynamic_template_data"`
+	CustomArgs          map[string]string      `json:"custom_args"`
+	SendAt              int64                  `json:"send_at"`
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sendGridAttachment struct {
+	Content     string `json:"content"`
+	Type        string `json:"type"`
+	Filename    string `json:"filename"`
+	Disposition string `json:"disposition"`
+	ContentID   string `json:"content_id"`
+}
+
+// sendGridError is an entry of a SendGrid error response. Field and Help
+// are null when they do not apply.
+type sendGridError struct {
+	Message string  `json:"message"`
+	Field   *string `json:"field"`
+	Help    *string `json:"help"`
+}
+
+// sendGridProvider emulates the SendGrid v3 Mail Send API
+type sendGridProvider struct{}
+
+func init() {
+	registerProvider(sendGridProvider{})
+}
+
+func (sendGridProvider) Name() string { return "sendgrid" }
+
+func (sendGridProvider) Routes(s *Server) []Route {
+	return []Route{
+		{Pattern: "/v3/mail/send", Method: http.MethodPost, Decode: decodeSendGridEmail, Respond: respondSendGridEmail},
+	}
+}
+
+// WriteError writes SendGrid's errors array. Details carries the full list
+// of validation errors.
+func (sendGridProvider) WriteError(w http.ResponseWriter, r *http.Request, err *RequestError) {
+	errs, ok := err.Details.([]sendGridError)
+	if !ok {
+		e := sendGridError{Message: err.Message}
+		if err.Field != "" {
+			e.Field = &err.Field
+		}
+		errs = []sendGridError{e}
+	}
+	writeSendGridErrors(w, err.Status, errs...)
+}
+
+// decodeSendGridEmail decodes a POST /v3/mail/send request. Each
+// personalization is captured as its own email.
+func decodeSendGridEmail(r *http.Request) ([]Message, *RequestError) {
+	var req sendGridRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, &RequestError{Status: http.StatusBadRequest, Message: "Bad Request"}
+	}
+
+	if errs := validateSendGridRequest(&req); len(errs) > 0 {
+		return nil, &RequestError{Status: http.StatusBadRequest, Message: errs[0].Message, Details: errs}
+	}
+
+	messageID := newSendGridMessageID()
+	now := time.Now().UTC()
+	messages := make([]Message, 0, len(req.Personalizations))
+	for _, p := range req.Personalizations {
+		messages = append(messages, Message{Email: sendGridEmail(&req, p, messageID, now), Result: messageID})
+	}
+	return messages, nil
+}
+
+// respondSendGridEmail answers 202 with the message ID in X-Message-Id
+func respondSendGridEmail(w http.ResponseWriter, r *http.Request, messages []Message) {
+	w.Header().Set("X-Message-Id", messages[0].Result.(string))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// validateSendGridRequest returns the errors SendGrid reports for a
+// malformed request
+func validateSendGridRequest(req *sendGridRequest) []sendGridError {
+	var errs []sendGridError
+	add := func(field, message string) {
+		errs = append(errs, sendGridError{Message: message, Field: &field})
+	}
+
+	if req.From == nil || req.From.Email == "" {
+		add("from", "The from object must be provided for every email send. It is an object that requires the email parameter, but may also contain a name parameter.")
+	} else if !strings.Contains(req.From.Email, "@") {
+		add("from.email", "The from email does not contain a valid address.")
+	}
+
+	if len(req.Personalizations) == 0 {
+		add("personalizations", "The personalizations field is required and must have at least one personalization.")
+	} else if len(req.Personalizations) > 1000 {
+		add("personalizations", "The personalizations field must have between 1 and 1000 personalizations.")
+	}
+	allHaveSubject := len(req.Personalizations) > 0
+	for i, p := range req.Personalizations {
+		if len(p.To) == 0 {
+			add(fmt.Sprintf("personalizations.%d.to", i), "The to array is required for all personalization objects, and must have at least one email object with a valid email address.")
+		}
+		for _, addr := range append(append(append([]sendGridAddress{}, p.To...), p.CC...), p.BCC...) {
+			if !strings.Contains(addr.Email, "@") {
+				add(fmt.Sprintf("personalizations.%d", i), "Does not contain a valid address.")
+				break
+			}
+		}
+		if p.Subject == "" {
+			allHaveSubject = false
+		}
+	}
+
+	if req.TemplateID == "" {
+		if req.Subject == "" && !allHaveSubject {
+			add("subject", "The subject is required. You can get around this requirement if you use a template with a subject defined or if every single personalization has a subject defined.")
+		}
+		hasContent := false
+		for _, c := range req.Content {
+			if c.Value != "" {
+				hasContent = true
+			}
+		}
+		if !hasContent {
+			add("content", "Unless a valid template_id is provided, the content parameter is required. There must be at least one defined content block. We typically suggest both text/plain and text/html blocks are included, but only one block is required.")
+		}
+	}
+
+	for i, a := range req.Attachments {
+		if a.Filename == "" {
+			add(fmt.Sprintf("attachments.%d.filename", i), "The attachment filename parameter is required.")
+		}
+		if a.Content == "" {
+			add(fmt.Sprintf("attachments.%d.content", i), "The attachment content is required.")
+		} else if _, err := base64.StdEncoding.DecodeString(a.Content); err != nil {
+			add(fmt.Sprintf("attachments.%d.content", i), "The attachment content must be base64 encoded.")
+		}
+		if a.Disposition == "inline" && a.ContentID == "" {
+			add(fmt.Sprintf("attachments.%d.content_id", i), "The content_id parameter is required if the disposition is set to inline.")
+		}
+	}
+
+	return errs
+}
+
+// sendGridEmail builds the email for one personalization, applying its
+// overrides on top of the message-level settings
+func sendGridEmail(req *sendGridRequest, p sendGridPersonalization, messageID string, now time.Time) types.Email {
+	from := req.From
+	if p.From != nil && p.From.Email != "" {
+		from = p.From
+	}
+	subject := req.Subject
+	if p.Subject != "" {
+		subject = p.Subject
+	}
+
+	email := types.Email{
+		From:         formatAddress(from.Name, from.Email),
+		To:           sendGridAddresses(p.To),
+		CC:           sendGridAddresses(p.CC),
+		BCC:          sendGridAddresses(p.BCC),
+		Subject:      subject,
+		CreatedAt:    now,
+		TemplateID:   req.TemplateID,
+		TemplateData: p.DynamicTemplateData,
+		Metadata:     map[string]string{"messageId": messageID},
+	}
+
+	if req.ReplyTo != nil && req.ReplyTo.Email != "" {
+		email.ReplyTo = append(email.ReplyTo, formatAddress(req.ReplyTo.Name, req.ReplyTo.Email))
+	}
+	email.ReplyTo = append(email.ReplyTo, sendGridAddresses(req.ReplyToList)...)
+
+	for _, c := range req.Content {
+		switch strings.ToLower(c.Type) {
+		case "text/html":
+			email.HTML = c.Value
+		case "text/plain":
+			email.Text = c.Value
+		}
+	}
+
+	// Legacy substitutions are replaced in the subject and content
+	for key, value := range p.Substitutions {
+		email.Subject = strings.ReplaceAll(email.Subject, key, value)
+		email.HTML = strings.ReplaceAll(email.HTML, key, value)
+		email.Text = strings.ReplaceAll(email.Text, key, value)
+	}
+
+	email.Headers = mergeStringMaps(req.Headers, p.Headers)
+	for key, value := range mergeStringMaps(req.CustomArgs, p.CustomArgs) {
+		email.Metadata[key] = value
+	}
+	if req.BatchID != "" {
+		email.Metadata["batchId"] = req.BatchID
+	}
+
+	for _, category := range req.Categories {
+		email.Tags = append(email.Tags, types.Tag{Name: "category", Value: category})
+	}
+
+	for _, a := range req.Attachments {
+		att := types.Attachment{
+			Filename:    a.Filename,
+			Size:        base64DecodedSize(a.Content),
+			ContentType: a.Type,
+			ContentID:   a.ContentID,
+			Disposition: a.Disposition,
+		}
+		if att.ContentType == "" {
+			att.ContentType = contentTypeByFilename(a.Filename)
+		}
+		if att.Disposition == "" {
+			att.Disposition = "attachment"
+		}
+		email.Attachments = append(email.Attachments, att)
+	}
+
+	sendAt := req.SendAt
+	if p.SendAt != 0 {
+		sendAt = p.SendAt
+	}
+	if sendAt != 0 {
+		t := time.Unix(sendAt, 0).UTC()
+		email.ScheduledAt = &t
+	}
+
+	return email
+}
+
+func sendGridAddresses(list []sendGridAddress) []string {
+	if len(list) == 0 {
+		return nil
+	}
+	result := make([]string, 0, len(list))
+	for _, addr := range list {
+		result = append(result, formatAddress(addr.Name, addr.Email))
+	}
+	return result
+}
+
+// mergeStringMaps returns base overridden by overrides, or nil when both
+// are empty
+func mergeStringMaps(base, overrides map[string]string) map[string]string {
+	if len(base) == 0 && len(overrides) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(base)+len(overrides))
+	for k, v := range base {
+		result[k] = v
+	}
+	for k, v := range overrides {
+		result[k] = v
+	}
+	return result
+}
+
+// newSendGridMessageID returns an ID in the format of SendGrid's
+// X-Message-Id header
+func newSendGridMessageID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func writeSendGridErrors(w http.ResponseWriter, status int, errs ...sendGridError) {
+	writeJSON(w, status, map[string][]sendGridError{"errors": errs})
+}
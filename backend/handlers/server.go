@@ -0,0 +1,17 @@
+package handlers
+
+import "github.com/appaka/resendpit/store"
+
+// Server serves the Resend-Pit API and the emulated providers on top of a
+// store. Servers share nothing, so several can run in one process (e.g. one
+// per test).
+type Server struct {
+	store  store.Store
+	events *store.Broadcaster
+}
+
+// NewServer returns a server capturing into st. events is the broadcaster
+// st publishes to, and feeds /api/events.
+func NewServer(st store.Store, events *store.Broadcaster) *Server {
+	return &Server{store: st, events: events}
+}
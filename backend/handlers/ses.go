@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/appaka/resendpit/sns"
+	"github.com/appaka/resendpit/types"
+)
+
+// sesProvider emulates Amazon SES: the v2 REST API, the v1 Query API on
+// POST / and the SNS endpoints its event notifications link to
+type sesProvider struct{}
+
+func init() {
+	registerProvider(sesProvider{})
+}
+
+func (sesProvider) Name() string { return "ses" }
+
+func (sesProvider) Routes(s *Server) []Route {
+	return []Route{
+		{Pattern: "/v2/email/outbound-emails", Method: http.MethodPost, Decode: s.decodeSESv2Email, Respond: respondSESv2Email},
+		{Pattern: "/v2/email/configuration-sets", Handler: s.SESv2ConfigurationSets},
+		{Pattern: "/v2/email/configuration-sets/{name}", Handler: s.SESv2ConfigurationSet},
+		{Pattern: "/v2/email/configuration-sets/{name}/event-destinations", Handler: s.SESv2EventDestinations},
+		{Pattern: "/v2/email/configuration-sets/{name}/event-destinations/{destination}", Handler: s.SESv2EventDestination},
+		{Pattern: "/v2/email/suppression/addresses", Handler: s.SESv2SuppressedDestinations},
+		{Pattern: "/v2/email/suppression/addresses/{address}", Handler: s.SESv2SuppressedDestination},
+		{Pattern: "/v2/email/contact-lists", Handler: s.SESv2ContactLists},
+		{Pattern: "/v2/email/contact-lists/{name}", Handler: s.SESv2ContactList},
+		{Pattern: "/v2/email/contact-lists/{name}/contacts", Handler: s.SESv2Contacts},
+		{Pattern: "/v2/email/contact-lists/{name}/contacts/list", Handler: s.SESv2Contacts},
+		{Pattern: "/v2/email/contact-lists/{name}/contacts/{address}", Handler: s.SESv2Contact},
+		{Pattern: "/ses/unsubscribe/{token}", Handler: s.SESUnsubscribe},
+
+		// Query API: form-encoded POST /, sends first
+		{Pattern: "/", Match: isSESv1Send, Method: http.MethodPost, Decode: s.decodeSESv1Send, Respond: respondSESv1Send},
+		{Pattern: "/", Match: isSESv1Request, Handler: s.PostSESv1Email},
+
+		// SubscribeURL and UnsubscribeURL of SNS notifications, and the
+		// certificate they are signed with
+		{Pattern: "/", Match: isSNSQuery, Handler: SNSQuery},
+		{Pattern: sns.SigningCertPath(), Handler: SNSSigningCert},
+	}
+}
+
+// WriteError writes a v1 Query API error for POST / and a v2 error
+// otherwise. Code is the AWS error code.
+func (sesProvider) WriteError(w http.ResponseWriter, r *http.Request, err *RequestError) {
+	if err.Status == http.StatusMethodNotAllowed {
+		http.Error(w, err.Message, err.Status)
+		return
+	}
+	if r.URL.Path == "/" {
+		writeSESv1Error(w, err.Code, err.Message)
+		return
+	}
+	writeSESv2Error(w, err.Code, err.Message)
+}
+
+// Capture stores the email with SES suppression and event notifications
+func (sesProvider) Capture(s *Server, email types.Email) {
+	s.captureSESEmail(email)
+}
+
+// isQueryRequest reports whether r is a form-encoded POST / (AWS Query
+// API, shared by SES v1 and SNS)
+func isQueryRequest(r *http.Request) bool {
+	return r.Method == http.MethodPost && r.URL.Path == "/" &&
+		strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded")
+}
+
+// queryAction returns the Action of a Query API request
+func queryAction(r *http.Request) string {
+	if r.ParseForm() != nil {
+		return ""
+	}
+	return r.Form.Get("Action")
+}
+
+// isSESv1Request reports whether r is an SES v1 request. SNS Publish
+// shares POST / and is left to the sns provider.
+func isSESv1Request(r *http.Request) bool {
+	return isQueryRequest(r) && queryAction(r) != "Publish"
+}
+
+// isSESv1Send reports whether r is an SES v1 SendEmail or SendRawEmail
+func isSESv1Send(r *http.Request) bool {
+	if !isQueryRequest(r) {
+		return false
+	}
+	action := queryAction(r)
+	return action == "SendEmail" || action == "SendRawEmail"
+}
+
+// isSNSQuery reports whether r is GET / with an Action
+func isSNSQuery(r *http.Request) bool {
+	return r.Method == http.MethodGet && r.URL.Path == "/" && r.URL.Query().Get("Action") != ""
+}
+
+func sesError(code, message string) *RequestError {
+	return &RequestError{Status: awsErrorStatusFor(code), Code: code, Message: message}
+}
@@ -0,0 +1,406 @@
+package handlers
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/appaka/resendpit/types"
+)
+
+// SES v1 configuration set result types
+
+type createConfigurationSetResult struct {
+	XMLName xml.Name `xml:"CreateConfigurationSetResult"`
+}
+
+type deleteConfigurationSetResult struct {
+	XMLName xml.Name `xml:"DeleteConfigurationSetResult"`
+}
+
+type describeConfigurationSetResult struct {
+	XMLName           xml.Name                `xml:"DescribeConfigurationSetResult"`
+	ConfigurationSet  sesV1ConfigurationSet   `xml:"ConfigurationSet"`
+	EventDestinations []sesV1EventDestination `xml:"EventDestinations>member,omitempty"`
+}
+
+type listConfigurationSetsResult struct {
+	XMLName           xml.Name                `xml:"ListConfigurationSetsResult"`
+	ConfigurationSets []sesV1ConfigurationSet `xml:"ConfigurationSets>member"`
+	NextToken         string                  `xml:"NextToken,omitempty"`
+}
+
+type sesV1ConfigurationSet struct {
+	Name string `xml:"Name"`
+}
+
+type sesV1EventDestination struct {
+	Name               string   `xml:"Name"`
+	Enabled            bool     `xml:"Enabled"`
+	MatchingEventTypes []string `xml:"MatchingEventTypes>member"`
+	TopicARN           string   `xml:"SNSDestination>TopicARN,omitempty"`
+}
+
+type eventDestinationResult struct {
+	XMLName xml.Name
+}
+
+// SES v2 configuration set request/response types
+
+type sesV2CreateConfigurationSetRequest struct {
+	ConfigurationSetName string `json:"ConfigurationSetName"`
+}
+
+type sesV2EventDestinationRequest struct {
+	EventDestinationName string                `json:"EventDestinationName"`
+	EventDestination     sesV2EventDestination `json:"EventDestination"`
+}
+
+type sesV2EventDestination struct {
+	Name               string               `json:"Name,omitempty"`
+	Enabled            bool                 `json:"Enabled"`
+	MatchingEventTypes []string             `json:"MatchingEventTypes"`
+	SnsDestination     *sesV2SnsDestination `json:"SnsDestination,omitempty"`
+}
+
+type sesV2SnsDestination struct {
+	TopicArn string `json:"TopicArn"`
+}
+
+func (s *Server) handleCreateConfigurationSet(w http.ResponseWriter, form url.Values) {
+	name := form.Get("ConfigurationSet.Name")
+	if name == "" {
+		writeSESv1Error(w, "ValidationError", "ConfigurationSet.Name is required")
+		return
+	}
+
+	if !s.store.AddConfigurationSet(types.ConfigurationSet{Name: name, CreatedAt: time.Now().UTC()}) {
+		writeSESv1Error(w, "ConfigurationSetAlreadyExists", fmt.Sprintf("Configuration set <%s> already exists.", name))
+		return
+	}
+
+	writeSESv1Result(w, "CreateConfigurationSet", createConfigurationSetResult{})
+}
+
+func (s *Server) handleDeleteConfigurationSet(w http.ResponseWriter, form url.Values) {
+	name := form.Get("ConfigurationSetName")
+	if !s.store.DeleteConfigurationSet(name) {
+		writeConfigurationSetDoesNotExist(w, name)
+		return
+	}
+
+	writeSESv1Result(w, "DeleteConfigurationSet", deleteConfigurationSetResult{})
+}
+
+func (s *Server) handleDescribeConfigurationSet(w http.ResponseWriter, form url.Values) {
+	name := form.Get("ConfigurationSetName")
+	set, ok := s.store.GetConfigurationSet(name)
+	if !ok {
+		writeConfigurationSetDoesNotExist(w, name)
+		return
+	}
+
+	result := describeConfigurationSetResult{ConfigurationSet: sesV1ConfigurationSet{Name: set.Name}}
+	for _, attr := range extractIndexedFormValues(form, "ConfigurationSetAttributeNames.member.") {
+		if attr != "eventDestinations" {
+			continue
+		}
+		for _, dest := range set.EventDestinations {
+			v1 := sesV1EventDestination{Name: dest.Name, Enabled: dest.Enabled, TopicARN: dest.SNSTopicArn}
+			for _, t := range dest.MatchingEventTypes {
+				v1.MatchingEventTypes = append(v1.MatchingEventTypes, sesEventTypeToV1(t))
+			}
+			result.EventDestinations = append(result.EventDestinations, v1)
+		}
+	}
+
+	writeSESv1Result(w, "DescribeConfigurationSet", result)
+}
+
+func (s *Server) handleListConfigurationSets(w http.ResponseWriter, form url.Values) {
+	sets := s.store.GetConfigurationSets()
+
+	start, end, next, ok := pageBounds(len(sets), form.Get("NextToken"), form.Get("MaxItems"), 1000)
+	if !ok {
+		writeSESv1Error(w, "InvalidParameterValue", "Invalid NextToken or MaxItems")
+		return
+	}
+
+	result := listConfigurationSetsResult{ConfigurationSets: []sesV1ConfigurationSet{}, NextToken: next}
+	for _, set := range sets[start:end] {
+		result.ConfigurationSets = append(result.ConfigurationSets, sesV1ConfigurationSet{Name: set.Name})
+	}
+
+	writeSESv1Result(w, "ListConfigurationSets", result)
+}
+
+// handlePutConfigurationSetEventDestination handles both
+// CreateConfigurationSetEventDestination and UpdateConfigurationSetEventDestination
+func (s *Server) handlePutConfigurationSetEventDestination(w http.ResponseWriter, form url.Values, action string) {
+	setName := form.Get("ConfigurationSetName")
+	set, ok := s.store.GetConfigurationSet(setName)
+	if !ok {
+		writeConfigurationSetDoesNotExist(w, setName)
+		return
+	}
+
+	dest := types.EventDestination{
+		Name:        form.Get("EventDestination.Name"),
+		Enabled:     form.Get("EventDestination.Enabled") == "true",
+		SNSTopicArn: form.Get("EventDestination.SNSDestination.TopicARN"),
+	}
+	if dest.Name == "" {
+		writeSESv1Error(w, "ValidationError", "EventDestination.Name is required")
+		return
+	}
+	for _, t := range extractIndexedFormValues(form, "EventDestination.MatchingEventTypes.member.") {
+		v2, ok := sesEventTypeFromV1(t)
+		if !ok {
+			writeSESv1Error(w, "ValidationError", fmt.Sprintf("Invalid event type: %s", t))
+			return
+		}
+		dest.MatchingEventTypes = append(dest.MatchingEventTypes, v2)
+	}
+
+	exists := hasEventDestination(set, dest.Name)
+	if action == "CreateConfigurationSetEventDestination" && exists {
+		writeSESv1Error(w, "EventDestinationAlreadyExists",
+			fmt.Sprintf("Event destination %s already exists in configuration set %s.", dest.Name, setName))
+		return
+	}
+	if action == "UpdateConfigurationSetEventDestination" && !exists {
+		writeEventDestinationDoesNotExist(w, setName, dest.Name)
+		return
+	}
+
+	s.store.PutEventDestination(setName, dest)
+
+	writeSESv1Result(w, action, eventDestinationResult{XMLName: xml.Name{Local: action + "Result"}})
+}
+
+func (s *Server) handleDeleteConfigurationSetEventDestination(w http.ResponseWriter, form url.Values) {
+	setName := form.Get("ConfigurationSetName")
+	destName := form.Get("EventDestinationName")
+	if _, ok := s.store.GetConfigurationSet(setName); !ok {
+		writeConfigurationSetDoesNotExist(w, setName)
+		return
+	}
+	if !s.store.DeleteEventDestination(setName, destName) {
+		writeEventDestinationDoesNotExist(w, setName, destName)
+		return
+	}
+
+	writeSESv1Result(w, "DeleteConfigurationSetEventDestination",
+		eventDestinationResult{XMLName: xml.Name{Local: "DeleteConfigurationSetEventDestinationResult"}})
+}
+
+func writeConfigurationSetDoesNotExist(w http.ResponseWriter, name string) {
+	writeSESv1Error(w, "ConfigurationSetDoesNotExist", fmt.Sprintf("Configuration set <%s> does not exist.", name))
+}
+
+func writeEventDestinationDoesNotExist(w http.ResponseWriter, setName, destName string) {
+	writeSESv1Error(w, "EventDestinationDoesNotExist",
+		fmt.Sprintf("Event destination %s does not exist in configuration set %s.", destName, setName))
+}
+
+// SESv2ConfigurationSets handles GET/POST /v2/email/configuration-sets
+func (s *Server) SESv2ConfigurationSets(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		sets := s.store.GetConfigurationSets()
+		start, end, next, ok := pageBounds(len(sets), r.URL.Query().Get("NextToken"), r.URL.Query().Get("PageSize"), 1000)
+		if !ok {
+			writeSESv2Error(w, "BadRequestException", "Invalid NextToken or PageSize")
+			return
+		}
+		names := []string{}
+		for _, set := range sets[start:end] {
+			names = append(names, set.Name)
+		}
+		resp := map[string]interface{}{"ConfigurationSets": names}
+		if next != "" {
+			resp["NextToken"] = next
+		}
+		writeJSON(w, http.StatusOK, resp)
+	case http.MethodPost:
+		var req sesV2CreateConfigurationSetRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ConfigurationSetName == "" {
+			writeSESv2Error(w, "BadRequestException", "ConfigurationSetName is required")
+			return
+		}
+		if !s.store.AddConfigurationSet(types.ConfigurationSet{Name: req.ConfigurationSetName, CreatedAt: time.Now().UTC()}) {
+			writeSESv2Error(w, "AlreadyExistsException",
+				fmt.Sprintf("Configuration set %s already exists.", req.ConfigurationSetName))
+			return
+		}
+		writeJSON(w, http.StatusOK, struct{}{})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// SESv2ConfigurationSet handles GET/DELETE /v2/email/configuration-sets/{name}
+func (s *Server) SESv2ConfigurationSet(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	switch r.Method {
+	case http.MethodGet:
+		set, ok := s.store.GetConfigurationSet(name)
+		if !ok {
+			writeSESv2ConfigurationSetNotFound(w, name)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"ConfigurationSetName": set.Name,
+			"DeliveryOptions":      map[string]string{"TlsPolicy": "OPTIONAL"},
+			"ReputationOptions":    map[string]bool{"ReputationMetricsEnabled": false},
+			"SendingOptions":       map[string]bool{"SendingEnabled": true},
+			"Tags":                 []types.Tag{},
+		})
+	case http.MethodDelete:
+		if !s.store.DeleteConfigurationSet(name) {
+			writeSESv2ConfigurationSetNotFound(w, name)
+			return
+		}
+		writeJSON(w, http.StatusOK, struct{}{})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// SESv2EventDestinations handles GET/POST
+// /v2/email/configuration-sets/{name}/event-destinations
+func (s *Server) SESv2EventDestinations(w http.ResponseWriter, r *http.Request) {
+	setName := r.PathValue("name")
+	set, ok := s.store.GetConfigurationSet(setName)
+	if !ok {
+		writeSESv2ConfigurationSetNotFound(w, setName)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		dests := []sesV2EventDestination{}
+		for _, dest := range set.EventDestinations {
+			v2 := sesV2EventDestination{Name: dest.Name, Enabled: dest.Enabled, MatchingEventTypes: dest.MatchingEventTypes}
+			if dest.SNSTopicArn != "" {
+				v2.SnsDestination = &sesV2SnsDestination{TopicArn: dest.SNSTopicArn}
+			}
+			dests = append(dests, v2)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"EventDestinations": dests})
+	case http.MethodPost:
+		var req sesV2EventDestinationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.EventDestinationName == "" {
+			writeSESv2Error(w, "BadRequestException", "EventDestinationName is required")
+			return
+		}
+		if hasEventDestination(set, req.EventDestinationName) {
+			writeSESv2Error(w, "AlreadyExistsException",
+				fmt.Sprintf("Event destination %s already exists in configuration set %s.", req.EventDestinationName, setName))
+			return
+		}
+		s.putSESv2EventDestination(w, setName, req.EventDestinationName, req.EventDestination)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// SESv2EventDestination handles PUT/DELETE
+// /v2/email/configuration-sets/{name}/event-destinations/{destination}
+func (s *Server) SESv2EventDestination(w http.ResponseWriter, r *http.Request) {
+	setName := r.PathValue("name")
+	destName := r.PathValue("destination")
+	set, ok := s.store.GetConfigurationSet(setName)
+	if !ok {
+		writeSESv2ConfigurationSetNotFound(w, setName)
+		return
+	}
+	if !hasEventDestination(set, destName) {
+		writeSESv2Error(w, "NotFoundException",
+			fmt.Sprintf("Event destination %s does not exist in configuration set %s.", destName, setName))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var req sesV2EventDestinationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeSESv2Error(w, "BadRequestException", "Invalid JSON in request body")
+			return
+		}
+		s.putSESv2EventDestination(w, setName, destName, req.EventDestination)
+	case http.MethodDelete:
+		s.store.DeleteEventDestination(setName, destName)
+		writeJSON(w, http.StatusOK, struct{}{})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) putSESv2EventDestination(w http.ResponseWriter, setName, destName string, req sesV2EventDestination) {
+	dest := types.EventDestination{
+		Name:               destName,
+		Enabled:            req.Enabled,
+		MatchingEventTypes: req.MatchingEventTypes,
+	}
+	for _, t := range dest.MatchingEventTypes {
+		if !isSESEventTypeV2(t) {
+			writeSESv2Error(w, "BadRequestException", fmt.Sprintf("Invalid event type: %s", t))
+			return
+		}
+	}
+	if req.SnsDestination != nil {
+		dest.SNSTopicArn = req.SnsDestination.TopicArn
+	}
+
+	s.store.PutEventDestination(setName, dest)
+
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+func writeSESv2ConfigurationSetNotFound(w http.ResponseWriter, name string) {
+	writeSESv2Error(w, "NotFoundException", fmt.Sprintf("Configuration set %s does not exist.", name))
+}
+
+func hasEventDestination(set types.ConfigurationSet, name string) bool {
+	for _, dest := range set.EventDestinations {
+		if dest.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// pageBounds resolves a NextToken/page size pair into slice bounds over total
+// items. Tokens are plain offsets. It returns false if either value is invalid.
+func pageBounds(total int, token, size string, maxSize int) (start, end int, next string, ok bool) {
+	pageSize := maxSize
+	if size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil || n < 0 || n > maxSize {
+			return 0, 0, "", false
+		}
+		pageSize = n
+	}
+	if token != "" {
+		n, err := strconv.Atoi(token)
+		if err != nil || n < 0 {
+			return 0, 0, "", false
+		}
+		start = n
+	}
+	if start > total {
+		start = total
+	}
+	end = start + pageSize
+	if end < total {
+		next = strconv.Itoa(end)
+	} else {
+		end = total
+	}
+	return start, end, next, true
+}
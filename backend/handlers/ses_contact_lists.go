@@ -0,0 +1,503 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/appaka/resendpit/config"
+	"github.com/appaka/resendpit/types"
+)
+
+// sesUnsubscribePlaceholder is replaced by the unsubscribe URL in email bodies
+// sent with ListManagementOptions
+const sesUnsubscribePlaceholder = "{{amazonSESUnsubscribeUrl}}"
+
+// SES v2 contact list request/response types
+
+type sesV2Topic struct {
+	TopicName                 string `json:"TopicName"`
+	DisplayName               string `json:"DisplayName"`
+	Description               string `json:"Description,omitempty"`
+	DefaultSubscriptionStatus string `json:"DefaultSubscriptionStatus"`
+}
+
+type sesV2TopicPreference struct {
+	TopicName          string `json:"TopicName"`
+	SubscriptionStatus string `json:"SubscriptionStatus"`
+}
+
+type sesV2ContactListRequest struct {
+	ContactListName string       `json:"ContactListName"`
+	Topics          []sesV2Topic `json:"Topics"`
+	Description     string       `json:"Description"`
+}
+
+type sesV2ContactRequest struct {
+	EmailAddress     string                 `json:"EmailAddress"`
+	TopicPreferences []sesV2TopicPreference `json:"TopicPreferences"`
+	UnsubscribeAll   bool                   `json:"UnsubscribeAll"`
+	AttributesData   string                 `json:"AttributesData"`
+}
+
+type sesV2ListContactsRequest struct {
+	Filter *struct {
+		FilteredStatus string `json:"FilteredStatus"`
+		TopicFilter    *struct {
+			TopicName                         string `json:"TopicName"`
+			UseDefaultIfPreferenceUnavailable bool   `json:"UseDefaultIfPreferenceUnavailable"`
+		} `json:"TopicFilter"`
+	} `json:"Filter"`
+	PageSize  string `json:"PageSize"`
+	NextToken string `json:"NextToken"`
+}
+
+type sesListManagementOptions struct {
+	ContactListName string `json:"ContactListName"`
+	TopicName       string `json:"TopicName"`
+}
+
+// SESv2ContactLists handles GET/POST /v2/email/contact-lists
+func (s *Server) SESv2ContactLists(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		lists := s.store.GetContactLists()
+		start, end, next, ok := pageBounds(len(lists), r.URL.Query().Get("NextToken"), r.URL.Query().Get("PageSize"), 1000)
+		if !ok {
+			writeSESv2Error(w, "BadRequestException", "Invalid NextToken or PageSize")
+			return
+		}
+		summaries := []map[string]interface{}{}
+		for _, list := range lists[start:end] {
+			summaries = append(summaries, map[string]interface{}{
+				"ContactListName":      list.Name,
+				"LastUpdatedTimestamp": epochSeconds(list.UpdatedAt),
+			})
+		}
+		resp := map[string]interface{}{"ContactLists": summaries}
+		if next != "" {
+			resp["NextToken"] = next
+		}
+		writeJSON(w, http.StatusOK, resp)
+	case http.MethodPost:
+		var req sesV2ContactListRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ContactListName == "" {
+			writeSESv2Error(w, "BadRequestException", "ContactListName is required")
+			return
+		}
+		topics, ok := sesV2Topics(w, req.Topics)
+		if !ok {
+			return
+		}
+		now := time.Now().UTC()
+		list := types.ContactList{Name: req.ContactListName, Description: req.Description, Topics: topics, CreatedAt: now, UpdatedAt: now}
+		if !s.store.AddContactList(list) {
+			writeSESv2Error(w, "AlreadyExistsException", fmt.Sprintf("List with name %s already exists.", req.ContactListName))
+			return
+		}
+		writeJSON(w, http.StatusOK, struct{}{})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// SESv2ContactList handles GET/PUT/DELETE /v2/email/contact-lists/{name}
+func (s *Server) SESv2ContactList(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	list, ok := s.store.GetContactList(name)
+	if !ok {
+		writeSESv2ContactListNotFound(w, name)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		topics := []sesV2Topic{}
+		for _, t := range list.Topics {
+			topics = append(topics, sesV2Topic{
+				TopicName:                 t.Name,
+				DisplayName:               t.DisplayName,
+				Description:               t.Description,
+				DefaultSubscriptionStatus: t.DefaultSubscriptionStatus,
+			})
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"ContactListName":      list.Name,
+			"Description":          list.Description,
+			"Topics":               topics,
+			"CreatedTimestamp":     epochSeconds(list.CreatedAt),
+			"LastUpdatedTimestamp": epochSeconds(list.UpdatedAt),
+			"Tags":                 []types.Tag{},
+		})
+	case http.MethodPut:
+		var req sesV2ContactListRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeSESv2Error(w, "BadRequestException", "Invalid JSON in request body")
+			return
+		}
+		topics, ok := sesV2Topics(w, req.Topics)
+		if !ok {
+			return
+		}
+		list.Topics = topics
+		list.Description = req.Description
+		list.UpdatedAt = time.Now().UTC()
+		s.store.UpdateContactList(list)
+		writeJSON(w, http.StatusOK, struct{}{})
+	case http.MethodDelete:
+		s.store.DeleteContactList(name)
+		writeJSON(w, http.StatusOK, struct{}{})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// SESv2Contacts handles POST/GET /v2/email/contact-lists/{name}/contacts and
+// POST /v2/email/contact-lists/{name}/contacts/list
+func (s *Server) SESv2Contacts(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	list, ok := s.store.GetContactList(name)
+	if !ok {
+		writeSESv2ContactListNotFound(w, name)
+		return
+	}
+
+	listing := r.Method == http.MethodGet || strings.HasSuffix(r.URL.Path, "/contacts/list")
+	switch {
+	case listing && (r.Method == http.MethodGet || r.Method == http.MethodPost):
+		s.listContacts(w, r, list)
+	case r.Method == http.MethodPost:
+		var req sesV2ContactRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.EmailAddress == "" {
+			writeSESv2Error(w, "BadRequestException", "EmailAddress is required")
+			return
+		}
+		if _, exists := s.store.GetContact(name, req.EmailAddress); exists {
+			writeSESv2Error(w, "AlreadyExistsException", fmt.Sprintf("Contact already exists in list %s", name))
+			return
+		}
+		preferences, ok := sesV2TopicPreferences(w, list, req.TopicPreferences)
+		if !ok {
+			return
+		}
+		now := time.Now().UTC()
+		s.store.PutContact(name, types.Contact{
+			EmailAddress:     req.EmailAddress,
+			TopicPreferences: preferences,
+			UnsubscribeAll:   req.UnsubscribeAll,
+			AttributesData:   req.AttributesData,
+			CreatedAt:        now,
+			UpdatedAt:        now,
+		})
+		writeJSON(w, http.StatusOK, struct{}{})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// SESv2Contact handles GET/PUT/DELETE
+// /v2/email/contact-lists/{name}/contacts/{address}
+func (s *Server) SESv2Contact(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	address := r.PathValue("address")
+	list, ok := s.store.GetContactList(name)
+	if !ok {
+		writeSESv2ContactListNotFound(w, name)
+		return
+	}
+	contact, ok := s.store.GetContact(name, address)
+	if !ok {
+		writeSESv2Error(w, "NotFoundException", fmt.Sprintf("Contact %s does not exist in list %s", address, name))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		resp := sesV2ContactResponse(list, contact)
+		resp["ContactListName"] = list.Name
+		resp["AttributesData"] = contact.AttributesData
+		resp["CreatedTimestamp"] = epochSeconds(contact.CreatedAt)
+		writeJSON(w, http.StatusOK, resp)
+	case http.MethodPut:
+		var req sesV2ContactRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeSESv2Error(w, "BadRequestException", "Invalid JSON in request body")
+			return
+		}
+		preferences, ok := sesV2TopicPreferences(w, list, req.TopicPreferences)
+		if !ok {
+			return
+		}
+		contact.TopicPreferences = preferences
+		contact.UnsubscribeAll = req.UnsubscribeAll
+		contact.AttributesData = req.AttributesData
+		contact.UpdatedAt = time.Now().UTC()
+		s.store.PutContact(name, contact)
+		writeJSON(w, http.StatusOK, struct{}{})
+	case http.MethodDelete:
+		s.store.DeleteContact(name, address)
+		writeJSON(w, http.StatusOK, struct{}{})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// SESUnsubscribe handles GET/POST /ses/unsubscribe/{token}, the unsubscribe
+// link injected into emails sent with ListManagementOptions. GET shows a
+// confirmation page, POST is the RFC 8058 one-click unsubscribe.
+func (s *Server) SESUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	listName, topicName, address, ok := decodeUnsubscribeToken(r.PathValue("token"))
+	if !ok {
+		http.Error(w, "Invalid unsubscribe link", http.StatusBadRequest)
+		return
+	}
+	list, ok := s.store.GetContactList(listName)
+	if !ok {
+		http.Error(w, "Contact list not found", http.StatusNotFound)
+		return
+	}
+
+	now := time.Now().UTC()
+	contact, ok := s.store.GetContact(listName, address)
+	if !ok {
+		contact = types.Contact{EmailAddress: address, CreatedAt: now}
+	}
+	if topicName == "" {
+		contact.UnsubscribeAll = true
+	} else {
+		preferences := []types.TopicPreference{{TopicName: topicName, SubscriptionStatus: "OPT_OUT"}}
+		for _, p := range contact.TopicPreferences {
+			if p.TopicName != topicName {
+				preferences = append(preferences, p)
+			}
+		}
+		contact.TopicPreferences = preferences
+	}
+	contact.UpdatedAt = now
+	s.store.PutContact(listName, contact)
+
+	if r.Method == http.MethodPost {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	subject := list.Name
+	for _, t := range list.Topics {
+		if t.Name == topicName {
+			subject = t.DisplayName
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!DOCTYPE html><html><body><h1>Unsubscribed</h1><p>%s will no longer receive %s emails.</p></body></html>",
+		html.EscapeString(address), html.EscapeString(subject))
+}
+
+// applyListManagement validates ListManagementOptions and injects the
+// List-Unsubscribe headers and unsubscribe URL into the email. It fails if
+// the contact list or topic is unknown, or if the email has more than one
+// recipient, since the link unsubscribes a single address.
+func (s *Server) applyListManagement(email *types.Email, opts *sesListManagementOptions) *RequestError {
+	list, ok := s.store.GetContactList(opts.ContactListName)
+	if !ok {
+		return sesError("NotFoundException", fmt.Sprintf("List with name %s does not exist.", opts.ContactListName))
+	}
+	if opts.TopicName != "" && !hasTopic(list, opts.TopicName) {
+		return sesError("NotFoundException", fmt.Sprintf("Topic %s does not exist in list %s", opts.TopicName, list.Name))
+	}
+	recipients := append(append(append([]string{}, email.To...), email.CC...), email.BCC...)
+	if len(recipients) > 1 {
+		return sesError("BadRequestException", "ListManagementOptions can only be used with a single recipient")
+	}
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	url := config.PublicURL() + "/ses/unsubscribe/" + encodeUnsubscribeToken(list.Name, opts.TopicName, extractAddress(recipients[0]))
+	email.HTML = strings.ReplaceAll(email.HTML, sesUnsubscribePlaceholder, url)
+	email.Text = strings.ReplaceAll(email.Text, sesUnsubscribePlaceholder, url)
+	if email.Headers == nil {
+		email.Headers = map[string]string{}
+	}
+	email.Headers["List-Unsubscribe"] = "<" + url + ">"
+	email.Headers["List-Unsubscribe-Post"] = "List-Unsubscribe=One-Click"
+	return nil
+}
+
+func (s *Server) listContacts(w http.ResponseWriter, r *http.Request, list types.ContactList) {
+	var req sesV2ListContactsRequest
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeSESv2Error(w, "BadRequestException", "Invalid JSON in request body")
+			return
+		}
+	} else {
+		req.PageSize = r.URL.Query().Get("PageSize")
+		req.NextToken = r.URL.Query().Get("NextToken")
+	}
+
+	all, _ := s.store.GetContacts(list.Name)
+	var contacts []types.Contact
+	for _, contact := range all {
+		if req.Filter == nil || req.Filter.FilteredStatus == "" {
+			contacts = append(contacts, contact)
+			continue
+		}
+		topic, useDefault := "", false
+		if req.Filter.TopicFilter != nil {
+			topic = req.Filter.TopicFilter.TopicName
+			useDefault = req.Filter.TopicFilter.UseDefaultIfPreferenceUnavailable
+		}
+		if contactMatchesStatus(list, contact, topic, useDefault, req.Filter.FilteredStatus) {
+			contacts = append(contacts, contact)
+		}
+	}
+
+	start, end, next, ok := pageBounds(len(contacts), req.NextToken, req.PageSize, 1000)
+	if !ok {
+		writeSESv2Error(w, "BadRequestException", "Invalid NextToken or PageSize")
+		return
+	}
+
+	summaries := []map[string]interface{}{}
+	for _, contact := range contacts[start:end] {
+		summaries = append(summaries, sesV2ContactResponse(list, contact))
+	}
+	resp := map[string]interface{}{"Contacts": summaries}
+	if next != "" {
+		resp["NextToken"] = next
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// contactMatchesStatus reports whether a contact's subscription status for a
+// topic (or for the list as a whole when topic is empty) equals status
+func contactMatchesStatus(list types.ContactList, contact types.Contact, topic string, useDefault bool, status string) bool {
+	if contact.UnsubscribeAll {
+		return status == "OPT_OUT"
+	}
+	if topic == "" {
+		for _, p := range contact.TopicPreferences {
+			if p.SubscriptionStatus == status {
+				return true
+			}
+		}
+		return status == "OPT_IN"
+	}
+	for _, p := range contact.TopicPreferences {
+		if p.TopicName == topic {
+			return p.SubscriptionStatus == status
+		}
+	}
+	if !useDefault {
+		return false
+	}
+	for _, t := range list.Topics {
+		if t.Name == topic {
+			return t.DefaultSubscriptionStatus == status
+		}
+	}
+	return false
+}
+
+func sesV2ContactResponse(list types.ContactList, contact types.Contact) map[string]interface{} {
+	preferences := []sesV2TopicPreference{}
+	explicit := map[string]bool{}
+	for _, p := range contact.TopicPreferences {
+		preferences = append(preferences, sesV2TopicPreference{TopicName: p.TopicName, SubscriptionStatus: p.SubscriptionStatus})
+		explicit[p.TopicName] = true
+	}
+	defaults := []sesV2TopicPreference{}
+	for _, t := range list.Topics {
+		if !explicit[t.Name] {
+			defaults = append(defaults, sesV2TopicPreference{TopicName: t.Name, SubscriptionStatus: t.DefaultSubscriptionStatus})
+		}
+	}
+	return map[string]interface{}{
+		"EmailAddress":            contact.EmailAddress,
+		"TopicPreferences":        preferences,
+		"TopicDefaultPreferences": defaults,
+		"UnsubscribeAll":          contact.UnsubscribeAll,
+		"LastUpdatedTimestamp":    epochSeconds(contact.UpdatedAt),
+	}
+}
+
+func sesV2Topics(w http.ResponseWriter, topics []sesV2Topic) ([]types.Topic, bool) {
+	var result []types.Topic
+	for _, t := range topics {
+		if t.TopicName == "" || t.DisplayName == "" {
+			writeSESv2Error(w, "BadRequestException", "TopicName and DisplayName are required")
+			return nil, false
+		}
+		if !isSubscriptionStatus(t.DefaultSubscriptionStatus) {
+			writeSESv2Error(w, "BadRequestException", "DefaultSubscriptionStatus must be OPT_IN or OPT_OUT")
+			return nil, false
+		}
+		result = append(result, types.Topic{
+			Name:                      t.TopicName,
+			DisplayName:               t.DisplayName,
+			Description:               t.Description,
+			DefaultSubscriptionStatus: t.DefaultSubscriptionStatus,
+		})
+	}
+	return result, true
+}
+
+func sesV2TopicPreferences(w http.ResponseWriter, list types.ContactList, preferences []sesV2TopicPreference) ([]types.TopicPreference, bool) {
+	var result []types.TopicPreference
+	for _, p := range preferences {
+		if !hasTopic(list, p.TopicName) {
+			writeSESv2Error(w, "NotFoundException", fmt.Sprintf("Topic %s does not exist in list %s", p.TopicName, list.Name))
+			return nil, false
+		}
+		if !isSubscriptionStatus(p.SubscriptionStatus) {
+			writeSESv2Error(w, "BadRequestException", "SubscriptionStatus must be OPT_IN or OPT_OUT")
+			return nil, false
+		}
+		result = append(result, types.TopicPreference{TopicName: p.TopicName, SubscriptionStatus: p.SubscriptionStatus})
+	}
+	return result, true
+}
+
+func writeSESv2ContactListNotFound(w http.ResponseWriter, name string) {
+	writeSESv2Error(w, "NotFoundException", fmt.Sprintf("List with name %s does not exist.", name))
+}
+
+func hasTopic(list types.ContactList, name string) bool {
+	for _, t := range list.Topics {
+		if t.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isSubscriptionStatus(s string) bool {
+	return s == "OPT_IN" || s == "OPT_OUT"
+}
+
+// encodeUnsubscribeToken packs the contact list, topic and address an
+// unsubscribe link applies to
+func encodeUnsubscribeToken(listName, topicName, address string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(listName + "\n" + topicName + "\n" + address))
+}
+
+func decodeUnsubscribeToken(token string) (listName, topicName, address string, ok bool) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", "", "", false
+	}
+	parts := strings.SplitN(string(data), "\n", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+		return "", "", "", false
+	}
+	return parts[0], parts[1], parts[2], true
+}
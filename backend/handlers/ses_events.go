@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/appaka/resendpit/sns"
+	"github.com/appaka/resendpit/types"
+	"github.com/google/uuid"
+)
+
+// sesRegion is the AWS region used in emulated ARNs and event payloads
+const sesRegion = "us-east-1"
+
+// sesEventType describes one SES event type in its three spellings: the
+// SES v2 API enum, the SES v1 API enum and the published event payload
+type sesEventType struct {
+	v2      string
+	v1      string
+	payload string
+}
+
+var sesEventTypes = []sesEventType{
+	{"SEND", "send", "Send"},
+	{"REJECT", "reject", "Reject"},
+	{"BOUNCE", "bounce", "Bounce"},
+	{"COMPLAINT", "complaint", "Complaint"},
+	{"DELIVERY", "delivery", "Delivery"},
+	{"OPEN", "open", "Open"},
+	{"CLICK", "click", "Click"},
+	{"RENDERING_FAILURE", "renderingFailure", "Rendering Failure"},
+	{"DELIVERY_DELAY", "deliveryDelay", "DeliveryDelay"},
+	{"SUBSCRIPTION", "subscription", "Subscription"},
+}
+
+// sesEventTypeFromV1 converts a v1 event type ("send") to its v2 spelling ("SEND")
+func sesEventTypeFromV1(v1 string) (string, bool) {
+	for _, t := range sesEventTypes {
+		if t.v1 == v1 {
+			return t.v2, true
+		}
+	}
+	return "", false
+}
+
+// sesEventTypeToV1 converts a v2 event type ("SEND") to its v1 spelling ("send")
+func sesEventTypeToV1(v2 string) string {
+	for _, t := range sesEventTypes {
+		if t.v2 == v2 {
+			return t.v1
+		}
+	}
+	return v2
+}
+
+func isSESEventTypeV2(v2 string) bool {
+	for _, t := range sesEventTypes {
+		if t.v2 == v2 {
+			return true
+		}
+	}
+	return false
+}
+
+// SES event publishing payload types
+
+type sesEvent struct {
+	EventType string         `json:"eventType"`
+	Mail      sesEventMail   `json:"mail"`
+	Send      *struct{}      `json:"send,omitempty"`
+	Delivery  *sesDelivery   `json:"delivery,omitempty"`
+	Bounce    *sesBounce     `json:"bounce,omitempty"`
+	Complaint *sesComplaint  `json:"complaint,omitempty"`
+	Open      *sesEngagement `json:"open,omitempty"`
+	Click     *sesEngagement `json:"click,omitempty"`
+}
+
+type sesEventMail struct {
+	Timestamp        string              `json:"timestamp"`
+	Source           string              `json:"source"`
+	SourceArn        string              `json:"sourceArn"`
+	SendingAccountID string              `json:"sendingAccountId"`
+	MessageID        string              `json:"messageId"`
+	Destination      []string            `json:"destination"`
+	HeadersTruncated bool                `json:"headersTruncated"`
+	Headers          []sesEventHeader    `json:"headers"`
+	CommonHeaders    sesCommonHeaders    `json:"commonHeaders"`
+	Tags             map[string][]string `json:"tags"`
+}
+
+type sesEventHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type sesCommonHeaders struct {
+	From      []string `json:"from"`
+	To        []string `json:"to"`
+	Cc        []string `json:"cc,omitempty"`
+	MessageID string   `json:"messageId"`
+	Subject   string   `json:"subject"`
+}
+
+type sesDelivery struct {
+	Timestamp            string   `json:"timestamp"`
+	ProcessingTimeMillis int      `json:"processingTimeMillis"`
+	Recipients           []string `json:"recipients"`
+	SMTPResponse         string   `json:"smtpResponse"`
+	ReportingMTA         string   `json:"reportingMTA"`
+}
+
+type sesBounce struct {
+	BounceType        string                `json:"bounceType"`
+	BounceSubType     string                `json:"bounceSubType"`
+	BouncedRecipients []sesBouncedRecipient `json:"bouncedRecipients"`
+	Timestamp         string                `json:"timestamp"`
+	FeedbackID        string                `json:"feedbackId"`
+	ReportingMTA      string                `json:"reportingMTA"`
+}
+
+type sesBouncedRecipient struct {
+	EmailAddress   string `json:"emailAddress"`
+	Action         string `json:"action"`
+	Status         string `json:"status"`
+	DiagnosticCode string `json:"diagnosticCode"`
+}
+
+type sesComplaint struct {
+	ComplainedRecipients  []sesComplainedRecipient `json:"complainedRecipients"`
+	Timestamp             string                   `json:"timestamp"`
+	FeedbackID            string                   `json:"feedbackId"`
+	UserAgent             string                   `json:"userAgent"`
+	ComplaintFeedbackType string                   `json:"complaintFeedbackType"`
+	ArrivalDate           string                   `json:"arrivalDate"`
+}
+
+type sesComplainedRecipient struct {
+	EmailAddress string `json:"emailAddress"`
+}
+
+type sesEngagement struct {
+	Timestamp string              `json:"timestamp"`
+	IPAddress string              `json:"ipAddress"`
+	UserAgent string              `json:"userAgent"`
+	Link      string              `json:"link,omitempty"`
+	LinkTags  map[string][]string `json:"linkTags,omitempty"`
+}
+
+// publishSESSendEvents publishes the Send event for a captured SES email,
+// followed by the Delivery, Bounce and Complaint events its recipients
+// produce under the mailbox simulator and the account suppression list
+func (s *Server) publishSESSendEvents(email types.Email) {
+	if email.ConfigurationSet == "" || !sns.Enabled() {
+		return
+	}
+
+	now := sesTimestamp(time.Now())
+	mail := newSESEventMail(email)
+
+	events := []sesEvent{{EventType: "Send", Mail: mail, Send: &struct{}{}}}
+
+	var delivered, complained []string
+	bounced := map[string][]sesBouncedRecipient{}
+	for _, addr := range mail.Destination {
+		switch sesRecipientOutcome(email, addr) {
+		case sesOutcomeBounce:
+			bounced["General"] = append(bounced["General"], sesBouncedRecipient{
+				EmailAddress:   addr,
+				Action:         "failed",
+				Status:         "5.1.1",
+				DiagnosticCode: "smtp; 550 5.1.1 user unknown",
+			})
+		case sesOutcomeSuppressed:
+			bounced["Suppressed"] = append(bounced["Suppressed"], sesBouncedRecipient{
+				EmailAddress:   addr,
+				Action:         "failed",
+				Status:         "5.1.1",
+				DiagnosticCode: "Amazon SES has suppressed sending to this address because it has a recent history of bouncing as an invalid address.",
+			})
+		case sesOutcomeAccountSuppressed:
+			bounced["OnAccountSuppressionList"] = append(bounced["OnAccountSuppressionList"], sesBouncedRecipient{
+				EmailAddress:   addr,
+				Action:         "failed",
+				Status:         "5.1.1",
+				DiagnosticCode: "Amazon SES did not send the message to this address because it is on the suppression list for your account.",
+			})
+		case sesOutcomeComplaint:
+			delivered = append(delivered, addr)
+			complained = append(complained, addr)
+		default:
+			delivered = append(delivered, addr)
+		}
+	}
+
+	if len(delivered) > 0 {
+		events = append(events, sesEvent{EventType: "Delivery", Mail: mail, Delivery: &sesDelivery{
+			Timestamp:            now,
+			ProcessingTimeMillis: 1,
+			Recipients:           delivered,
+			SMTPResponse:         "250 2.6.0 Message received",
+			ReportingMTA:         "a8-1.smtp-out.amazonses.com",
+		}})
+	}
+	for _, subType := range []string{"General", "Suppressed", "OnAccountSuppressionList"} {
+		if len(bounced[subType]) == 0 {
+			continue
+		}
+		events = append(events, sesEvent{EventType: "Bounce", Mail: mail, Bounce: &sesBounce{
+			BounceType:        "Permanent",
+			BounceSubType:     subType,
+			BouncedRecipients: bounced[subType],
+			Timestamp:         now,
+			FeedbackID:        uuid.NewString(),
+			ReportingMTA:      "dns; amazonses.com",
+		}})
+	}
+	if len(complained) > 0 {
+		var recipients []sesComplainedRecipient
+		for _, addr := range complained {
+			recipients = append(recipients, sesComplainedRecipient{EmailAddress: addr})
+		}
+		events = append(events, sesEvent{EventType: "Complaint", Mail: mail, Complaint: &sesComplaint{
+			ComplainedRecipients:  recipients,
+			Timestamp:             now,
+			FeedbackID:            uuid.NewString(),
+			UserAgent:             "Amazon SES Mailbox Simulator",
+			ComplaintFeedbackType: "abuse",
+			ArrivalDate:           now,
+		}})
+	}
+
+	for _, event := range events {
+		s.publishSESEvent(email.ConfigurationSet, event)
+	}
+}
+
+// publishSESEngagementEvent publishes an Open or Click event for a captured
+// SES email
+func (s *Server) publishSESEngagementEvent(email types.Email, eventType, link, userAgent string) {
+	if email.ConfigurationSet == "" || !sns.Enabled() {
+		return
+	}
+
+	engagement := &sesEngagement{
+		Timestamp: sesTimestamp(time.Now()),
+		IPAddress: "127.0.0.1",
+		UserAgent: userAgent,
+	}
+	event := sesEvent{EventType: eventType, Mail: newSESEventMail(email)}
+	if eventType == "Click" {
+		engagement.Link = link
+		engagement.LinkTags = map[string][]string{}
+		event.Click = engagement
+	} else {
+		event.Open = engagement
+	}
+
+	s.publishSESEvent(email.ConfigurationSet, event)
+}
+
+// publishSESEvent sends an event to every enabled SNS event destination of
+// the configuration set that matches its type
+func (s *Server) publishSESEvent(setName string, event sesEvent) {
+	set, ok := s.store.GetConfigurationSet(setName)
+	if !ok {
+		return
+	}
+
+	var eventType string
+	for _, t := range sesEventTypes {
+		if t.payload == event.EventType {
+			eventType = t.v2
+		}
+	}
+
+	payload, _ := json.Marshal(event)
+	for _, dest := range set.EventDestinations {
+		if !dest.Enabled || dest.SNSTopicArn == "" || !containsString(dest.MatchingEventTypes, eventType) {
+			continue
+		}
+		sns.Publish(dest.SNSTopicArn, string(payload))
+	}
+}
+
+func newSESEventMail(email types.Email) sesEventMail {
+	var destination []string
+	destination = append(destination, email.To...)
+	destination = append(destination, email.CC...)
+	destination = append(destination, email.BCC...)
+
+	from := extractAddress(email.From)
+	domain := from
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = from[at+1:]
+	}
+
+	tags := map[string][]string{
+		"ses:configuration-set": {email.ConfigurationSet},
+		"ses:source-ip":         {"127.0.0.1"},
+		"ses:from-domain":       {domain},
+		"ses:caller-identity":   {"resendpit"},
+	}
+	for _, tag := range email.Tags {
+		tags[tag.Name] = []string{tag.Value}
+	}
+
+	headers := []sesEventHeader{
+		{Name: "From", Value: email.From},
+		{Name: "To", Value: strings.Join(email.To, ", ")},
+	}
+	if len(email.CC) > 0 {
+		headers = append(headers, sesEventHeader{Name: "Cc", Value: strings.Join(email.CC, ", ")})
+	}
+	headers = append(headers, sesEventHeader{Name: "Subject", Value: email.Subject})
+
+	return sesEventMail{
+		Timestamp:        sesTimestamp(email.CreatedAt),
+		Source:           email.From,
+		SourceArn:        "arn:aws:ses:" + sesRegion + ":" + sns.AccountID + ":identity/" + domain,
+		SendingAccountID: sns.AccountID,
+		MessageID:        email.ID,
+		Destination:      destination,
+		Headers:          headers,
+		CommonHeaders: sesCommonHeaders{
+			From:      []string{email.From},
+			To:        email.To,
+			Cc:        email.CC,
+			MessageID: email.ID,
+			Subject:   email.Subject,
+		},
+		Tags: tags,
+	}
+}
+
+func sesTimestamp(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/appaka/resendpit/types"
+	"github.com/google/uuid"
+)
+
+// SES identity types, as used by ListIdentities and SES v2 email identities
+const (
+	identityTypeEmail  = "EmailAddress"
+	identityTypeDomain = "Domain"
+)
+
+// sesMaxListIdentities is the SES upper bound for ListIdentities MaxItems
+const sesMaxListIdentities = 1000
+
+// SES v1 identity result types
+
+type verifyEmailIdentityResult struct {
+	XMLName xml.Name `xml:"VerifyEmailIdentityResult"`
+}
+
+type verifyDomainIdentityResult struct {
+	XMLName           xml.Name `xml:"VerifyDomainIdentityResult"`
+	VerificationToken string   `xml:"VerificationToken"`
+}
+
+type listIdentitiesResult struct {
+	XMLName    xml.Name `xml:"ListIdentitiesResult"`
+	Identities []string `xml:"Identities>member"`
+	NextToken  string   `xml:"NextToken,omitempty"`
+}
+
+type getIdentityVerificationAttributesResult struct {
+	XMLName                xml.Name                        `xml:"GetIdentityVerificationAttributesResult"`
+	VerificationAttributes []identityVerificationAttribute `xml:"VerificationAttributes>entry"`
+}
+
+type identityVerificationAttribute struct {
+	Key   string                     `xml:"key"`
+	Value identityVerificationStatus `xml:"value"`
+}
+
+type identityVerificationStatus struct {
+	VerificationStatus string `xml:"VerificationStatus"`
+	VerificationToken  string `xml:"VerificationToken,omitempty"`
+}
+
+func (s *Server) handleVerifyEmailIdentity(w http.ResponseWriter, form url.Values) {
+	address := form.Get("EmailAddress")
+	if address == "" {
+		writeSESv1Error(w, "ValidationError", "EmailAddress is required")
+		return
+	}
+
+	s.store.AddIdentity(newIdentity(address, identityTypeEmail))
+
+	writeSESv1Result(w, "VerifyEmailIdentity", verifyEmailIdentityResult{})
+}
+
+func (s *Server) handleVerifyDomainIdentity(w http.ResponseWriter, form url.Values) {
+	domain := strings.ToLower(form.Get("Domain"))
+	if domain == "" {
+		writeSESv1Error(w, "ValidationError", "Domain is required")
+		return
+	}
+
+	identity := s.store.AddIdentity(newIdentity(domain, identityTypeDomain))
+
+	writeSESv1Result(w, "VerifyDomainIdentity", verifyDomainIdentityResult{
+		VerificationToken: identity.VerificationToken,
+	})
+}
+
+func (s *Server) handleListIdentities(w http.ResponseWriter, form url.Values) {
+	identityType := form.Get("IdentityType")
+	if identityType != "" && identityType != identityTypeEmail && identityType != identityTypeDomain {
+		writeSESv1Error(w, "ValidationError", "IdentityType must be EmailAddress or Domain")
+		return
+	}
+
+	var names []string
+	for _, identity := range s.store.GetIdentities() {
+		if identityType == "" || identity.Type == identityType {
+			names = append(names, identity.Identity)
+		}
+	}
+
+	start, end, next, ok := pageBounds(len(names), form.Get("NextToken"), form.Get("MaxItems"), sesMaxListIdentities)
+	if !ok {
+		writeSESv1Error(w, "InvalidParameterValue", "Invalid NextToken or MaxItems")
+		return
+	}
+
+	result := listIdentitiesResult{Identities: []string{}, NextToken: next}
+	result.Identities = append(result.Identities, names[start:end]...)
+
+	writeSESv1Result(w, "ListIdentities", result)
+}
+
+func (s *Server) handleGetIdentityVerificationAttributes(w http.ResponseWriter, form url.Values) {
+	names := extractIndexedFormValues(form, "Identities.member.")
+
+	result := getIdentityVerificationAttributesResult{}
+	for _, name := range names {
+		identity, ok := s.store.GetIdentity(name)
+		if !ok {
+			// SES omits identities it doesn't know about
+			continue
+		}
+		result.VerificationAttributes = append(result.VerificationAttributes, identityVerificationAttribute{
+			Key: identity.Identity,
+			Value: identityVerificationStatus{
+				VerificationStatus: identity.VerificationStatus,
+				VerificationToken:  identity.VerificationToken,
+			},
+		})
+	}
+
+	writeSESv1Result(w, "GetIdentityVerificationAttributes", result)
+}
+
+// newIdentity creates an identity that is verified immediately, since there
+// is no DNS or mailbox to check against locally
+func newIdentity(name, identityType string) types.Identity {
+	identity := types.Identity{
+		Identity:           name,
+		Type:               identityType,
+		VerificationStatus: "Success",
+		CreatedAt:          time.Now().UTC(),
+	}
+	if identityType == identityTypeDomain {
+		identity.VerificationToken = strings.ReplaceAll(uuid.NewString(), "-", "")
+	}
+	return identity
+}
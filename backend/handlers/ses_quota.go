@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// Sending limits reported by GetSendQuota, mirroring a typical production SES
+// account
+const (
+	sesMax24HourSend = 50000
+	sesMaxSendRate   = 14
+)
+
+// sesMaxMessageSize is the largest message SES accepts (10 MB)
+const sesMaxMessageSize = 10 * 1024 * 1024
+
+// sesMessageTooLargeMessage is the error SES returns for a message over
+// sesMaxMessageSize
+const sesMessageTooLargeMessage = "Message length is more than 10485760 bytes long"
+
+// GetSendStatistics covers the last two weeks in 15-minute data points
+const (
+	sesStatsPeriod   = 14 * 24 * time.Hour
+	sesStatsInterval = 15 * time.Minute
+)
+
+// SES v1 quota result types
+
+type getSendQuotaResult struct {
+	XMLName         xml.Name `xml:"GetSendQuotaResult"`
+	Max24HourSend   float64  `xml:"Max24HourSend"`
+	MaxSendRate     float64  `xml:"MaxSendRate"`
+	SentLast24Hours float64  `xml:"SentLast24Hours"`
+}
+
+type getSendStatisticsResult struct {
+	XMLName        xml.Name        `xml:"GetSendStatisticsResult"`
+	SendDataPoints []sendDataPoint `xml:"SendDataPoints>member"`
+}
+
+type sendDataPoint struct {
+	Timestamp        time.Time `xml:"Timestamp"`
+	DeliveryAttempts int       `xml:"DeliveryAttempts"`
+	Bounces          int       `xml:"Bounces"`
+	Complaints       int       `xml:"Complaints"`
+	Rejects          int       `xml:"Rejects"`
+}
+
+func (s *Server) handleGetSendQuota(w http.ResponseWriter, form url.Values) {
+	cutoff := time.Now().UTC().Add(-24 * time.Hour)
+
+	sent := 0
+	for _, email := range s.store.GetEmails() {
+		if email.Provider == "ses" && email.CreatedAt.After(cutoff) {
+			sent += len(email.To) + len(email.CC) + len(email.BCC)
+		}
+	}
+
+	writeSESv1Result(w, "GetSendQuota", getSendQuotaResult{
+		Max24HourSend:   float64(sesMax24HourSend),
+		MaxSendRate:     float64(sesMaxSendRate),
+		SentLast24Hours: float64(sent),
+	})
+}
+
+func (s *Server) handleGetSendStatistics(w http.ResponseWriter, form url.Values) {
+	points := map[time.Time]*sendDataPoint{}
+	point := func(t time.Time) *sendDataPoint {
+		bucket := t.UTC().Truncate(sesStatsInterval)
+		p, ok := points[bucket]
+		if !ok {
+			p = &sendDataPoint{Timestamp: bucket}
+			points[bucket] = p
+		}
+		return p
+	}
+
+	cutoff := time.Now().UTC().Add(-sesStatsPeriod)
+	for _, email := range s.store.GetEmails() {
+		if email.Provider != "ses" || email.CreatedAt.Before(cutoff) {
+			continue
+		}
+		p := point(email.CreatedAt)
+		for _, group := range [][]string{email.To, email.CC, email.BCC} {
+			for _, addr := range group {
+				p.DeliveryAttempts++
+				switch sesRecipientOutcome(email, addr) {
+				case sesOutcomeBounce, sesOutcomeSuppressed, sesOutcomeAccountSuppressed:
+					p.Bounces++
+				case sesOutcomeComplaint:
+					p.Complaints++
+				}
+			}
+		}
+	}
+	for _, t := range s.store.GetSESRejects() {
+		point(t).Rejects++
+	}
+
+	result := getSendStatisticsResult{SendDataPoints: make([]sendDataPoint, 0, len(points))}
+	for _, p := range points {
+		result.SendDataPoints = append(result.SendDataPoints, *p)
+	}
+	sort.Slice(result.SendDataPoints, func(i, j int) bool {
+		return result.SendDataPoints[i].Timestamp.Before(result.SendDataPoints[j].Timestamp)
+	})
+
+	writeSESv1Result(w, "GetSendStatistics", result)
+}
+
+// sesMessageTooLarge reports whether a message exceeds the SES size limit,
+// recording the reject for GetSendStatistics
+func (s *Server) sesMessageTooLarge(size int) bool {
+	if size <= sesMaxMessageSize {
+		return false
+	}
+	s.store.RecordSESReject(time.Now().UTC())
+	return true
+}
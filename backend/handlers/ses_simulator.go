@@ -0,0 +1,52 @@
+package handlers
+
+import "strings"
+
+// SES mailbox simulator outcomes
+const (
+	sesOutcomeDelivery   = "delivery"
+	sesOutcomeBounce     = "bounce"
+	sesOutcomeComplaint  = "complaint"
+	sesOutcomeSuppressed = "suppressed"
+
+	// sesOutcomeAccountSuppressed is used for recipients on the account-level
+	// suppression list rather than the simulator's global one
+	sesOutcomeAccountSuppressed = "account-suppressed"
+)
+
+const sesSimulatorDomain = "simulator.amazonses.com"
+
+// sesSimulatorOutcome returns the simulated delivery outcome for a recipient,
+// following the Amazon SES mailbox simulator addresses (e.g.
+// bounce@simulator.amazonses.com or bounce+label@simulator.amazonses.com).
+// Any other address is delivered.
+func sesSimulatorOutcome(address string) string {
+	addr := strings.ToLower(extractAddress(address))
+	at := strings.LastIndex(addr, "@")
+	if at < 0 || addr[at+1:] != sesSimulatorDomain {
+		return sesOutcomeDelivery
+	}
+	local := addr[:at]
+	if plus := strings.Index(local, "+"); plus >= 0 {
+		local = local[:plus]
+	}
+	switch local {
+	case "bounce":
+		return sesOutcomeBounce
+	case "complaint":
+		return sesOutcomeComplaint
+	case "suppressionlist":
+		return sesOutcomeSuppressed
+	}
+	return sesOutcomeDelivery
+}
+
+// extractAddress returns the bare address from a "Name <addr>" string
+func extractAddress(s string) string {
+	if start := strings.LastIndex(s, "<"); start >= 0 {
+		if end := strings.Index(s[start:], ">"); end > 0 {
+			return strings.TrimSpace(s[start+1 : start+end])
+		}
+	}
+	return strings.TrimSpace(s)
+}
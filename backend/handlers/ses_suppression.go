@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/appaka/resendpit/types"
+	"github.com/google/uuid"
+)
+
+// SES v2 suppression list request/response types
+
+type sesV2PutSuppressedDestinationRequest struct {
+	EmailAddress string `json:"EmailAddress"`
+	Reason       string `json:"Reason"`
+}
+
+type sesV2SuppressedDestinationSummary struct {
+	EmailAddress   string  `json:"EmailAddress"`
+	Reason         string  `json:"Reason"`
+	LastUpdateTime float64 `json:"LastUpdateTime"`
+}
+
+type sesV2SuppressedDestination struct {
+	EmailAddress   string                                `json:"EmailAddress"`
+	Reason         string                                `json:"Reason"`
+	LastUpdateTime float64                               `json:"LastUpdateTime"`
+	Attributes     *sesV2SuppressedDestinationAttributes `json:"Attributes,omitempty"`
+}
+
+type sesV2SuppressedDestinationAttributes struct {
+	MessageId  string `json:"MessageId,omitempty"`
+	FeedbackId string `json:"FeedbackId,omitempty"`
+}
+
+// captureSESEmail stores an email sent through SES. Recipients on the account
+// suppression list are marked as suppressed, simulated hard bounces are added
+// to the list, and the resulting events are published.
+func (s *Server) captureSESEmail(email types.Email) {
+	for _, group := range [][]string{email.To, email.CC, email.BCC} {
+		for _, addr := range group {
+			if _, ok := s.store.GetSuppressedDestination(extractAddress(addr)); ok {
+				email.SuppressedRecipients = append(email.SuppressedRecipients, addr)
+			}
+		}
+	}
+
+	s.store.AddEmail(email)
+
+	for _, group := range [][]string{email.To, email.CC, email.BCC} {
+		for _, addr := range group {
+			if sesRecipientOutcome(email, addr) == sesOutcomeBounce {
+				s.store.PutSuppressedDestination(types.SuppressedDestination{
+					EmailAddress:   extractAddress(addr),
+					Reason:         "BOUNCE",
+					LastUpdateTime: time.Now().UTC(),
+					MessageID:      email.ID,
+					FeedbackID:     uuid.NewString(),
+				})
+			}
+		}
+	}
+
+	s.publishSESSendEvents(email)
+}
+
+// sesRecipientOutcome returns the simulated delivery outcome for a recipient
+// of a captured email
+func sesRecipientOutcome(email types.Email, addr string) string {
+	if containsString(email.SuppressedRecipients, addr) {
+		return sesOutcomeAccountSuppressed
+	}
+	return sesSimulatorOutcome(addr)
+}
+
+// SESv2SuppressedDestinations handles GET/PUT /v2/email/suppression/addresses
+func (s *Server) SESv2SuppressedDestinations(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listSuppressedDestinations(w, r)
+	case http.MethodPut:
+		var req sesV2PutSuppressedDestinationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeSESv2Error(w, "BadRequestException", "Invalid JSON in request body")
+			return
+		}
+		if req.EmailAddress == "" {
+			writeSESv2Error(w, "BadRequestException", "EmailAddress is required")
+			return
+		}
+		if req.Reason != "BOUNCE" && req.Reason != "COMPLAINT" {
+			writeSESv2Error(w, "BadRequestException", "Reason must be BOUNCE or COMPLAINT")
+			return
+		}
+		s.store.PutSuppressedDestination(types.SuppressedDestination{
+			EmailAddress:   req.EmailAddress,
+			Reason:         req.Reason,
+			LastUpdateTime: time.Now().UTC(),
+		})
+		writeJSON(w, http.StatusOK, struct{}{})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// SESv2SuppressedDestination handles GET/DELETE
+// /v2/email/suppression/addresses/{address}
+func (s *Server) SESv2SuppressedDestination(w http.ResponseWriter, r *http.Request) {
+	address := r.PathValue("address")
+	switch r.Method {
+	case http.MethodGet:
+		dest, ok := s.store.GetSuppressedDestination(address)
+		if !ok {
+			writeSESv2SuppressedDestinationNotFound(w, address)
+			return
+		}
+		resp := sesV2SuppressedDestination{
+			EmailAddress:   dest.EmailAddress,
+			Reason:         dest.Reason,
+			LastUpdateTime: epochSeconds(dest.LastUpdateTime),
+		}
+		if dest.MessageID != "" || dest.FeedbackID != "" {
+			resp.Attributes = &sesV2SuppressedDestinationAttributes{MessageId: dest.MessageID, FeedbackId: dest.FeedbackID}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"SuppressedDestination": resp})
+	case http.MethodDelete:
+		if !s.store.DeleteSuppressedDestination(address) {
+			writeSESv2SuppressedDestinationNotFound(w, address)
+			return
+		}
+		writeJSON(w, http.StatusOK, struct{}{})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) listSuppressedDestinations(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var start, end time.Time
+	for _, param := range []struct {
+		name string
+		dst  *time.Time
+	}{{"StartDate", &start}, {"EndDate", &end}} {
+		if v := query.Get(param.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeSESv2Error(w, "BadRequestException", fmt.Sprintf("Invalid %s", param.name))
+				return
+			}
+			*param.dst = t
+		}
+	}
+
+	var matches []types.SuppressedDestination
+	for _, dest := range s.store.GetSuppressedDestinations() {
+		if reasons := query["Reason"]; len(reasons) > 0 && !containsString(reasons, dest.Reason) {
+			continue
+		}
+		if !start.IsZero() && dest.LastUpdateTime.Before(start) {
+			continue
+		}
+		if !end.IsZero() && dest.LastUpdateTime.After(end) {
+			continue
+		}
+		matches = append(matches, dest)
+	}
+
+	first, last, next, ok := pageBounds(len(matches), query.Get("NextToken"), query.Get("PageSize"), 1000)
+	if !ok {
+		writeSESv2Error(w, "BadRequestException", "Invalid NextToken or PageSize")
+		return
+	}
+
+	summaries := []sesV2SuppressedDestinationSummary{}
+	for _, dest := range matches[first:last] {
+		summaries = append(summaries, sesV2SuppressedDestinationSummary{
+			EmailAddress:   dest.EmailAddress,
+			Reason:         dest.Reason,
+			LastUpdateTime: epochSeconds(dest.LastUpdateTime),
+		})
+	}
+
+	resp := map[string]interface{}{"SuppressedDestinationSummaries": summaries}
+	if next != "" {
+		resp["NextToken"] = next
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func writeSESv2SuppressedDestinationNotFound(w http.ResponseWriter, address string) {
+	writeSESv2Error(w, "NotFoundException", fmt.Sprintf("Email address %s does not exist on your suppression list.", address))
+}
+
+// epochSeconds formats a time the way SES v2 JSON timestamps are encoded
+func epochSeconds(t time.Time) float64 {
+	return float64(t.UnixMilli()) / 1000
+}
@@ -1,104 +1,261 @@
 package handlers
 
 import (
+	"encoding/base64"
+	"encoding/xml"
 	"fmt"
 	"net/http"
 	"net/url"
-	"time"
+	"strings"
+	"unicode/utf8"
 
-	"github.com/appaka/resendpit/store"
 	"github.com/appaka/resendpit/types"
-	"github.com/google/uuid"
 )
 
-// PostSESv1Email handles POST / with form-encoded SES v1 API requests
-func PostSESv1Email(w http.ResponseWriter, r *http.Request) {
+// SES v1 send result types
+
+type sendEmailResult struct {
+	XMLName   xml.Name `xml:"SendEmailResult"`
+	MessageId string   `xml:"MessageId"`
+}
+
+type sendRawEmailResult struct {
+	XMLName   xml.Name `xml:"SendRawEmailResult"`
+	MessageId string   `xml:"MessageId"`
+}
+
+// PostSESv1Email handles POST / with form-encoded SES v1 API requests other
+// than sends
+func (s *Server) PostSESv1Email(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm(); err != nil {
-		writeSESv1Error(w, http.StatusBadRequest, "InvalidParameterValue", "Failed to parse form body")
+		writeSESv1Error(w, "InvalidParameterValue", "Failed to parse form body")
 		return
 	}
 
 	action := r.FormValue("Action")
 	switch action {
-	case "SendEmail":
-		handleSendEmail(w, r.Form)
-	case "SendRawEmail":
-		handleSendRawEmail(w, r.Form)
+	case "VerifyEmailIdentity":
+		s.handleVerifyEmailIdentity(w, r.Form)
+	case "VerifyDomainIdentity":
+		s.handleVerifyDomainIdentity(w, r.Form)
+	case "ListIdentities":
+		s.handleListIdentities(w, r.Form)
+	case "GetIdentityVerificationAttributes":
+		s.handleGetIdentityVerificationAttributes(w, r.Form)
+	case "GetSendQuota":
+		s.handleGetSendQuota(w, r.Form)
+	case "GetSendStatistics":
+		s.handleGetSendStatistics(w, r.Form)
+	case "CreateConfigurationSet":
+		s.handleCreateConfigurationSet(w, r.Form)
+	case "DeleteConfigurationSet":
+		s.handleDeleteConfigurationSet(w, r.Form)
+	case "DescribeConfigurationSet":
+		s.handleDescribeConfigurationSet(w, r.Form)
+	case "ListConfigurationSets":
+		s.handleListConfigurationSets(w, r.Form)
+	case "CreateConfigurationSetEventDestination", "UpdateConfigurationSetEventDestination":
+		s.handlePutConfigurationSetEventDestination(w, r.Form, action)
+	case "DeleteConfigurationSetEventDestination":
+		s.handleDeleteConfigurationSetEventDestination(w, r.Form)
+	case "ConfirmSubscription":
+		handleSNSConfirmSubscription(w, r.Form)
+	case "Unsubscribe":
+		handleSNSUnsubscribe(w, r.Form)
 	default:
-		writeSESv1Error(w, http.StatusBadRequest, "InvalidAction", fmt.Sprintf("Unknown action: %s", action))
+		writeSESv1Error(w, "InvalidAction", fmt.Sprintf("Unknown action: %s", action))
+	}
+}
+
+// decodeSESv1Send decodes an SES v1 SendEmail or SendRawEmail request
+func (s *Server) decodeSESv1Send(r *http.Request) ([]Message, *RequestError) {
+	if err := r.ParseForm(); err != nil {
+		return nil, sesError("InvalidParameterValue", "Failed to parse form body")
+	}
+	var email types.Email
+	var err *RequestError
+	if r.Form.Get("Action") == "SendRawEmail" {
+		email, err = s.sesV1RawEmail(r.Form)
+	} else {
+		email, err = s.sesV1Email(r.Form)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []Message{{Email: email}}, nil
+}
+
+// respondSESv1Send writes the send result with the message ID
+func respondSESv1Send(w http.ResponseWriter, r *http.Request, messages []Message) {
+	id := messages[0].Email.ID
+	if r.Form.Get("Action") == "SendRawEmail" {
+		writeSESv1Result(w, "SendRawEmail", sendRawEmailResult{MessageId: id})
+		return
 	}
+	writeSESv1Result(w, "SendEmail", sendEmailResult{MessageId: id})
 }
 
-func handleSendEmail(w http.ResponseWriter, form url.Values) {
+func (s *Server) sesV1Email(form url.Values) (types.Email, *RequestError) {
 	from := form.Get("Source")
 	if from == "" {
-		writeSESv1Error(w, http.StatusBadRequest, "ValidationError", "Source is required")
-		return
+		return types.Email{}, sesError("ValidationError", "Source is required")
 	}
 
 	to := extractIndexedFormValues(form, "Destination.ToAddresses.member.")
 	if len(to) == 0 {
-		writeSESv1Error(w, http.StatusBadRequest, "ValidationError", "Destination.ToAddresses is required")
-		return
+		return types.Email{}, sesError("ValidationError", "Destination.ToAddresses is required")
 	}
 
-	subject := form.Get("Message.Subject.Data")
-	html := form.Get("Message.Body.Html.Data")
-	text := form.Get("Message.Body.Text.Data")
+	subject := formCharsetValue(form, "Message.Subject")
+	html := formCharsetValue(form, "Message.Body.Html")
+	text := formCharsetValue(form, "Message.Body.Text")
 	cc := extractIndexedFormValues(form, "Destination.CcAddresses.member.")
 	bcc := extractIndexedFormValues(form, "Destination.BccAddresses.member.")
-	replyTo := form.Get("ReplyToAddresses.member.1")
 
-	email := types.Email{
-		ID:        uuid.NewString(),
-		Provider:  "ses",
-		From:      from,
-		To:        to,
-		CC:        cc,
-		BCC:       bcc,
-		Subject:   subject,
-		HTML:      html,
-		Text:      text,
-		ReplyTo:   replyTo,
-		CreatedAt: time.Now().UTC(),
-	}
-
-	store.AddEmail(email)
-
-	writeSESv1Response(w, "SendEmailResponse", email.ID)
+	if s.sesMessageTooLarge(len(subject) + len(html) + len(text)) {
+		return types.Email{}, sesError("MessageRejected", sesMessageTooLargeMessage)
+	}
+
+	configSet, err := s.lookupSESv1ConfigurationSet(form)
+	if err != nil {
+		return types.Email{}, err
+	}
+
+	return types.Email{
+		From:    from,
+		To:      to,
+		CC:      cc,
+		BCC:     bcc,
+		Subject: subject,
+		HTML:    html,
+		Text:    text,
+		ReplyTo: extractIndexedFormValues(form, "ReplyToAddresses.member."),
+		Tags:    extractFormTags(form),
+
+		ReturnPath:       form.Get("ReturnPath"),
+		Metadata:         sesCharsetMetadata(form, sesArnMetadata(form, "SourceArn", "ReturnPathArn")),
+		ConfigurationSet: configSet,
+	}, nil
 }
 
-func handleSendRawEmail(w http.ResponseWriter, form url.Values) {
+func (s *Server) sesV1RawEmail(form url.Values) (types.Email, *RequestError) {
 	rawData := form.Get("RawMessage.Data")
 	if rawData == "" {
-		writeSESv1Error(w, http.StatusBadRequest, "ValidationError", "RawMessage.Data is required")
-		return
+		return types.Email{}, sesError("ValidationError", "RawMessage.Data is required")
+	}
+
+	if s.sesMessageTooLarge(base64.StdEncoding.DecodedLen(len(rawData))) {
+		return types.Email{}, sesError("MessageRejected", sesMessageTooLargeMessage)
+	}
+
+	configSet, err := s.lookupSESv1ConfigurationSet(form)
+	if err != nil {
+		return types.Email{}, err
 	}
 
-	subject, html, text := parseRawMIME(rawData)
+	parsed := parseRawMIME(rawData)
 
-	// Try to get From from the form, fall back to parsed MIME
+	// Source and Destinations override the message headers when provided
 	from := form.Get("Source")
+	if from == "" {
+		from = parsed.From
+	}
 
 	email := types.Email{
-		ID:        uuid.NewString(),
-		Provider:  "ses",
-		From:      from,
-		Subject:   subject,
-		HTML:      html,
-		Text:      text,
-		CreatedAt: time.Now().UTC(),
-	}
-
-	// Extract destinations from form if provided
-	to := extractIndexedFormValues(form, "Destinations.member.")
-	if len(to) > 0 {
+		From:        from,
+		To:          parsed.To,
+		CC:          parsed.CC,
+		BCC:         parsed.BCC,
+		Subject:     parsed.Subject,
+		HTML:        parsed.HTML,
+		Text:        parsed.Text,
+		ReplyTo:     parsed.ReplyTo,
+		Headers:     parsed.Headers,
+		Tags:        extractFormTags(form),
+		Attachments: parsed.Attachments,
+
+		Metadata:         sesArnMetadata(form, "SourceArn", "FromArn", "ReturnPathArn"),
+		ConfigurationSet: configSet,
+	}
+
+	if to := extractIndexedFormValues(form, "Destinations.member."); len(to) > 0 {
 		email.To = to
+		email.CC = nil
+		email.BCC = nil
+	}
+	return email, nil
+}
+
+// lookupSESv1ConfigurationSet validates the optional ConfigurationSetName of a
+// send request
+func (s *Server) lookupSESv1ConfigurationSet(form url.Values) (string, *RequestError) {
+	name := form.Get("ConfigurationSetName")
+	if name == "" {
+		return "", nil
+	}
+	if _, ok := s.store.GetConfigurationSet(name); !ok {
+		return "", sesError("ConfigurationSetDoesNotExist", fmt.Sprintf("Configuration set <%s> does not exist.", name))
+	}
+	return name, nil
+}
+
+// extractFormTags extracts message tags from "Tags.member.N.Name" and
+// "Tags.member.N.Value" params
+func extractFormTags(form url.Values) []types.Tag {
+	var tags []types.Tag
+	for i := 1; ; i++ {
+		name := form.Get(fmt.Sprintf("Tags.member.%d.Name", i))
+		if name == "" {
+			break
+		}
+		tags = append(tags, types.Tag{Name: name, Value: form.Get(fmt.Sprintf("Tags.member.%d.Value", i))})
 	}
+	return tags
+}
 
-	store.AddEmail(email)
+// formCharsetValue returns the "<prefix>.Data" param. Form values are
+// percent-encoded UTF-8 (as the AWS SDKs send them), so "<prefix>.Charset"
+// only describes the message SES would build; the data is transcoded from it
+// only if it is not valid UTF-8.
+func formCharsetValue(form url.Values, prefix string) string {
+	data := form.Get(prefix + ".Data")
+	if utf8.ValidString(data) {
+		return data
+	}
+	return decodeCharset([]byte(data), form.Get(prefix+".Charset"))
+}
+
+// sesCharsetMetadata adds the charsets given for the subject and bodies to
+// metadata, keyed "subjectCharset", "htmlCharset" and "textCharset"
+func sesCharsetMetadata(form url.Values, metadata map[string]string) map[string]string {
+	for key, prefix := range map[string]string{
+		"subjectCharset": "Message.Subject",
+		"htmlCharset":    "Message.Body.Html",
+		"textCharset":    "Message.Body.Text",
+	} {
+		if charset := form.Get(prefix + ".Charset"); charset != "" {
+			if metadata == nil {
+				metadata = map[string]string{}
+			}
+			metadata[key] = charset
+		}
+	}
+	return metadata
+}
 
-	writeSESv1Response(w, "SendRawEmailResponse", email.ID)
+// sesArnMetadata collects the given ARN params into email metadata, keyed by
+// the param name with a lowercase first letter (e.g. "sourceArn")
+func sesArnMetadata(form url.Values, params ...string) map[string]string {
+	var metadata map[string]string
+	for _, param := range params {
+		if v := form.Get(param); v != "" {
+			if metadata == nil {
+				metadata = map[string]string{}
+			}
+			metadata[strings.ToLower(param[:1])+param[1:]] = v
+		}
+	}
+	return metadata
 }
 
 // extractIndexedFormValues extracts values from indexed form params like "Prefix.1", "Prefix.2", etc.
@@ -114,36 +271,3 @@ func extractIndexedFormValues(form url.Values, prefix string) []string {
 	}
 	return values
 }
-
-func writeSESv1Response(w http.ResponseWriter, responseType string, messageID string) {
-	w.Header().Set("Content-Type", "text/xml")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `<%s xmlns="http://ses.amazonaws.com/doc/2010-12-01/">
-  <%s>
-    <MessageId>%s</MessageId>
-  </%s>
-  <ResponseMetadata>
-    <RequestId>%s</RequestId>
-  </ResponseMetadata>
-</%s>`,
-		responseType,
-		responseType[:len(responseType)-len("Response")]+"Result",
-		messageID,
-		responseType[:len(responseType)-len("Response")]+"Result",
-		uuid.NewString(),
-		responseType,
-	)
-}
-
-func writeSESv1Error(w http.ResponseWriter, status int, code string, message string) {
-	w.Header().Set("Content-Type", "text/xml")
-	w.WriteHeader(status)
-	fmt.Fprintf(w, `<ErrorResponse xmlns="http://ses.amazonaws.com/doc/2010-12-01/">
-  <Error>
-    <Type>Sender</Type>
-    <Code>%s</Code>
-    <Message>%s</Message>
-  </Error>
-  <RequestId>%s</RequestId>
-</ErrorResponse>`, code, message, uuid.NewString())
-}
@@ -1,23 +1,31 @@
 package handlers
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"net/http"
-	"time"
+	"strings"
 
-	"github.com/appaka/resendpit/store"
 	"github.com/appaka/resendpit/types"
-	"github.com/google/uuid"
 )
 
 // SES v2 request types
 
 type sesV2Request struct {
-	FromEmailAddress string          `json:"FromEmailAddress"`
-	Destination      sesDestination  `json:"Destination"`
-	ReplyToAddresses []string        `json:"ReplyToAddresses"`
-	Content          sesContent      `json:"Content"`
-	EmailTags        []sesEmailTag   `json:"EmailTags"`
+	FromEmailAddress               string         `json:"FromEmailAddress"`
+	Destination                    sesDestination `json:"Destination"`
+	ReplyToAddresses               []string       `json:"ReplyToAddresses"`
+	FeedbackForwardingEmailAddress string         `json:"FeedbackForwardingEmailAddress"`
+
+	FromEmailAddressIdentityArn               string `json:"FromEmailAddressIdentityArn"`
+	FeedbackForwardingEmailAddressIdentityArn string `json:"FeedbackForwardingEmailAddressIdentityArn"`
+
+	Content              sesContent    `json:"Content"`
+	EmailTags            []sesEmailTag `json:"EmailTags"`
+	ConfigurationSetName string        `json:"ConfigurationSetName"`
+
+	ListManagementOptions *sesListManagementOptions `json:"ListManagementOptions"`
 }
 
 type sesDestination struct {
@@ -32,8 +40,25 @@ type sesContent struct {
 }
 
 type sesSimpleContent struct {
-	Subject sesBodyField `json:"Subject"`
-	Body    sesBody      `json:"Body"`
+	Subject     sesBodyField       `json:"Subject"`
+	Body        sesBody            `json:"Body"`
+	Headers     []sesMessageHeader `json:"Headers"`
+	Attachments []sesAttachment    `json:"Attachments"`
+}
+
+type sesMessageHeader struct {
+	Name  string `json:"Name"`
+	Value string `json:"Value"`
+}
+
+type sesAttachment struct {
+	RawContent              string `json:"RawContent"`
+	ContentDisposition      string `json:"ContentDisposition"`
+	FileName                string `json:"FileName"`
+	ContentDescription      string `json:"ContentDescription"`
+	ContentId               string `json:"ContentId"`
+	ContentTransferEncoding string `json:"ContentTransferEncoding"`
+	ContentType             string `json:"ContentType"`
 }
 
 type sesBody struct {
@@ -54,51 +79,49 @@ type sesEmailTag struct {
 	Value string `json:"Value"`
 }
 
-// PostSESv2Email handles POST /v2/email/outbound-emails (SES v2 API)
-func PostSESv2Email(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
+// decodeSESv2Email decodes a POST /v2/email/outbound-emails request (SES
+// v2 API)
+func (s *Server) decodeSESv2Email(r *http.Request) ([]Message, *RequestError) {
 	var req sesV2Request
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeSESv2Error(w, http.StatusBadRequest, "Invalid JSON in request body")
-		return
+		return nil, sesError("BadRequestException", "Invalid JSON in request body")
 	}
 
 	if req.FromEmailAddress == "" {
-		writeSESv2Error(w, http.StatusBadRequest, "FromEmailAddress is required")
-		return
+		return nil, sesError("BadRequestException", "FromEmailAddress is required")
 	}
 
 	if len(req.Destination.ToAddresses) == 0 {
-		writeSESv2Error(w, http.StatusBadRequest, "Destination.ToAddresses is required")
-		return
+		return nil, sesError("BadRequestException", "Destination.ToAddresses is required")
 	}
 
 	if req.Content.Simple == nil && req.Content.Raw == nil {
-		writeSESv2Error(w, http.StatusBadRequest, "Content.Simple or Content.Raw is required")
-		return
+		return nil, sesError("BadRequestException", "Content.Simple or Content.Raw is required")
 	}
 
-	var subject, html, text string
+	if req.ConfigurationSetName != "" {
+		if _, ok := s.store.GetConfigurationSet(req.ConfigurationSetName); !ok {
+			return nil, sesError("NotFoundException", fmt.Sprintf("Configuration set %s does not exist.", req.ConfigurationSetName))
+		}
+	}
 
-	if req.Content.Simple != nil {
-		subject = req.Content.Simple.Subject.Data
-		if req.Content.Simple.Body.Html != nil {
-			html = req.Content.Simple.Body.Html.Data
+	size := 0
+	if simple := req.Content.Simple; simple != nil {
+		size = len(simple.Subject.Data)
+		if simple.Body.Html != nil {
+			size += len(simple.Body.Html.Data)
+		}
+		if simple.Body.Text != nil {
+			size += len(simple.Body.Text.Data)
 		}
-		if req.Content.Simple.Body.Text != nil {
-			text = req.Content.Simple.Body.Text.Data
+		for _, a := range simple.Attachments {
+			size += base64.StdEncoding.DecodedLen(len(a.RawContent))
 		}
-	} else if req.Content.Raw != nil {
-		subject, html, text = parseRawMIME(req.Content.Raw.Data)
+	} else {
+		size = base64.StdEncoding.DecodedLen(len(req.Content.Raw.Data))
 	}
-
-	var replyTo string
-	if len(req.ReplyToAddresses) > 0 {
-		replyTo = req.ReplyToAddresses[0]
+	if s.sesMessageTooLarge(size) {
+		return nil, sesError("MessageRejected", sesMessageTooLargeMessage)
 	}
 
 	var tags []types.Tag
@@ -107,30 +130,83 @@ func PostSESv2Email(w http.ResponseWriter, r *http.Request) {
 	}
 
 	email := types.Email{
-		ID:        uuid.NewString(),
-		Provider:  "ses",
-		From:      req.FromEmailAddress,
-		To:        req.Destination.ToAddresses,
-		CC:        req.Destination.CcAddresses,
-		BCC:       req.Destination.BccAddresses,
-		Subject:   subject,
-		HTML:      html,
-		Text:      text,
-		ReplyTo:   replyTo,
-		Tags:      tags,
-		CreatedAt: time.Now().UTC(),
+		From:    req.FromEmailAddress,
+		To:      req.Destination.ToAddresses,
+		CC:      req.Destination.CcAddresses,
+		BCC:     req.Destination.BccAddresses,
+		ReplyTo: req.ReplyToAddresses,
+		Tags:    tags,
+
+		ReturnPath:       req.FeedbackForwardingEmailAddress,
+		ConfigurationSet: req.ConfigurationSetName,
 	}
 
-	store.AddEmail(email)
+	for key, arn := range map[string]string{
+		"fromArn":       req.FromEmailAddressIdentityArn,
+		"returnPathArn": req.FeedbackForwardingEmailAddressIdentityArn,
+	} {
+		if arn == "" {
+			continue
+		}
+		if email.Metadata == nil {
+			email.Metadata = map[string]string{}
+		}
+		email.Metadata[key] = arn
+	}
+
+	if simple := req.Content.Simple; simple != nil {
+		email.Subject = simple.Subject.Data
+		if simple.Body.Html != nil {
+			email.HTML = simple.Body.Html.Data
+		}
+		if simple.Body.Text != nil {
+			email.Text = simple.Body.Text.Data
+		}
+		for _, h := range simple.Headers {
+			if email.Headers == nil {
+				email.Headers = map[string]string{}
+			}
+			email.Headers[h.Name] = h.Value
+		}
+		for _, a := range simple.Attachments {
+			email.Attachments = append(email.Attachments, sesV2Attachment(a))
+		}
+	} else {
+		parsed := parseRawMIME(req.Content.Raw.Data)
+		email.Subject = parsed.Subject
+		email.HTML = parsed.HTML
+		email.Text = parsed.Text
+		email.Headers = parsed.Headers
+		email.Attachments = parsed.Attachments
+	}
 
-	writeJSON(w, http.StatusOK, map[string]string{"MessageId": email.ID})
+	if req.ListManagementOptions != nil {
+		if err := s.applyListManagement(&email, req.ListManagementOptions); err != nil {
+			return nil, err
+		}
+	}
+	return []Message{{Email: email}}, nil
+}
+
+// respondSESv2Email writes the message ID
+func respondSESv2Email(w http.ResponseWriter, r *http.Request, messages []Message) {
+	writeJSON(w, http.StatusOK, map[string]string{"MessageId": messages[0].Email.ID})
 }
 
-func writeSESv2Error(w http.ResponseWriter, status int, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(map[string]string{
-		"__type":  "ValidationException",
-		"message": message,
-	})
+// sesV2Attachment converts an SES v2 Simple content attachment
+func sesV2Attachment(a sesAttachment) types.Attachment {
+	att := types.Attachment{
+		Filename:    a.FileName,
+		ContentType: a.ContentType,
+		ContentID:   a.ContentId,
+		Disposition: strings.ToLower(a.ContentDisposition),
+	}
+	if att.Disposition == "" {
+		att.Disposition = "attachment"
+	}
+	if att.ContentType == "" {
+		att.ContentType = contentTypeByFilename(a.FileName)
+	}
+	att.Size = base64DecodedSize(a.RawContent)
+	return att
 }
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/appaka/resendpit/smtp"
+	"github.com/appaka/resendpit/types"
+	"github.com/google/uuid"
+)
+
+// CaptureSMTPMessage stores a message received by the SMTP server, using
+// the envelope recipients (see envelopeRecipients). The message's
+// X-Resendpit-Mailbox header or the SMTP username pick its mailbox.
+func (s *Server) CaptureSMTPMessage(envelope smtp.Envelope, data []byte) error {
+	parsed := parseMIME(data)
+	to, cc, bcc := parsed.envelopeRecipients(envelope.To)
+
+	email := types.Email{
+		ID:          uuid.New().String(),
+		Provider:    "smtp",
+		From:        parsed.From,
+		To:          to,
+		CC:          cc,
+		BCC:         bcc,
+		Subject:     parsed.Subject,
+		HTML:        parsed.HTML,
+		Text:        parsed.Text,
+		ReplyTo:     parsed.ReplyTo,
+		Headers:     parsed.Headers,
+		Attachments: parsed.Attachments,
+		CreatedAt:   time.Now().UTC(),
+		ReturnPath:  envelope.From,
+	}
+	if email.From == "" {
+		email.From = envelope.From
+	}
+	if envelope.Username != "" {
+		email.Metadata = map[string]string{"smtpUsername": envelope.Username}
+	}
+
+	email.Mailbox = s.routeMailbox(parsed.Headers[MailboxHeader], envelope.Username, email)
+
+	s.store.AddEmail(email)
+	return nil
+}
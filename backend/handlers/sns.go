@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/appaka/resendpit/sns"
+)
+
+// SNS result types
+
+type confirmSubscriptionResult struct {
+	XMLName         xml.Name `xml:"ConfirmSubscriptionResult"`
+	SubscriptionArn string   `xml:"SubscriptionArn"`
+}
+
+type unsubscribeResult struct {
+	XMLName xml.Name `xml:"UnsubscribeResult"`
+}
+
+// SNSQuery handles GET /?Action=ConfirmSubscription and GET /?Action=Unsubscribe,
+// the SubscribeURL and UnsubscribeURL included in SNS messages
+func SNSQuery(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	switch query.Get("Action") {
+	case "ConfirmSubscription":
+		handleSNSConfirmSubscription(w, query)
+	case "Unsubscribe":
+		handleSNSUnsubscribe(w, query)
+	default:
+		writeSESv1Error(w, "InvalidAction", fmt.Sprintf("Unknown action: %s", query.Get("Action")))
+	}
+}
+
+// SNSSigningCert handles GET /sns/SimpleNotificationService.pem
+func SNSSigningCert(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cert, err := sns.SigningCert()
+	if err != nil {
+		http.Error(w, "Signing certificate unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Write(cert)
+}
+
+func handleSNSConfirmSubscription(w http.ResponseWriter, params url.Values) {
+	arn, ok := sns.ConfirmSubscription(params.Get("TopicArn"), params.Get("Token"))
+	if !ok {
+		writeSESv1Error(w, "InvalidParameter", "Invalid token")
+		return
+	}
+
+	writeQueryResult(w, snsNamespace, "ConfirmSubscription", confirmSubscriptionResult{SubscriptionArn: arn})
+}
+
+func handleSNSUnsubscribe(w http.ResponseWriter, params url.Values) {
+	if !sns.Unsubscribe(params.Get("SubscriptionArn")) {
+		writeSESv1Error(w, "NotFound", "Subscription does not exist")
+		return
+	}
+
+	writeQueryResult(w, snsNamespace, "Unsubscribe", unsubscribeResult{})
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/appaka/resendpit/types"
+	"github.com/google/uuid"
+)
+
+type publishResult struct {
+	XMLName   xml.Name `xml:"PublishResult"`
+	MessageId string   `xml:"MessageId"`
+}
+
+// snsPhoneNumber matches E.164 phone numbers
+var snsPhoneNumber = regexp.MustCompile(`^\+?[1-9][0-9]{1,14}$`)
+
+// snsSMSAttributes maps the SMS message attributes of a Publish to the
+// metadata keys they are stored under
+var snsSMSAttributes = map[string]string{
+	"AWS.SNS.SMS.SenderID":             "senderId",
+	"AWS.SNS.SMS.SMSType":              "smsType",
+	"AWS.SNS.SMS.MaxPrice":             "maxPrice",
+	"AWS.MM.SMS.OriginationNumber":     "originationNumber",
+	"AWS.MM.SMS.EntityId":              "entityId",
+	"AWS.MM.SMS.TemplateId":            "templateId",
+	"AWS.SNS.SMS.ProtectConfiguration": "protectConfigurationId",
+}
+
+// snsProvider emulates SNS Publish to a phone number (SMS). Publishing to
+// topics is not captured.
+type snsProvider struct{}
+
+func init() {
+	registerProvider(snsProvider{})
+}
+
+func (snsProvider) Name() string { return "sns" }
+
+func (snsProvider) Routes(s *Server) []Route {
+	return []Route{
+		{Pattern: "/", Match: isSNSPublish, Method: http.MethodPost, Decode: decodeSNSPublish, Respond: respondSNSPublish},
+	}
+}
+
+func (snsProvider) WriteError(w http.ResponseWriter, r *http.Request, err *RequestError) {
+	writeQueryError(w, snsNamespace, err.Code, err.Message)
+}
+
+// isSNSPublish reports whether r is an SNS Publish request
+func isSNSPublish(r *http.Request) bool {
+	return isQueryRequest(r) && queryAction(r) == "Publish"
+}
+
+// decodeSNSPublish decodes an SNS Publish request with a PhoneNumber
+func decodeSNSPublish(r *http.Request) ([]Message, *RequestError) {
+	form := r.Form
+	phone := form.Get("PhoneNumber")
+	if phone == "" {
+		if form.Get("TopicArn") != "" || form.Get("TargetArn") != "" {
+			return nil, snsError("InvalidParameter", "Invalid parameter: Only publishing to a PhoneNumber is supported")
+		}
+		return nil, snsError("InvalidParameter", "Invalid parameter: TopicArn or TargetArn Reason: no value for required parameter")
+	}
+	if !snsPhoneNumber.MatchString(phone) {
+		return nil, snsError("InvalidParameter", fmt.Sprintf("Invalid parameter: PhoneNumber Reason: %s is not valid to publish to", phone))
+	}
+	message := form.Get("Message")
+	if message == "" {
+		return nil, snsError("InvalidParameter", "Invalid parameter: Empty message")
+	}
+	if utf8.RuneCountInString(message) > 1600 {
+		return nil, snsError("InvalidParameter", "Invalid parameter: Message too long")
+	}
+
+	sms := &types.SMS{
+		To:       phone,
+		Body:     message,
+		Metadata: map[string]string{"messageId": uuid.NewString()},
+	}
+	for i := 1; ; i++ {
+		prefix := fmt.Sprintf("MessageAttributes.entry.%d.", i)
+		name := form.Get(prefix + "Name")
+		if name == "" {
+			break
+		}
+		key, ok := snsSMSAttributes[name]
+		if !ok {
+			key = name
+		}
+		sms.Metadata[key] = form.Get(prefix + "Value.StringValue")
+	}
+	// The origination number, or else the sender ID, is what the recipient
+	// sees
+	sms.From = sms.Metadata["originationNumber"]
+	if sms.From == "" {
+		sms.From = sms.Metadata["senderId"]
+	}
+	return []Message{{SMS: sms}}, nil
+}
+
+// respondSNSPublish writes the PublishResponse with the message ID
+func respondSNSPublish(w http.ResponseWriter, r *http.Request, messages []Message) {
+	writeQueryResult(w, snsNamespace, "Publish", publishResult{MessageId: messages[0].SMS.Metadata["messageId"]})
+}
+
+func snsError(code, message string) *RequestError {
+	return &RequestError{Status: awsErrorStatusFor(code), Code: code, Message: message}
+}
@@ -0,0 +1,412 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/appaka/resendpit/types"
+)
+
+// sparkPostTransmission is the body of a SparkPost POST
+// /api/v1/transmissions request
+type sparkPostTransmission struct {
+	Options struct {
+		StartTime string `json:"start_time"`
+	} `json:"options"`
+	CampaignID       string                 `json:"campaign_id"`
+	Description      string                 `json:"description"`
+	Metadata         map[string]interface{} `json:"metadata"`
+	SubstitutionData map[string]interface{} `json:"substitution_data"`
+	ReturnPath       string                 `json:"return_path"`
+	// Recipients is either a list of recipients or {"list_id": "..."}
+	Recipients json.RawMessage  `json:"recipients"`
+	Content    sparkPostContent `json:"content"`
+}
+
+// sparkPostContent is inline content, a stored template or a raw message
+type sparkPostContent struct {
+	From         json.RawMessage   `json:"from"`
+	Subject      string            `json:"subject"`
+	HTML         string            `json:"html"`
+	Text         string            `json:"text"`
+	ReplyTo      string            `json:"reply_to"`
+	Headers      map[string]string `json:"headers"`
+	Attachments  []sparkPostFile   `json:"attachments"`
+	InlineImages []sparkPostFile   `json:"inline_images"`
+	TemplateID   string            `json:"template_id"`
+	EmailRFC822  string            `json:"email_rfc822"`
+}
+
+type sparkPostFile struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Data string `json:"data"`
+}
+
+// sparkPostRecipient is a recipient. Address is an email string or an
+// object with email, name and header_to.
+type sparkPostRecipient struct {
+	Address          json.RawMessage        `json:"address"`
+	Tags             []string               `json:"tags,omitempty"`
+	Metadata         map[string]interface{} `json:"metadata,omitempty"`
+	SubstitutionData map[string]interface{} `json:"substitution_data,omitempty"`
+}
+
+type sparkPostAddress struct {
+	Email    string `json:"email"`
+	Name     string `json:"name,omitempty"`
+	HeaderTo string `json:"header_to,omitempty"`
+}
+
+// sparkPostError is an entry of a SparkPost error response
+type sparkPostError struct {
+	Message     string `json:"message"`
+	Description string `json:"description,omitempty"`
+	Code        string `json:"code,omitempty"`
+}
+
+// sparkPostProvider emulates the SparkPost Transmissions and Recipient
+// Lists APIs
+type sparkPostProvider struct{}
+
+func init() {
+	registerProvider(sparkPostProvider{})
+}
+
+func (sparkPostProvider) Name() string { return "sparkpost" }
+
+func (sparkPostProvider) Routes(s *Server) []Route {
+	return []Route{
+		{Pattern: "/api/v1/transmissions", Method: http.MethodPost, Decode: s.decodeSparkPostTransmission, Respond: respondSparkPostTransmission},
+		{Pattern: "/api/v1/recipient-lists", Handler: s.SparkPostRecipientLists},
+		{Pattern: "/api/v1/recipient-lists/{id}", Handler: s.SparkPostRecipientList},
+	}
+}
+
+// WriteError writes SparkPost's errors array. Details carries the full
+// error, with its description.
+func (sparkPostProvider) WriteError(w http.ResponseWriter, r *http.Request, err *RequestError) {
+	e, ok := err.Details.(sparkPostError)
+	if !ok {
+		e = sparkPostError{Message: err.Message, Code: err.Code}
+	}
+	writeSparkPostErrors(w, err.Status, e)
+}
+
+// decodeSparkPostTransmission decodes a POST /api/v1/transmissions
+// request. Each recipient is captured as its own email, with the global
+// substitution data overridden by the recipient's applied to the content.
+// Recipients without a valid address are rejected.
+func (s *Server) decodeSparkPostTransmission(r *http.Request) ([]Message, *RequestError) {
+	if r.Header.Get("Authorization") == "" {
+		return nil, sparkPostRequestError(http.StatusUnauthorized, sparkPostError{Message: "Unauthorized."})
+	}
+
+	var req sparkPostTransmission
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, sparkPostRequestError(http.StatusBadRequest, sparkPostError{
+			Message: "invalid data format/type", Description: "Problems parsing request as json", Code: "1300",
+		})
+	}
+
+	recipients, errResp, status := s.resolveSparkPostRecipients(req.Recipients)
+	if errResp != nil {
+		return nil, sparkPostRequestError(status, *errResp)
+	}
+
+	content := req.Content
+	var parsed parsedMIME
+	switch {
+	case content.EmailRFC822 != "":
+		parsed = parseMIME([]byte(content.EmailRFC822))
+	case content.TemplateID != "":
+	default:
+		if e := validateSparkPostContent(content); e != nil {
+			return nil, sparkPostRequestError(http.StatusUnprocessableEntity, *e)
+		}
+	}
+
+	var scheduledAt *time.Time
+	if start := req.Options.StartTime; start != "" && start != "now" {
+		t, err := time.Parse(time.RFC3339, start)
+		if err != nil {
+			return nil, sparkPostRequestError(http.StatusUnprocessableEntity, sparkPostError{
+				Message: "invalid data format/type", Description: "options.start_time must be an ISO 8601 date-time", Code: "1300",
+			})
+		}
+		t = t.UTC()
+		scheduledAt = &t
+	}
+
+	transmissionID := newSparkPostID()
+	messages := make([]Message, 0, len(recipients))
+	accepted := 0
+	for _, recipient := range recipients {
+		if !strings.Contains(recipient.Email, "@") {
+			messages = append(messages, Message{Skip: true, Result: transmissionID})
+			continue
+		}
+		email := sparkPostEmail(&req, parsed, recipient, transmissionID)
+		email.ScheduledAt = scheduledAt
+		messages = append(messages, Message{Email: email, Result: transmissionID})
+		accepted++
+	}
+	if accepted == 0 {
+		return nil, sparkPostRequestError(http.StatusUnprocessableEntity, sparkPostError{
+			Message: "At least one valid recipient is required", Code: "5002",
+		})
+	}
+	return messages, nil
+}
+
+func respondSparkPostTransmission(w http.ResponseWriter, r *http.Request, messages []Message) {
+	accepted, rejected := 0, 0
+	for _, m := range messages {
+		if m.Skip {
+			rejected++
+		} else {
+			accepted++
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"results": map[string]interface{}{
+			"total_rejected_recipients": rejected,
+			"total_accepted_recipients": accepted,
+			"id":                        messages[0].Result.(string),
+		},
+	})
+}
+
+func sparkPostRequestError(status int, e sparkPostError) *RequestError {
+	return &RequestError{Status: status, Code: e.Code, Message: e.Message, Details: e}
+}
+
+// resolveSparkPostRecipients returns the inline recipients or those of the
+// stored list referenced by list_id
+func (s *Server) resolveSparkPostRecipients(raw json.RawMessage) ([]types.ListRecipient, *sparkPostError, int) {
+	missing := &sparkPostError{Message: "required field is missing", Description: "recipients or list_id required", Code: "1400"}
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, missing, http.StatusBadRequest
+	}
+
+	if raw[0] == '{' {
+		var ref struct {
+			ListID string `json:"list_id"`
+		}
+		if err := json.Unmarshal(raw, &ref); err != nil || ref.ListID == "" {
+			return nil, missing, http.StatusBadRequest
+		}
+		list, ok := s.store.GetRecipientList(ref.ListID)
+		if !ok {
+			return nil, &sparkPostError{
+				Message: "resource not found", Description: "Recipient list '" + ref.ListID + "' does not exist", Code: "1600",
+			}, http.StatusNotFound
+		}
+		return list.Recipients, nil, 0
+	}
+
+	var inline []sparkPostRecipient
+	if err := json.Unmarshal(raw, &inline); err != nil {
+		return nil, &sparkPostError{Message: "invalid data format/type", Description: "recipients must be an array or an object with list_id", Code: "1300"}, http.StatusBadRequest
+	}
+	if len(inline) == 0 {
+		return nil, missing, http.StatusBadRequest
+	}
+	recipients := make([]types.ListRecipient, 0, len(inline))
+	for _, r := range inline {
+		recipients = append(recipients, r.toListRecipient())
+	}
+	return recipients, nil, 0
+}
+
+func validateSparkPostContent(content sparkPostContent) *sparkPostError {
+	if email, _ := parseSparkPostAddress(content.From); email.Email == "" {
+		return &sparkPostError{Message: "required field is missing", Description: "content.from is a required field", Code: "1400"}
+	}
+	if content.Subject == "" {
+		return &sparkPostError{Message: "required field is missing", Description: "content.subject is a required field", Code: "1400"}
+	}
+	if content.HTML == "" && content.Text == "" {
+		return &sparkPostError{Message: "required field is missing", Description: "At least one of text or html needs to exist in content", Code: "1400"}
+	}
+	return nil
+}
+
+// sparkPostEmail builds the email captured for one recipient
+func sparkPostEmail(req *sparkPostTransmission, parsed parsedMIME, recipient types.ListRecipient, transmissionID string) types.Email {
+	content := req.Content
+	email := types.Email{
+		ReturnPath: req.ReturnPath,
+		Metadata:   map[string]string{"transmissionId": transmissionID},
+	}
+
+	model := map[string]interface{}{
+		"address": map[string]interface{}{"email": recipient.Email, "name": recipient.Name},
+	}
+	for k, v := range req.SubstitutionData {
+		model[k] = v
+	}
+	for k, v := range recipient.SubstitutionData {
+		model[k] = v
+	}
+
+	address := formatAddress(recipient.Name, recipient.Email)
+	switch {
+	case content.EmailRFC822 != "":
+		email.From = parsed.From
+		email.To, email.CC, email.BCC = parsed.envelopeRecipients([]string{address})
+		email.ReplyTo = parsed.ReplyTo
+		email.Headers = parsed.Headers
+		email.Attachments = parsed.Attachments
+		email.Subject = renderMustachio(parsed.Subject, model, false)
+		email.HTML = renderMustachio(parsed.HTML, model, true)
+		email.Text = renderMustachio(parsed.Text, model, false)
+	case content.TemplateID != "":
+		email.To = []string{address}
+		email.TemplateID = content.TemplateID
+		email.TemplateData = model
+	default:
+		from, _ := parseSparkPostAddress(content.From)
+		email.From = formatAddress(from.Name, from.Email)
+		email.Subject = renderMustachio(content.Subject, model, false)
+		email.HTML = renderMustachio(content.HTML, model, true)
+		email.Text = renderMustachio(content.Text, model, false)
+		email.ReplyTo = splitAddressList([]string{content.ReplyTo})
+		email.Headers = content.Headers
+
+		// header_to shows another address in the To header: the recipient
+		// is then a Cc (if listed in the CC header) or Bcc copy
+		email.To = []string{address}
+		email.CC = splitAddressList([]string{content.Headers["CC"]})
+		if recipient.HeaderTo != "" && !strings.EqualFold(extractAddress(recipient.HeaderTo), recipient.Email) {
+			email.To = splitAddressList([]string{recipient.HeaderTo})
+			if !containsAddress(email.CC, recipient.Email) {
+				email.BCC = []string{address}
+			}
+		}
+
+		for _, f := range content.Attachments {
+			email.Attachments = append(email.Attachments, sparkPostAttachment(f, "attachment"))
+		}
+		for _, f := range content.InlineImages {
+			email.Attachments = append(email.Attachments, sparkPostAttachment(f, "inline"))
+		}
+	}
+
+	if req.CampaignID != "" {
+		email.Metadata["campaignId"] = req.CampaignID
+	}
+	for k, v := range req.Metadata {
+		email.Metadata[k] = metadataString(v)
+	}
+	for k, v := range recipient.Metadata {
+		email.Metadata[k] = metadataString(v)
+	}
+	for _, tag := range recipient.Tags {
+		email.Tags = append(email.Tags, types.Tag{Name: "tag", Value: tag})
+	}
+	return email
+}
+
+func sparkPostAttachment(f sparkPostFile, disposition string) types.Attachment {
+	att := types.Attachment{
+		Filename:    f.Name,
+		Size:        base64DecodedSize(f.Data),
+		ContentType: f.Type,
+		Disposition: disposition,
+	}
+	if disposition == "inline" {
+		// Inline images are referenced as cid:name
+		att.ContentID = f.Name
+	}
+	if att.ContentType == "" {
+		att.ContentType = contentTypeByFilename(f.Name)
+	}
+	return att
+}
+
+func (r sparkPostRecipient) toListRecipient() types.ListRecipient {
+	address, _ := parseSparkPostAddress(r.Address)
+	return types.ListRecipient{
+		Email:            address.Email,
+		Name:             address.Name,
+		HeaderTo:         address.HeaderTo,
+		Tags:             r.Tags,
+		Metadata:         r.Metadata,
+		SubstitutionData: r.SubstitutionData,
+	}
+}
+
+func newSparkPostRecipient(r types.ListRecipient) sparkPostRecipient {
+	address, _ := json.Marshal(sparkPostAddress{Email: r.Email, Name: r.Name, HeaderTo: r.HeaderTo})
+	return sparkPostRecipient{
+		Address:          address,
+		Tags:             r.Tags,
+		Metadata:         r.Metadata,
+		SubstitutionData: r.SubstitutionData,
+	}
+}
+
+// parseSparkPostAddress parses an address given as "email", "Name <email>"
+// or an object
+func parseSparkPostAddress(raw json.RawMessage) (sparkPostAddress, bool) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if addr, err := mail.ParseAddress(s); err == nil {
+			return sparkPostAddress{Email: addr.Address, Name: addr.Name}, true
+		}
+		return sparkPostAddress{Email: strings.TrimSpace(s)}, s != ""
+	}
+	var address sparkPostAddress
+	err := json.Unmarshal(raw, &address)
+	return address, err == nil
+}
+
+// containsAddress reports whether list contains the email address
+func containsAddress(list []string, email string) bool {
+	for _, addr := range list {
+		if strings.EqualFold(extractAddress(addr), email) {
+			return true
+		}
+	}
+	return false
+}
+
+// metadataString converts a metadata value to a string, encoding objects
+// and arrays as JSON
+func metadataString(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	return mustachioString(v)
+}
+
+// requireSparkPostKey rejects requests without an API key. Any key is
+// accepted.
+func requireSparkPostKey(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Authorization") == "" {
+		writeSparkPostErrors(w, http.StatusUnauthorized, sparkPostError{Message: "Unauthorized."})
+		return false
+	}
+	return true
+}
+
+// newSparkPostID returns a numeric ID like the ones SparkPost assigns
+func newSparkPostID() string {
+	n, _ := rand.Int(rand.Reader, big.NewInt(9e16))
+	return fmt.Sprintf("%d", n.Int64()+1e16)
+}
+
+func writeSparkPostErrors(w http.ResponseWriter, status int, errs ...sparkPostError) {
+	writeJSON(w, status, map[string][]sparkPostError{"errors": errs})
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/appaka/resendpit/types"
+	"github.com/google/uuid"
+)
+
+// sparkPostRecipientListRequest is the body of a create or update recipient
+// list request
+type sparkPostRecipientListRequest struct {
+	ID          string               `json:"id"`
+	Name        string               `json:"name"`
+	Description string               `json:"description"`
+	Recipients  []sparkPostRecipient `json:"recipients"`
+}
+
+// SparkPostRecipientLists handles GET and POST /api/v1/recipient-lists
+func (s *Server) SparkPostRecipientLists(w http.ResponseWriter, r *http.Request) {
+	if !requireSparkPostKey(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		results := []map[string]interface{}{}
+		for _, list := range s.store.GetRecipientLists() {
+			results = append(results, sparkPostRecipientListResult(list, false))
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"results": results})
+	case http.MethodPost:
+		var req sparkPostRecipientListRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeSparkPostErrors(w, http.StatusBadRequest, sparkPostError{
+				Message: "invalid data format/type", Description: "Problems parsing request as json", Code: "1300",
+			})
+			return
+		}
+		if len(req.Recipients) == 0 {
+			writeSparkPostErrors(w, http.StatusUnprocessableEntity, sparkPostError{
+				Message: "required field is missing", Description: "recipients is a required field", Code: "1400",
+			})
+			return
+		}
+		if req.ID == "" {
+			req.ID = strings.ReplaceAll(uuid.NewString(), "-", "")
+		}
+		list := newRecipientList(req)
+		if !s.store.AddRecipientList(list) {
+			writeSparkPostErrors(w, http.StatusConflict, sparkPostError{
+				Message: "resource conflict", Description: "Recipient list with id '" + req.ID + "' already exists", Code: "1602",
+			})
+			return
+		}
+		writeSparkPostRecipientListAccepted(w, list, len(req.Recipients))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// SparkPostRecipientList handles GET, PUT and DELETE
+// /api/v1/recipient-lists/{id}
+func (s *Server) SparkPostRecipientList(w http.ResponseWriter, r *http.Request) {
+	if !requireSparkPostKey(w, r) {
+		return
+	}
+
+	id := r.PathValue("id")
+	list, ok := s.store.GetRecipientList(id)
+	if !ok {
+		writeSparkPostErrors(w, http.StatusNotFound, sparkPostError{
+			Message: "resource not found", Description: "List does not exist", Code: "1600",
+		})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		showRecipients := r.URL.Query().Get("show_recipients") == "true"
+		writeJSON(w, http.StatusOK, map[string]interface{}{"results": sparkPostRecipientListResult(list, showRecipients)})
+	case http.MethodPut:
+		var req sparkPostRecipientListRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeSparkPostErrors(w, http.StatusBadRequest, sparkPostError{
+				Message: "invalid data format/type", Description: "Problems parsing request as json", Code: "1300",
+			})
+			return
+		}
+		req.ID = id
+		updated := newRecipientList(req)
+		updated.CreatedAt = list.CreatedAt
+		if len(req.Recipients) == 0 {
+			updated.Recipients = list.Recipients
+		}
+		s.store.UpdateRecipientList(updated)
+		writeSparkPostRecipientListAccepted(w, updated, len(updated.Recipients))
+	case http.MethodDelete:
+		s.store.DeleteRecipientList(id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func newRecipientList(req sparkPostRecipientListRequest) types.RecipientList {
+	list := types.RecipientList{
+		ID:          req.ID,
+		Name:        req.Name,
+		Description: req.Description,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if list.Name == "" {
+		list.Name = req.ID
+	}
+	for _, r := range req.Recipients {
+		if recipient := r.toListRecipient(); strings.Contains(recipient.Email, "@") {
+			list.Recipients = append(list.Recipients, recipient)
+		}
+	}
+	return list
+}
+
+func sparkPostRecipientListResult(list types.RecipientList, showRecipients bool) map[string]interface{} {
+	result := map[string]interface{}{
+		"id":                        list.ID,
+		"name":                      list.Name,
+		"description":               list.Description,
+		"total_accepted_recipients": len(list.Recipients),
+	}
+	if showRecipients {
+		recipients := make([]sparkPostRecipient, 0, len(list.Recipients))
+		for _, r := range list.Recipients {
+			recipients = append(recipients, newSparkPostRecipient(r))
+		}
+		result["recipients"] = recipients
+	}
+	return result
+}
+
+// writeSparkPostRecipientListAccepted writes the response of a create or
+// update, counting recipients without a valid address as rejected
+func writeSparkPostRecipientListAccepted(w http.ResponseWriter, list types.RecipientList, submitted int) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"results": map[string]interface{}{
+			"total_rejected_recipients": submitted - len(list.Recipients),
+			"total_accepted_recipients": len(list.Recipients),
+			"id":                        list.ID,
+			"name":                      list.Name,
+		},
+	})
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/appaka/resendpit/types"
+)
+
+// twilioMessage is the Twilio Message resource returned by a send
+type twilioMessage struct {
+	SID                 string            `json:"sid"`
+	AccountSID          string            `json:"account_sid"`
+	MessagingServiceSID *string           `json:"messaging_service_sid"`
+	From                *string           `json:"from"`
+	To                  string            `json:"to"`
+	Body                string            `json:"body"`
+	Status              string            `json:"status"`
+	NumSegments         string            `json:"num_segments"`
+	NumMedia            string            `json:"num_media"`
+	Direction           string            `json:"direction"`
+	APIVersion          string            `json:"api_version"`
+	Price               *string           `json:"price"`
+	PriceUnit           string            `json:"price_unit"`
+	ErrorCode           *int              `json:"error_code"`
+	ErrorMessage        *string           `json:"error_message"`
+	DateCreated         string            `json:"date_created"`
+	DateUpdated         string            `json:"date_updated"`
+	DateSent            *string           `json:"date_sent"`
+	URI                 string            `json:"uri"`
+	SubresourceURIs     map[string]string `json:"subresource_uris"`
+}
+
+// twilioError is Twilio's error response
+type twilioError struct {
+	Code     int    `json:"code"`
+	Message  string `json:"message"`
+	MoreInfo string `json:"more_info"`
+	Status   int    `json:"status"`
+}
+
+// twilioProvider emulates the Twilio Programmable Messaging API
+type twilioProvider struct{}
+
+func init() {
+	registerProvider(twilioProvider{})
+}
+
+func (twilioProvider) Name() string { return "twilio" }
+
+func (twilioProvider) Routes(s *Server) []Route {
+	return []Route{
+		{Pattern: "/2010-04-01/Accounts/{AccountSid}/Messages.json", Method: http.MethodPost, Decode: decodeTwilioMessage, Respond: respondTwilioMessage},
+	}
+}
+
+// WriteError writes Twilio's error response. Code is the numeric Twilio
+// error code.
+func (twilioProvider) WriteError(w http.ResponseWriter, r *http.Request, err *RequestError) {
+	code, _ := strconv.Atoi(err.Code)
+	resp := twilioError{Code: code, Message: err.Message, Status: err.Status}
+	if code != 0 {
+		resp.MoreInfo = "https://www.twilio.com/docs/errors/" + err.Code
+	}
+	writeJSON(w, err.Status, resp)
+}
+
+// decodeTwilioMessage decodes a form-encoded POST
+// /2010-04-01/Accounts/{AccountSid}/Messages.json request
+func decodeTwilioMessage(r *http.Request) ([]Message, *RequestError) {
+	if _, _, ok := r.BasicAuth(); !ok {
+		return nil, &RequestError{Status: http.StatusUnauthorized, Code: "20003", Message: "Authenticate"}
+	}
+	if err := r.ParseForm(); err != nil {
+		return nil, &RequestError{Status: http.StatusBadRequest, Code: "20001", Message: "Failed to parse form body"}
+	}
+	form := r.PostForm
+	to := form.Get("To")
+	if to == "" {
+		return nil, &RequestError{Status: http.StatusBadRequest, Code: "21604", Message: "A 'To' phone number is required."}
+	}
+	serviceSID := form.Get("MessagingServiceSid")
+	if form.Get("From") == "" && serviceSID == "" {
+		return nil, &RequestError{Status: http.StatusBadRequest, Code: "21603", Message: "A 'From' phone number is required."}
+	}
+	body := form.Get("Body")
+	media := form["MediaUrl"]
+	if body == "" && len(media) == 0 && form.Get("ContentSid") == "" {
+		return nil, &RequestError{Status: http.StatusBadRequest, Code: "21602", Message: "Message body is required."}
+	}
+	if utf8.RuneCountInString(body) > 1600 {
+		return nil, &RequestError{Status: http.StatusBadRequest, Code: "21617", Message: "The concatenated message body exceeds the 1600 character limit."}
+	}
+
+	// A messaging service picks the sender later, so the message is
+	// accepted rather than queued
+	status := "queued"
+	if serviceSID != "" {
+		status = "accepted"
+	}
+	sms := &types.SMS{
+		From:      form.Get("From"),
+		To:        to,
+		Body:      body,
+		MediaURLs: media,
+		Metadata:  map[string]string{},
+	}
+	if sendAt := form.Get("SendAt"); sendAt != "" && form.Get("ScheduleType") == "fixed" {
+		t, err := time.Parse(time.RFC3339, sendAt)
+		if err != nil {
+			return nil, &RequestError{Status: http.StatusBadRequest, Code: "35111", Message: "SendAt time is not in ISO-8601 format."}
+		}
+		t = t.UTC()
+		sms.ScheduledAt = &t
+		status = "scheduled"
+	}
+
+	now := time.Now().UTC()
+	accountSID := r.PathValue("AccountSid")
+	msg := twilioMessage{
+		SID:         newTwilioSID("SM"),
+		AccountSID:  accountSID,
+		To:          to,
+		Body:        body,
+		Status:      status,
+		NumSegments: strconv.Itoa(smsSegments(body)),
+		NumMedia:    strconv.Itoa(len(media)),
+		Direction:   "outbound-api",
+		APIVersion:  "2010-04-01",
+		PriceUnit:   "USD",
+		DateCreated: now.Format(time.RFC1123Z),
+		DateUpdated: now.Format(time.RFC1123Z),
+	}
+	msg.URI = "/2010-04-01/Accounts/" + accountSID + "/Messages/" + msg.SID + ".json"
+	msg.SubresourceURIs = map[string]string{
+		"media": "/2010-04-01/Accounts/" + accountSID + "/Messages/" + msg.SID + "/Media.json",
+	}
+	if sms.From != "" {
+		msg.From = &sms.From
+	}
+	if serviceSID != "" {
+		msg.MessagingServiceSID = &serviceSID
+	}
+
+	sms.CreatedAt = now
+	sms.Metadata["messageId"] = msg.SID
+	sms.Metadata["accountSid"] = accountSID
+	for _, param := range []string{"MessagingServiceSid", "StatusCallback", "ContentSid", "ContentVariables"} {
+		if v := form.Get(param); v != "" {
+			sms.Metadata[strings.ToLower(param[:1])+param[1:]] = v
+		}
+	}
+	return []Message{{SMS: sms, Result: msg}}, nil
+}
+
+// respondTwilioMessage answers 201 with the message resource
+func respondTwilioMessage(w http.ResponseWriter, r *http.Request, messages []Message) {
+	writeJSON(w, http.StatusCreated, messages[0].Result)
+}
+
+// smsSegments returns the number of SMS segments a body is split into:
+// 160 characters (153 when concatenated) for GSM-7 text, 70 (67) otherwise.
+// Any non-ASCII character is treated as requiring UCS-2.
+func smsSegments(body string) int {
+	single, multi := 160, 153
+	for _, r := range body {
+		if r >= utf8.RuneSelf {
+			single, multi = 70, 67
+			break
+		}
+	}
+	n := utf8.RuneCountInString(body)
+	if n <= single {
+		return 1
+	}
+	return (n + multi - 1) / multi
+}
+
+// newTwilioSID returns a 34 character SID with the given two letter prefix
+func newTwilioSID(prefix string) string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
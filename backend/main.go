@@ -9,6 +9,9 @@ import (
 	"strings"
 
 	"github.com/appaka/resendpit/handlers"
+	"github.com/appaka/resendpit/smtp"
+	"github.com/appaka/resendpit/sns"
+	"github.com/appaka/resendpit/store"
 )
 
 //go:embed static/*
@@ -24,16 +27,41 @@ func main() {
 		os.Exit(0)
 	}
 
+	events := store.NewBroadcaster()
+	mem := store.NewMemory(store.RetentionPolicy(), events)
+	for _, cfg := range store.MailboxConfigs() {
+		mem.ConfigureMailbox(cfg)
+	}
+	mem.LimitTotalBytes(store.TotalMaxBytes())
+	if threshold := store.SpillThreshold(); threshold > 0 {
+		if err := mem.EnableSpill(store.SpillDir(), threshold); err != nil {
+			log.Fatalf("Failed to enable RESENDPIT_SPILL_THRESHOLD: %v", err)
+		}
+	}
+	var st store.Store = mem
+	if dir := store.DataDir(); dir != "" {
+		disk, err := store.OpenDisk(dir, mem)
+		if err != nil {
+			log.Fatalf("Failed to open data directory: %v", err)
+		}
+		log.Printf("Persisting emails to %s (%d restored)", dir, disk.GetEmailCount())
+		st = disk
+	}
+	srv := handlers.NewServer(st, events)
+	store.StartJanitor(st)
+
 	mux := http.NewServeMux()
 
 	// API routes
-	mux.HandleFunc("/emails", handlers.PostEmails)
-	mux.HandleFunc("/api/emails", handlers.APIEmails)
-	mux.HandleFunc("/api/events", handlers.Events)
-	mux.HandleFunc("/api/health", handlers.Health)
-
-	// SES v2 route
-	mux.HandleFunc("/v2/email/outbound-emails", handlers.PostSESv2Email)
+	mux.HandleFunc("/api/emails", srv.APIEmails)
+	mux.HandleFunc("/api/emails/{id}", srv.APIEmail)
+	mux.HandleFunc("/api/emails/{id}/events", srv.APIEmailEvents)
+	mux.HandleFunc("/api/mailboxes", srv.APIMailboxes)
+	mux.HandleFunc("/api/mailboxes/{name}/emails", srv.APIMailboxEmails)
+	mux.HandleFunc("/api/mailboxes/{name}/events", srv.MailboxEvents)
+	mux.HandleFunc("/api/sms", srv.APISMS)
+	mux.HandleFunc("/api/events", srv.Events)
+	mux.HandleFunc("/api/health", srv.Health)
 
 	// Serve embedded static files
 	staticFS, err := fs.Sub(staticFiles, "static")
@@ -41,22 +69,31 @@ func main() {
 		log.Fatal(err)
 	}
 
-	// SPA handler with SES v1 detection: form-encoded POST to / is SES v1
-	spa := spaHandler(http.FS(staticFS))
-	mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPost && r.URL.Path == "/" &&
-			strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
-			handlers.PostSESv1Email(w, r)
-			return
-		}
-		spa.ServeHTTP(w, r)
-	}))
+	// Provider routes; everything they do not take is the SPA
+	srv.RegisterProviders(mux, spaHandler(http.FS(staticFS)))
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "3000"
 	}
 
+	if sns.Enabled() {
+		log.Printf("SNS notifications will be delivered to %s", sns.Endpoint())
+	}
+
+	if smtp.Enabled() {
+		go func() {
+			log.Printf("SMTP server listening on :%s", smtp.Port())
+			log.Fatal(smtp.ListenAndServe(srv.CaptureSMTPMessage))
+		}()
+	}
+	if smtp.TLSEnabled() {
+		go func() {
+			log.Printf("SMTP server listening for implicit TLS on :%s", smtp.TLSPort())
+			log.Fatal(smtp.ListenAndServeTLS(srv.CaptureSMTPMessage))
+		}()
+	}
+
 	log.Printf("Resend-Pit listening on :%s", port)
 	log.Fatal(http.ListenAndServe(":"+port, mux))
 }
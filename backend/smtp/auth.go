@@ -0,0 +1,186 @@
+package smtp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// authMechanisms are advertised in the EHLO response
+const authMechanisms = "PLAIN LOGIN CRAM-MD5"
+
+// credentials are the accepted username/password pairs. When empty, any
+// credentials are accepted.
+var credentials map[string]string
+
+// parseCredentials parses "user:pass,user2:pass2"
+func parseCredentials(s string) map[string]string {
+	result := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		user, pass, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if ok && user != "" {
+			result[user] = pass
+		}
+	}
+	return result
+}
+
+// checkPassword reports whether the password is valid for the user
+func checkPassword(user, pass string) bool {
+	if len(credentials) == 0 {
+		return true
+	}
+	expected, ok := credentials[user]
+	return ok && subtle.ConstantTimeCompare([]byte(expected), []byte(pass)) == 1
+}
+
+// checkCRAMMD5 reports whether digest is HMAC-MD5(password, challenge)
+func checkCRAMMD5(user, digest, challenge string) bool {
+	if len(credentials) == 0 {
+		return true
+	}
+	pass, ok := credentials[user]
+	if !ok {
+		return false
+	}
+	mac := hmac.New(md5.New, []byte(pass))
+	mac.Write([]byte(challenge))
+	return hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(strings.ToLower(digest)))
+}
+
+func (s *session) handleAuth(arg string) {
+	if s.helo == "" {
+		s.reply(503, "5.5.1 Send EHLO first")
+		return
+	}
+	if s.username != "" {
+		s.reply(503, "5.5.1 Already authenticated")
+		return
+	}
+	if s.inTransaction {
+		s.reply(503, "5.5.1 AUTH not permitted during a mail transaction")
+		return
+	}
+
+	mechanism, initial, _ := strings.Cut(arg, " ")
+	var user string
+	var ok bool
+	var err error
+	switch strings.ToUpper(mechanism) {
+	case "PLAIN":
+		user, ok, err = s.authPlain(strings.TrimSpace(initial))
+	case "LOGIN":
+		user, ok, err = s.authLogin(strings.TrimSpace(initial))
+	case "CRAM-MD5":
+		user, ok, err = s.authCRAMMD5()
+	default:
+		s.reply(504, "5.5.4 Unrecognized authentication type")
+		return
+	}
+	if err != nil {
+		s.reply(501, "5.5.2 "+err.Error())
+		return
+	}
+	if !ok {
+		s.reply(535, "5.7.8 Authentication credentials invalid")
+		return
+	}
+	s.username = user
+	s.reply(235, "2.7.0 Authentication successful")
+}
+
+// authPlain implements RFC 4616: authzid NUL authcid NUL passwd
+func (s *session) authPlain(initial string) (string, bool, error) {
+	if initial == "" {
+		var err error
+		if initial, err = s.challenge(""); err != nil {
+			return "", false, err
+		}
+	}
+	decoded, err := decodeAuthResponse(initial)
+	if err != nil {
+		return "", false, err
+	}
+	parts := bytes.Split(decoded, []byte{0})
+	if len(parts) != 3 {
+		return "", false, errors.New("invalid PLAIN response")
+	}
+	user, pass := string(parts[1]), string(parts[2])
+	return user, checkPassword(user, pass), nil
+}
+
+// authLogin implements the LOGIN mechanism: username and password are
+// requested one after the other
+func (s *session) authLogin(initial string) (string, bool, error) {
+	var err error
+	if initial == "" {
+		if initial, err = s.challenge("Username:"); err != nil {
+			return "", false, err
+		}
+	}
+	user, err := decodeAuthResponse(initial)
+	if err != nil {
+		return "", false, err
+	}
+	response, err := s.challenge("Password:")
+	if err != nil {
+		return "", false, err
+	}
+	pass, err := decodeAuthResponse(response)
+	if err != nil {
+		return "", false, err
+	}
+	return string(user), checkPassword(string(user), string(pass)), nil
+}
+
+// authCRAMMD5 implements RFC 2195: the client answers "user digest"
+func (s *session) authCRAMMD5() (string, bool, error) {
+	nonce := make([]byte, 8)
+	rand.Read(nonce)
+	challenge := fmt.Sprintf("<%x.%d@%s>", nonce, time.Now().Unix(), hostname)
+	response, err := s.challenge(challenge)
+	if err != nil {
+		return "", false, err
+	}
+	decoded, err := decodeAuthResponse(response)
+	if err != nil {
+		return "", false, err
+	}
+	user, digest, ok := strings.Cut(string(decoded), " ")
+	if !ok {
+		return "", false, errors.New("invalid CRAM-MD5 response")
+	}
+	return user, checkCRAMMD5(user, digest, challenge), nil
+}
+
+// challenge sends a 334 continuation and reads the client's response
+func (s *session) challenge(text string) (string, error) {
+	s.reply(334, base64.StdEncoding.EncodeToString([]byte(text)))
+	if err := s.writer.Flush(); err != nil {
+		return "", err
+	}
+	line, err := s.readLine()
+	if err != nil {
+		return "", err
+	}
+	if line == "*" {
+		return "", errors.New("authentication cancelled")
+	}
+	return line, nil
+}
+
+func decodeAuthResponse(s string) ([]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid base64 data")
+	}
+	return decoded, nil
+}
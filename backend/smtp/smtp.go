@@ -0,0 +1,443 @@
+// Package smtp implements a minimal ESMTP server (RFC 5321) that accepts
+// every message and hands it to a capture handler. It advertises
+// PIPELINING, 8BITMIME, SIZE, STARTTLS and AUTH, and can also listen for
+// implicit TLS connections.
+package smtp
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/appaka/resendpit/config"
+)
+
+const (
+	hostname       = "resendpit"
+	commandTimeout = 5 * time.Minute
+	maxRecipients  = 1000
+)
+
+// Envelope describes how a message was submitted
+type Envelope struct {
+	From string
+	To   []string
+	// Username is the authenticated user, empty without AUTH
+	Username string
+	TLS      bool
+}
+
+// Handler receives each accepted message with its envelope
+type Handler func(envelope Envelope, data []byte) error
+
+var (
+	port     string
+	tlsPort  string
+	certFile string
+	keyFile  string
+)
+
+func init() {
+	port = os.Getenv("RESENDPIT_SMTP_PORT")
+	tlsPort = os.Getenv("RESENDPIT_SMTP_TLS_PORT")
+	certFile = os.Getenv("RESENDPIT_SMTP_TLS_CERT")
+	keyFile = os.Getenv("RESENDPIT_SMTP_TLS_KEY")
+
+	if auth := os.Getenv("RESENDPIT_SMTP_AUTH"); auth != "" {
+		credentials = parseCredentials(auth)
+	}
+}
+
+// Enabled reports whether the SMTP listener is configured
+func Enabled() bool {
+	return port != ""
+}
+
+// Port returns the configured SMTP port
+func Port() string {
+	return port
+}
+
+// TLSEnabled reports whether the implicit TLS listener is configured
+func TLSEnabled() bool {
+	return tlsPort != ""
+}
+
+// TLSPort returns the configured implicit TLS port
+func TLSPort() string {
+	return tlsPort
+}
+
+// AuthRequired reports whether a credential list is configured, in which
+// case clients must authenticate before sending
+func AuthRequired() bool {
+	return len(credentials) > 0
+}
+
+// ListenAndServe accepts SMTP connections on the configured port. It fails
+// if the TLS configuration offered with STARTTLS is invalid.
+func ListenAndServe(handler Handler) error {
+	if _, err := TLSConfig(); err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return err
+	}
+	return Serve(ln, handler)
+}
+
+// ListenAndServeTLS accepts implicit TLS (SMTPS) connections on the
+// configured TLS port
+func ListenAndServeTLS(handler Handler) error {
+	config, err := TLSConfig()
+	if err != nil {
+		return err
+	}
+	ln, err := tls.Listen("tcp", ":"+tlsPort, config)
+	if err != nil {
+		return err
+	}
+	return Serve(ln, handler)
+}
+
+// Serve accepts SMTP connections on ln until it is closed
+func Serve(ln net.Listener, handler Handler) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go newSession(conn, handler).serve()
+	}
+}
+
+// session is the state of one SMTP connection
+type session struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	writer  *bufio.Writer
+	handler Handler
+
+	helo     string
+	tls      bool
+	username string
+	from     string
+	to       []string
+	// inTransaction is set by MAIL FROM, which may carry an empty reverse path
+	inTransaction bool
+}
+
+func newSession(conn net.Conn, handler Handler) *session {
+	_, isTLS := conn.(*tls.Conn)
+	return &session{
+		conn:    conn,
+		reader:  bufio.NewReader(conn),
+		writer:  bufio.NewWriter(conn),
+		handler: handler,
+		tls:     isTLS,
+	}
+}
+
+func (s *session) serve() {
+	defer s.conn.Close()
+
+	s.reply(220, hostname+" ESMTP Resend-Pit")
+	for {
+		// With PIPELINING a client sends several commands at once: replies
+		// are only flushed when no more input is waiting
+		if s.reader.Buffered() == 0 {
+			if err := s.writer.Flush(); err != nil {
+				return
+			}
+		}
+
+		s.conn.SetDeadline(time.Now().Add(commandTimeout))
+		line, err := s.readLine()
+		if err != nil {
+			if errors.Is(err, errLineTooLong) {
+				s.reply(500, "5.5.6 Line too long")
+				continue
+			}
+			return
+		}
+
+		verb, arg, _ := strings.Cut(line, " ")
+		arg = strings.TrimSpace(arg)
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			s.handleHello(arg, true)
+		case "HELO":
+			s.handleHello(arg, false)
+		case "MAIL":
+			s.handleMail(arg)
+		case "RCPT":
+			s.handleRcpt(arg)
+		case "DATA":
+			s.handleData()
+		case "STARTTLS":
+			if !s.handleStartTLS() {
+				return
+			}
+		case "AUTH":
+			s.handleAuth(arg)
+		case "RSET":
+			s.reset()
+			s.reply(250, "2.0.0 OK")
+		case "NOOP":
+			s.reply(250, "2.0.0 OK")
+		case "VRFY":
+			s.reply(252, "2.5.0 Cannot VRFY user, but will accept message")
+		case "HELP":
+			s.reply(214, "2.0.0 Resend-Pit captures every message it receives")
+		case "QUIT":
+			s.reply(221, "2.0.0 Bye")
+			s.writer.Flush()
+			return
+		default:
+			s.reply(502, "5.5.2 Command not recognized")
+		}
+	}
+}
+
+func (s *session) handleHello(arg string, extended bool) {
+	if arg == "" {
+		s.reply(501, "5.5.4 Domain name required")
+		return
+	}
+	s.reset()
+	s.helo = arg
+
+	if !extended {
+		s.reply(250, hostname)
+		return
+	}
+	lines := []string{
+		hostname + " greets " + arg,
+		"PIPELINING",
+		"8BITMIME",
+		"SIZE " + strconv.Itoa(config.MaxMessageSize),
+		"ENHANCEDSTATUSCODES",
+	}
+	if !s.tls {
+		lines = append(lines, "STARTTLS")
+	}
+	if s.username == "" {
+		lines = append(lines, "AUTH "+authMechanisms)
+	}
+	s.reply(250, lines...)
+}
+
+// handleStartTLS upgrades the connection (RFC 3207). It returns false when
+// the session cannot continue.
+func (s *session) handleStartTLS() bool {
+	if s.tls {
+		s.reply(503, "5.5.1 TLS already active")
+		return true
+	}
+	config, err := TLSConfig()
+	if err != nil {
+		log.Printf("SMTP: TLS unavailable: %v", err)
+		s.reply(454, "4.7.0 TLS not available")
+		return true
+	}
+	s.reply(220, "2.0.0 Ready to start TLS")
+	if err := s.writer.Flush(); err != nil {
+		return false
+	}
+
+	conn := tls.Server(s.conn, config)
+	s.conn.SetDeadline(time.Now().Add(commandTimeout))
+	if err := conn.Handshake(); err != nil {
+		return false
+	}
+
+	// The client must start over with EHLO, and anything pipelined after
+	// STARTTLS is discarded (RFC 3207 section 4.2)
+	s.conn = conn
+	s.reader = bufio.NewReader(conn)
+	s.writer = bufio.NewWriter(conn)
+	s.tls = true
+	s.helo = ""
+	s.username = ""
+	s.reset()
+	return true
+}
+
+func (s *session) handleMail(arg string) {
+	if s.helo == "" {
+		s.reply(503, "5.5.1 Send HELO/EHLO first")
+		return
+	}
+	if s.inTransaction {
+		s.reply(503, "5.5.1 Sender already specified")
+		return
+	}
+	if AuthRequired() && s.username == "" {
+		s.reply(530, "5.7.0 Authentication required")
+		return
+	}
+	path, params, ok := parsePath(arg, "FROM:")
+	if !ok {
+		s.reply(501, "5.5.4 Syntax: MAIL FROM:<address>")
+		return
+	}
+	for _, param := range params {
+		key, value, _ := strings.Cut(param, "=")
+		switch strings.ToUpper(key) {
+		case "SIZE":
+			size, err := strconv.Atoi(value)
+			if err != nil {
+				s.reply(501, "5.5.4 Invalid SIZE parameter")
+				return
+			}
+			if size > config.MaxMessageSize {
+				s.reply(552, "5.3.4 Message size exceeds fixed limit")
+				return
+			}
+		case "BODY":
+			if v := strings.ToUpper(value); v != "7BIT" && v != "8BITMIME" {
+				s.reply(501, "5.5.4 Unsupported BODY parameter")
+				return
+			}
+		case "AUTH":
+			// RFC 4954 submitter identity, not needed to capture the message
+		default:
+			s.reply(555, "5.5.4 Unsupported parameter "+key)
+			return
+		}
+	}
+
+	s.from = path
+	s.inTransaction = true
+	s.reply(250, "2.1.0 OK")
+}
+
+func (s *session) handleRcpt(arg string) {
+	if !s.inTransaction {
+		s.reply(503, "5.5.1 Send MAIL first")
+		return
+	}
+	path, _, ok := parsePath(arg, "TO:")
+	if !ok || path == "" {
+		s.reply(501, "5.5.4 Syntax: RCPT TO:<address>")
+		return
+	}
+	if len(s.to) >= maxRecipients {
+		s.reply(452, "4.5.3 Too many recipients")
+		return
+	}
+	s.to = append(s.to, path)
+	s.reply(250, "2.1.5 OK")
+}
+
+func (s *session) handleData() {
+	if !s.inTransaction {
+		s.reply(503, "5.5.1 Send MAIL first")
+		return
+	}
+	if len(s.to) == 0 {
+		s.reply(554, "5.5.1 No valid recipients")
+		return
+	}
+	s.reply(354, "End data with <CR><LF>.<CR><LF>")
+	if err := s.writer.Flush(); err != nil {
+		return
+	}
+
+	s.conn.SetDeadline(time.Now().Add(commandTimeout))
+	dot := textproto.NewReader(s.reader).DotReader()
+	data, err := io.ReadAll(io.LimitReader(dot, config.MaxMessageSize+1))
+	if err != nil {
+		s.reset()
+		return
+	}
+	if len(data) > config.MaxMessageSize {
+		io.Copy(io.Discard, dot)
+		s.reset()
+		s.reply(552, "5.3.4 Message size exceeds fixed limit")
+		return
+	}
+
+	envelope := Envelope{From: s.from, To: s.to, Username: s.username, TLS: s.tls}
+	if err := s.handler(envelope, data); err != nil {
+		log.Printf("SMTP: failed to capture message: %v", err)
+		s.reset()
+		s.reply(451, "4.3.0 Failed to store message")
+		return
+	}
+	s.reset()
+	s.reply(250, "2.0.0 OK: queued")
+}
+
+// reset aborts the current mail transaction
+func (s *session) reset() {
+	s.from = ""
+	s.to = nil
+	s.inTransaction = false
+}
+
+// reply writes a (possibly multiline) response
+func (s *session) reply(code int, lines ...string) {
+	for i, line := range lines {
+		sep := "-"
+		if i == len(lines)-1 {
+			sep = " "
+		}
+		fmt.Fprintf(s.writer, "%d%s%s\r\n", code, sep, line)
+	}
+}
+
+var errLineTooLong = errors.New("line too long")
+
+// readLine reads a command line, limited to 1000 octets by RFC 5321
+func (s *session) readLine() (string, error) {
+	line, err := s.reader.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		for errors.Is(err, bufio.ErrBufferFull) {
+			_, err = s.reader.ReadSlice('\n')
+		}
+		if err != nil {
+			return "", err
+		}
+		return "", errLineTooLong
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(line) > 1000 {
+		return "", errLineTooLong
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// parsePath parses "FROM:<path> PARAM=VALUE ..." (or "TO:") and returns the
+// address without angle brackets and the ESMTP parameters
+func parsePath(arg, prefix string) (string, []string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", nil, false
+	}
+	fields := strings.Fields(strings.TrimSpace(arg[len(prefix):]))
+	if len(fields) == 0 {
+		return "", nil, false
+	}
+	path := fields[0]
+	if !strings.HasPrefix(path, "<") || !strings.HasSuffix(path, ">") {
+		return "", nil, false
+	}
+	path = path[1 : len(path)-1]
+	// Drop a source route (RFC 5321 section 4.1.2)
+	if i := strings.Index(path, ":"); i >= 0 && strings.HasPrefix(path, "@") {
+		path = path[i+1:]
+	}
+	return path, fields[1:], true
+}
@@ -0,0 +1,65 @@
+package smtp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	tlsOnce   sync.Once
+	tlsConfig *tls.Config
+	tlsErr    error
+)
+
+// TLSConfig returns the server TLS configuration, loading the certificate
+// from RESENDPIT_SMTP_TLS_CERT/RESENDPIT_SMTP_TLS_KEY or generating a
+// self-signed one on first use. Setting only one of them is an error.
+func TLSConfig() (*tls.Config, error) {
+	tlsOnce.Do(func() {
+		var cert tls.Certificate
+		switch {
+		case certFile != "" && keyFile != "":
+			cert, tlsErr = tls.LoadX509KeyPair(certFile, keyFile)
+		case certFile != "" || keyFile != "":
+			tlsErr = errors.New("RESENDPIT_SMTP_TLS_CERT and RESENDPIT_SMTP_TLS_KEY must be set together")
+		default:
+			cert, tlsErr = generateCertificate()
+		}
+		if tlsErr == nil {
+			tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		}
+	})
+	return tlsConfig, tlsErr
+}
+
+// generateCertificate creates a self-signed certificate for localhost
+func generateCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: hostname},
+		DNSNames:     []string{hostname, "localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(10, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
@@ -0,0 +1,103 @@
+package sns
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+// signingCertPath is where the signing certificate is served
+const signingCertPath = "/sns/SimpleNotificationService.pem"
+
+var (
+	signerOnce sync.Once
+	signerKey  *rsa.PrivateKey
+	signerCert []byte
+	signerErr  error
+)
+
+// SigningCertPath returns the path the signing certificate should be served on
+func SigningCertPath() string {
+	return signingCertPath
+}
+
+// SigningCert returns the PEM-encoded self-signed certificate used to sign
+// messages, generating it on first use
+func SigningCert() ([]byte, error) {
+	signerOnce.Do(generateSigner)
+	return signerCert, signerErr
+}
+
+func generateSigner() {
+	signerKey, signerErr = rsa.GenerateKey(rand.Reader, 2048)
+	if signerErr != nil {
+		return
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "sns.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(10, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &signerKey.PublicKey, signerKey)
+	if err != nil {
+		signerErr = err
+		return
+	}
+	signerCert = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// sign computes a SignatureVersion 1 (SHA1withRSA) signature over the
+// canonical string SNS defines for the message type
+func sign(msg *Message) error {
+	if _, err := SigningCert(); err != nil {
+		return err
+	}
+
+	var fields [][2]string
+	switch msg.Type {
+	case "Notification":
+		fields = [][2]string{{"Message", msg.Message}, {"MessageId", msg.MessageId}}
+		if msg.Subject != "" {
+			fields = append(fields, [2]string{"Subject", msg.Subject})
+		}
+		fields = append(fields,
+			[2]string{"Timestamp", msg.Timestamp},
+			[2]string{"TopicArn", msg.TopicArn},
+			[2]string{"Type", msg.Type})
+	default:
+		fields = [][2]string{
+			{"Message", msg.Message},
+			{"MessageId", msg.MessageId},
+			{"SubscribeURL", msg.SubscribeURL},
+			{"Timestamp", msg.Timestamp},
+			{"Token", msg.Token},
+			{"TopicArn", msg.TopicArn},
+			{"Type", msg.Type},
+		}
+	}
+
+	var sb strings.Builder
+	for _, f := range fields {
+		sb.WriteString(f[0] + "\n" + f[1] + "\n")
+	}
+
+	digest := sha1.Sum([]byte(sb.String()))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, signerKey, crypto.SHA1, digest[:])
+	if err != nil {
+		return err
+	}
+	msg.SignatureVersion = "1"
+	msg.Signature = base64.StdEncoding.EncodeToString(sig)
+	return nil
+}
@@ -0,0 +1,286 @@
+// Package sns emulates the Amazon SNS HTTP(S) delivery protocol towards a
+// single local subscriber endpoint, including the SubscriptionConfirmation
+// handshake and message signing.
+package sns
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appaka/resendpit/config"
+	"github.com/google/uuid"
+)
+
+// AccountID is the AWS account ID used in emulated ARNs
+const AccountID = "123456789012"
+
+// Notifications published before the subscription is confirmed are held,
+// up to maxPending per topic and for at most pendingTTL
+const (
+	maxPending = 100
+	pendingTTL = 10 * time.Minute
+)
+
+var (
+	endpoint string
+
+	client = &http.Client{Timeout: 10 * time.Second}
+	queue  = make(chan notification, 100)
+	// flush receives topics whose subscription was just confirmed
+	flush = make(chan string, 16)
+
+	subscriptionsMu sync.Mutex
+	subscriptions   = map[string]*subscription{}
+)
+
+// subscription is the emulated subscription of the endpoint to a topic
+type subscription struct {
+	arn       string
+	token     string
+	confirmed bool
+	// pending holds notifications until the subscription is confirmed
+	pending []notification
+}
+
+type notification struct {
+	topicArn string
+	message  string
+	queuedAt time.Time
+}
+
+// Message is an SNS HTTP(S) delivery message
+type Message struct {
+	Type             string `json:"Type"`
+	MessageId        string `json:"MessageId"`
+	Token            string `json:"Token,omitempty"`
+	TopicArn         string `json:"TopicArn"`
+	Subject          string `json:"Subject,omitempty"`
+	Message          string `json:"Message"`
+	SubscribeURL     string `json:"SubscribeURL,omitempty"`
+	Timestamp        string `json:"Timestamp"`
+	SignatureVersion string `json:"SignatureVersion"`
+	Signature        string `json:"Signature"`
+	SigningCertURL   string `json:"SigningCertURL"`
+	UnsubscribeURL   string `json:"UnsubscribeURL,omitempty"`
+}
+
+func init() {
+	endpoint = os.Getenv("RESENDPIT_SNS_ENDPOINT")
+
+	if endpoint != "" {
+		go deliver()
+	}
+}
+
+// Enabled reports whether a subscriber endpoint is configured
+func Enabled() bool {
+	return endpoint != ""
+}
+
+// Endpoint returns the configured subscriber endpoint
+func Endpoint() string {
+	return endpoint
+}
+
+// Publish queues a notification for the topic. Delivery happens in the
+// background, in publish order. The message is dropped if no endpoint is
+// configured.
+func Publish(topicArn, message string) {
+	if !Enabled() || topicArn == "" {
+		return
+	}
+	select {
+	case queue <- notification{topicArn: topicArn, message: message, queuedAt: time.Now()}:
+	default:
+		log.Printf("SNS: queue full, dropping notification for %s", topicArn)
+	}
+}
+
+// ConfirmSubscription confirms the pending subscription for a topic and
+// returns its ARN. It returns false if the token does not match.
+func ConfirmSubscription(topicArn, token string) (string, bool) {
+	subscriptionsMu.Lock()
+	defer subscriptionsMu.Unlock()
+	sub, ok := subscriptions[topicArn]
+	if !ok || sub.token != token {
+		return "", false
+	}
+	if !sub.confirmed {
+		sub.confirmed = true
+		select {
+		case flush <- topicArn:
+		default:
+			// The next notification for the topic flushes it
+		}
+	}
+	return sub.arn, true
+}
+
+// Unsubscribe removes the subscription with the given ARN. It returns false
+// if no such subscription exists.
+func Unsubscribe(subscriptionArn string) bool {
+	subscriptionsMu.Lock()
+	defer subscriptionsMu.Unlock()
+	for topicArn, sub := range subscriptions {
+		if sub.arn == subscriptionArn {
+			delete(subscriptions, topicArn)
+			return true
+		}
+	}
+	return false
+}
+
+// deliver posts queued notifications to the endpoint. A topic's first
+// notification creates its subscription and sends the SubscriptionConfirmation;
+// notifications are held until the subscriber confirms.
+func deliver() {
+	for {
+		select {
+		case n := <-queue:
+			sub := ensureSubscription(n.topicArn)
+			if hold(n) {
+				continue
+			}
+			deliverPending(n.topicArn)
+			send(sub, n)
+		case topicArn := <-flush:
+			deliverPending(topicArn)
+		}
+	}
+}
+
+// send posts a notification
+func send(sub subscription, n notification) {
+	msg := Message{
+		Type:           "Notification",
+		MessageId:      uuid.NewString(),
+		TopicArn:       n.topicArn,
+		Message:        n.message,
+		Timestamp:      timestamp(),
+		UnsubscribeURL: config.PublicURL() + "/?" + url.Values{"Action": {"Unsubscribe"}, "SubscriptionArn": {sub.arn}}.Encode(),
+	}
+	post(msg, sub.arn)
+}
+
+// hold adds a notification to the pending ones of its unconfirmed
+// subscription, dropping the oldest beyond maxPending. It returns false if
+// the subscription is confirmed.
+func hold(n notification) bool {
+	subscriptionsMu.Lock()
+	defer subscriptionsMu.Unlock()
+	sub, ok := subscriptions[n.topicArn]
+	if !ok || sub.confirmed {
+		return false
+	}
+	sub.pending = append(sub.pending, n)
+	if len(sub.pending) > maxPending {
+		sub.pending = sub.pending[1:]
+		log.Printf("SNS: subscription to %s not confirmed, dropping its oldest held notification", n.topicArn)
+	}
+	return true
+}
+
+// deliverPending posts the notifications held for a topic whose
+// subscription is confirmed, dropping those held longer than pendingTTL
+func deliverPending(topicArn string) {
+	subscriptionsMu.Lock()
+	sub, ok := subscriptions[topicArn]
+	if !ok || !sub.confirmed || len(sub.pending) == 0 {
+		subscriptionsMu.Unlock()
+		return
+	}
+	pending := sub.pending
+	sub.pending = nil
+	current := *sub
+	subscriptionsMu.Unlock()
+
+	for _, n := range pending {
+		if time.Since(n.queuedAt) > pendingTTL {
+			log.Printf("SNS: dropping notification for %s held longer than %s", topicArn, pendingTTL)
+			continue
+		}
+		send(current, n)
+	}
+}
+
+// ensureSubscription returns the subscription for a topic, creating it and
+// sending its SubscriptionConfirmation if needed. Only one confirmation is
+// sent per subscription.
+func ensureSubscription(topicArn string) subscription {
+	subscriptionsMu.Lock()
+	sub, ok := subscriptions[topicArn]
+	if !ok {
+		sub = &subscription{
+			arn:   topicArn + ":" + uuid.NewString(),
+			token: strings.ReplaceAll(uuid.NewString()+uuid.NewString(), "-", ""),
+		}
+		subscriptions[topicArn] = sub
+	}
+	current := *sub
+	subscriptionsMu.Unlock()
+
+	if ok {
+		return current
+	}
+
+	msg := Message{
+		Type:      "SubscriptionConfirmation",
+		MessageId: uuid.NewString(),
+		Token:     current.token,
+		TopicArn:  topicArn,
+		Message: "You have chosen to subscribe to the topic " + topicArn +
+			".\nTo confirm the subscription, visit the SubscribeURL included in this message.",
+		SubscribeURL: config.PublicURL() + "/?" + url.Values{
+			"Action":   {"ConfirmSubscription"},
+			"TopicArn": {topicArn},
+			"Token":    {current.token},
+		}.Encode(),
+		Timestamp: timestamp(),
+	}
+	post(msg, "")
+	return current
+}
+
+// post signs and delivers a message with the headers SNS sends
+func post(msg Message, subscriptionArn string) {
+	if err := sign(&msg); err != nil {
+		log.Printf("SNS: failed to sign message: %v", err)
+	}
+	msg.SigningCertURL = config.PublicURL() + signingCertPath
+
+	body, _ := json.Marshal(msg)
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("SNS: invalid endpoint %q: %v", endpoint, err)
+		return
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=UTF-8")
+	req.Header.Set("User-Agent", "Amazon Simple Notification Service Agent")
+	req.Header.Set("x-amz-sns-message-type", msg.Type)
+	req.Header.Set("x-amz-sns-message-id", msg.MessageId)
+	req.Header.Set("x-amz-sns-topic-arn", msg.TopicArn)
+	if subscriptionArn != "" {
+		req.Header.Set("x-amz-sns-subscription-arn", subscriptionArn)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("SNS: delivery to %s failed: %v", endpoint, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("SNS: delivery to %s returned %s", endpoint, resp.Status)
+	}
+}
+
+func timestamp() string {
+	return time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"sync"
+
+	"github.com/appaka/resendpit/types"
+)
+
+// Publisher receives the events of a store
+type Publisher interface {
+	Publish(msg types.SSEMessage)
+}
+
+// Broadcaster fans events out to SSE subscribers
+type Broadcaster struct {
+	mu          sync.RWMutex
+	subscribers []chan types.SSEMessage
+}
+
+// NewBroadcaster returns a broadcaster without subscribers
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{}
+}
+
+// Subscribe creates a new subscription channel
+func (b *Broadcaster) Subscribe() chan types.SSEMessage {
+	ch := make(chan types.SSEMessage, 10)
+	b.mu.Lock()
+	b.subscribers = append(b.subscribers, ch)
+	b.mu.Unlock()
+	return ch
+}
+
+// Unsubscribe removes a subscription channel
+func (b *Broadcaster) Unsubscribe(ch chan types.SSEMessage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, sub := range b.subscribers {
+		if sub == ch {
+			b.subscribers = append(b.subscribers[:i], b.subscribers[i+1:]...)
+			close(ch)
+			return
+		}
+	}
+}
+
+// Publish sends a message to all subscribers
+func (b *Broadcaster) Publish(msg types.SSEMessage) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, ch := range b.subscribers {
+		select {
+		case ch <- msg:
+		default:
+			// Channel full, skip (slow client)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package store
+
+import (
+	"time"
+
+	"github.com/appaka/resendpit/types"
+)
+
+// maxBulkEmails caps the bulk email requests kept; the oldest are dropped
+// first
+const maxBulkEmails = 10000
+
+// AddBulkEmail stores the status of a bulk email request
+func (m *Memory) AddBulkEmail(bulk types.BulkEmail) {
+	m.bulkEmailsMu.Lock()
+	defer m.bulkEmailsMu.Unlock()
+	if _, ok := m.bulkEmails[bulk.ID]; !ok {
+		m.bulkEmailIDs = append(m.bulkEmailIDs, bulk.ID)
+	}
+	m.bulkEmails[bulk.ID] = bulk
+	for len(m.bulkEmailIDs) > maxBulkEmails {
+		m.dropOldestBulkEmail()
+	}
+}
+
+// GetBulkEmail returns the bulk email request with the given ID
+func (m *Memory) GetBulkEmail(id string) (types.BulkEmail, bool) {
+	m.bulkEmailsMu.RLock()
+	defer m.bulkEmailsMu.RUnlock()
+	bulk, ok := m.bulkEmails[id]
+	return bulk, ok
+}
+
+// expireBulkEmails drops the bulk email requests created before cutoff
+func (m *Memory) expireBulkEmails(cutoff time.Time) {
+	m.bulkEmailsMu.Lock()
+	defer m.bulkEmailsMu.Unlock()
+	for len(m.bulkEmailIDs) > 0 && m.bulkEmails[m.bulkEmailIDs[0]].CreatedAt.Before(cutoff) {
+		m.dropOldestBulkEmail()
+	}
+}
+
+// dropOldestBulkEmail removes the bulk email request added first.
+// m.bulkEmailsMu must be held.
+func (m *Memory) dropOldestBulkEmail() {
+	delete(m.bulkEmails, m.bulkEmailIDs[0])
+	m.bulkEmailIDs = m.bulkEmailIDs[1:]
+}
@@ -0,0 +1,134 @@
+package store
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/appaka/resendpit/types"
+)
+
+// contactListEntry holds a contact list and its contacts, keyed by
+// lowercased email address
+type contactListEntry struct {
+	list     types.ContactList
+	contacts map[string]types.Contact
+}
+
+// AddContactList adds an SES contact list. It returns false if a contact list
+// with the same name already exists.
+func (m *Memory) AddContactList(list types.ContactList) bool {
+	m.sesMu.Lock()
+	defer m.sesMu.Unlock()
+	if _, ok := m.contactLists[list.Name]; ok {
+		return false
+	}
+	m.contactLists[list.Name] = &contactListEntry{list: list, contacts: map[string]types.Contact{}}
+	return true
+}
+
+// UpdateContactList replaces a contact list, keeping its contacts. It returns
+// false if the contact list does not exist.
+func (m *Memory) UpdateContactList(list types.ContactList) bool {
+	m.sesMu.Lock()
+	defer m.sesMu.Unlock()
+	entry, ok := m.contactLists[list.Name]
+	if !ok {
+		return false
+	}
+	entry.list = list
+	return true
+}
+
+// GetContactList returns the named SES contact list
+func (m *Memory) GetContactList(name string) (types.ContactList, bool) {
+	m.sesMu.RLock()
+	defer m.sesMu.RUnlock()
+	entry, ok := m.contactLists[name]
+	if !ok {
+		return types.ContactList{}, false
+	}
+	return entry.list, true
+}
+
+// GetContactLists returns all SES contact lists sorted by name
+func (m *Memory) GetContactLists() []types.ContactList {
+	m.sesMu.RLock()
+	defer m.sesMu.RUnlock()
+	result := make([]types.ContactList, 0, len(m.contactLists))
+	for _, entry := range m.contactLists {
+		result = append(result, entry.list)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// DeleteContactList removes a contact list and its contacts. It returns false
+// if the contact list does not exist.
+func (m *Memory) DeleteContactList(name string) bool {
+	m.sesMu.Lock()
+	defer m.sesMu.Unlock()
+	if _, ok := m.contactLists[name]; !ok {
+		return false
+	}
+	delete(m.contactLists, name)
+	return true
+}
+
+// PutContact adds or replaces a contact in a contact list. It returns false if
+// the contact list does not exist.
+func (m *Memory) PutContact(listName string, contact types.Contact) bool {
+	m.sesMu.Lock()
+	defer m.sesMu.Unlock()
+	entry, ok := m.contactLists[listName]
+	if !ok {
+		return false
+	}
+	entry.contacts[strings.ToLower(contact.EmailAddress)] = contact
+	return true
+}
+
+// GetContact returns a contact of a contact list
+func (m *Memory) GetContact(listName, address string) (types.Contact, bool) {
+	m.sesMu.RLock()
+	defer m.sesMu.RUnlock()
+	entry, ok := m.contactLists[listName]
+	if !ok {
+		return types.Contact{}, false
+	}
+	contact, ok := entry.contacts[strings.ToLower(address)]
+	return contact, ok
+}
+
+// GetContacts returns the contacts of a contact list sorted by email address.
+// It returns false if the contact list does not exist.
+func (m *Memory) GetContacts(listName string) ([]types.Contact, bool) {
+	m.sesMu.RLock()
+	defer m.sesMu.RUnlock()
+	entry, ok := m.contactLists[listName]
+	if !ok {
+		return nil, false
+	}
+	result := make([]types.Contact, 0, len(entry.contacts))
+	for _, contact := range entry.contacts {
+		result = append(result, contact)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].EmailAddress < result[j].EmailAddress })
+	return result, true
+}
+
+// DeleteContact removes a contact from a contact list. It returns false if
+// either does not exist.
+func (m *Memory) DeleteContact(listName, address string) bool {
+	m.sesMu.Lock()
+	defer m.sesMu.Unlock()
+	entry, ok := m.contactLists[listName]
+	if !ok {
+		return false
+	}
+	key := strings.ToLower(address)
+	if _, ok := entry.contacts[key]; !ok {
+		return false
+	}
+	delete(entry.contacts, key)
+	return true
+}
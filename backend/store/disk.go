@@ -0,0 +1,249 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/appaka/resendpit/types"
+)
+
+// emailLogFile is the name of the email log in the data directory
+const emailLogFile = "emails.log"
+
+// logRecord is a line of the email log
+type logRecord struct {
+	Op    string       `json:"op"`
+	Email *types.Email `json:"email,omitempty"`
+}
+
+// Disk is a Store that keeps captured emails in an append-only log in a
+// directory, so they survive restarts. Everything else is kept in memory.
+//
+// Every capture appends a line to the log and syncs it before the email is
+// stored. On startup the log is replayed; a torn last line (from a crash
+// mid-write) and undecodable records are dropped. The log is rewritten with only the kept emails when
+// evicted emails make up half of it, and when the emails are cleared.
+type Disk struct {
+	*Memory
+
+	logMu   sync.Mutex
+	dir     string
+	file    *os.File
+	records int
+}
+
+// OpenDisk opens or creates the email log in dir and replays it into mem,
+// which should be empty and have its mailboxes configured: each keeps the
+// emails its retention policy allows.
+func OpenDisk(dir string, mem *Memory) (*Disk, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	d := &Disk{Memory: mem, dir: dir}
+	records, err := d.replay()
+	if err != nil {
+		return nil, err
+	}
+	d.records = records
+
+	if d.records > d.GetEmailCount() {
+		// Evicted by a stricter retention policy, or torn
+		if err := d.compact(); err != nil {
+			return nil, err
+		}
+		return d, nil
+	}
+	d.file, err = os.OpenFile(d.path(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// AddEmail appends the email to the log, then stores it
+func (d *Disk) AddEmail(email types.Email) {
+	d.logMu.Lock()
+	defer d.logMu.Unlock()
+
+	if err := d.append(logRecord{Op: "add", Email: &email}); err != nil {
+		log.Printf("Failed to persist email %s: %v", email.ID, err)
+	} else {
+		d.records++
+	}
+	d.Memory.AddEmail(email)
+	d.compactIfEvicted()
+}
+
+// EvictExpired evicts the emails older than the maximum age at now
+func (d *Disk) EvictExpired(now time.Time) int {
+	d.logMu.Lock()
+	defer d.logMu.Unlock()
+
+	n := d.Memory.EvictExpired(now)
+	d.compactIfEvicted()
+	return n
+}
+
+// ClearEmails removes the emails of a mailbox (or all) and compacts the log
+func (d *Disk) ClearEmails(mailbox string) {
+	d.logMu.Lock()
+	defer d.logMu.Unlock()
+
+	d.Memory.ClearEmails(mailbox)
+	if err := d.compact(); err != nil {
+		log.Printf("Failed to compact %s: %v", d.path(), err)
+	}
+}
+
+// Close closes the log
+func (d *Disk) Close() error {
+	d.logMu.Lock()
+	defer d.logMu.Unlock()
+	if d.file == nil {
+		return nil
+	}
+	err := d.file.Close()
+	d.file = nil
+	return err
+}
+
+func (d *Disk) path() string {
+	return filepath.Join(d.dir, emailLogFile)
+}
+
+// replay loads the log into memory and returns the number of records read
+func (d *Disk) replay() (int, error) {
+	f, err := os.Open(d.path())
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	records := 0
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(bytes.TrimSpace(line)) > 0 {
+				// Torn write: count it so the log gets compacted
+				log.Printf("Dropping incomplete last record of %s", d.path())
+				records++
+			}
+			return records, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		records++
+
+		var rec logRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			// Skipped records are not stored, so the log gets compacted
+			// without them
+			log.Printf("Skipping undecodable record %d of %s: %v", records, d.path(), err)
+			continue
+		}
+		if rec.Op == "add" && rec.Email != nil {
+			d.Memory.AddEmail(*rec.Email)
+		}
+	}
+}
+
+// append writes a record to the log and syncs it
+func (d *Disk) append(rec logRecord) error {
+	if d.file == nil {
+		return os.ErrClosed
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := d.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return d.file.Sync()
+}
+
+// compactIfEvicted compacts the log once evicted emails make up half of it
+func (d *Disk) compactIfEvicted() {
+	kept := d.GetEmailCount()
+	if evicted := d.records - kept; evicted == 0 || evicted < kept {
+		return
+	}
+	if err := d.compact(); err != nil {
+		log.Printf("Failed to compact %s: %v", d.path(), err)
+	}
+}
+
+// compact rewrites the log with the stored emails, including their spilled
+// bodies. The new log is written to a temporary file and renamed over the old
+// one, so a crash leaves either. d.logMu must be held, so no spill file is
+// removed meanwhile.
+func (d *Disk) compact() error {
+	entries := d.entries()
+
+	tmp, err := os.CreateTemp(d.dir, emailLogFile+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	// Emails are stored newest first; the log is oldest first
+	for i := len(entries) - 1; i >= 0; i-- {
+		email := entries[i].load()
+		line, err := json.Marshal(logRecord{Op: "add", Email: &email})
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), d.path()); err != nil {
+		return err
+	}
+	syncDir(d.dir)
+
+	if d.file != nil {
+		d.file.Close()
+	}
+	d.file, err = os.OpenFile(d.path(), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		d.file = nil
+		return err
+	}
+	d.records = len(entries)
+	return nil
+}
+
+// syncDir makes a rename in dir durable
+func syncDir(dir string) {
+	if f, err := os.Open(dir); err == nil {
+		f.Sync()
+		f.Close()
+	}
+}
+
+var _ Store = (*Disk)(nil)
@@ -0,0 +1,260 @@
+package store
+
+import (
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/appaka/resendpit/types"
+)
+
+const (
+	// DefaultMailbox holds the emails not routed into another mailbox
+	DefaultMailbox = "default"
+	// AllMailboxes makes ClearEmails clear every mailbox
+	AllMailboxes = ""
+)
+
+// maxAutoMailboxes caps the mailboxes created for names that are not
+// configured (from the X-Resendpit-Mailbox header); emails for further ones
+// go to the default mailbox
+const maxAutoMailboxes = 100
+
+// mailboxName matches valid mailbox names
+var mailboxName = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// ValidMailboxName reports whether name can be used as a mailbox name
+func ValidMailboxName(name string) bool {
+	return mailboxName.MatchString(name)
+}
+
+// MailboxConfig configures a mailbox: the API keys and recipient domains
+// routed into it, and its retention policy
+type MailboxConfig struct {
+	Name string
+	// Keys are API keys (e.g. a Resend re_xxx key or an AWS access key ID)
+	Keys []string
+	// Domains match recipients at the domain or any of its subdomains
+	Domains   []string
+	Retention Retention
+}
+
+// MailboxInfo describes a mailbox
+type MailboxInfo struct {
+	Name      string
+	Emails    int
+	Bytes     int64
+	Retention Retention
+}
+
+// mailbox holds the emails routed into it, newest first
+type mailbox struct {
+	name      string
+	retention Retention
+	emails    []storedEmail
+	// bytes is the total size of emails
+	bytes int64
+}
+
+// mailbox returns the named mailbox, creating it with its configured (or
+// the default) retention policy. m.mu must be held.
+func (m *Memory) mailbox(name string) *mailbox {
+	if box, ok := m.mailboxes[name]; ok {
+		return box
+	}
+	box := &mailbox{name: name, retention: m.retention}
+	for _, cfg := range m.mailboxConfigs {
+		if cfg.Name == name {
+			box.retention = cfg.Retention
+		}
+	}
+	m.mailboxes[name] = box
+	return box
+}
+
+// admitMailbox returns name, or DefaultMailbox if name is neither configured
+// nor stored and maxAutoMailboxes mailboxes were already created. m.mu must be
+// held.
+func (m *Memory) admitMailbox(name string) string {
+	if _, ok := m.mailboxes[name]; ok || m.configured(name) {
+		return name
+	}
+	auto := 0
+	for existing := range m.mailboxes {
+		if existing != DefaultMailbox && !m.configured(existing) {
+			auto++
+		}
+	}
+	if auto >= maxAutoMailboxes {
+		log.Printf("Routing email for mailbox %s to %s: %d mailboxes already created", name, DefaultMailbox, auto)
+		return DefaultMailbox
+	}
+	return name
+}
+
+// configured reports whether name is a configured mailbox. m.mu must be held.
+func (m *Memory) configured(name string) bool {
+	for _, cfg := range m.mailboxConfigs {
+		if cfg.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// dropEmptyMailboxes removes the empty mailboxes that are not configured,
+// so they no longer count towards maxAutoMailboxes. m.mu must be held.
+func (m *Memory) dropEmptyMailboxes() {
+	for name, box := range m.mailboxes {
+		if len(box.emails) == 0 && name != DefaultMailbox && !m.configured(name) {
+			delete(m.mailboxes, name)
+		}
+	}
+}
+
+// ConfigureMailbox adds or replaces the configuration of a mailbox. It
+// applies to the emails captured from then on.
+func (m *Memory) ConfigureMailbox(cfg MailboxConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	replaced := false
+	for i := range m.mailboxConfigs {
+		if m.mailboxConfigs[i].Name == cfg.Name {
+			m.mailboxConfigs[i] = cfg
+			replaced = true
+		}
+	}
+	if !replaced {
+		m.mailboxConfigs = append(m.mailboxConfigs, cfg)
+	}
+	m.mailbox(cfg.Name).retention = cfg.Retention
+}
+
+// MailboxFor returns the configured mailbox for an API key or, failing
+// that, for the first recipient with a configured domain. It returns "" if
+// none matches.
+func (m *Memory) MailboxFor(apiKey string, recipients []string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if apiKey != "" {
+		for _, cfg := range m.mailboxConfigs {
+			for _, key := range cfg.Keys {
+				if key == apiKey {
+					return cfg.Name
+				}
+			}
+		}
+	}
+	for _, recipient := range recipients {
+		at := strings.LastIndex(recipient, "@")
+		if at < 0 {
+			continue
+		}
+		domain := strings.ToLower(strings.TrimRight(recipient[at+1:], ">"))
+		for _, cfg := range m.mailboxConfigs {
+			for _, d := range cfg.Domains {
+				d = strings.ToLower(d)
+				if domain == d || strings.HasSuffix(domain, "."+d) {
+					return cfg.Name
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// GetMailboxEmails returns a copy of the emails of a mailbox, newest first.
+// Spilled emails are marked as such and have no bodies.
+func (m *Memory) GetMailboxEmails(name string) []types.Email {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	box, ok := m.mailboxes[name]
+	if !ok {
+		return []types.Email{}
+	}
+	result := make([]types.Email, len(box.emails))
+	for i := range box.emails {
+		result[i] = box.emails[i].Email
+	}
+	return result
+}
+
+// GetMailboxes describes the mailboxes that are configured or hold emails,
+// sorted by name
+func (m *Memory) GetMailboxes() []MailboxInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := make([]MailboxInfo, 0, len(m.mailboxes))
+	for _, box := range m.mailboxes {
+		result = append(result, MailboxInfo{
+			Name:      box.name,
+			Emails:    len(box.emails),
+			Bytes:     box.bytes,
+			Retention: box.retention,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// parseMailboxes parses RESENDPIT_MAILBOXES: mailboxes separated by ";",
+// each a name, ":" and comma-separated options (key=, domain=, maxEmails=,
+// maxAge=, maxBytes=). Limits not given are those of defaults. A maxBytes
+// above totalMaxBytes, which it can never reach, is ignored.
+func parseMailboxes(env string, defaults Retention, totalMaxBytes int64) []MailboxConfig {
+	var configs []MailboxConfig
+	for _, spec := range strings.Split(env, ";") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		name, options, _ := strings.Cut(spec, ":")
+		name = strings.TrimSpace(name)
+		if !ValidMailboxName(name) {
+			log.Printf("Ignoring mailbox with invalid name %q", name)
+			continue
+		}
+		cfg := MailboxConfig{Name: name, Retention: defaults}
+		for _, option := range strings.Split(options, ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(option), "=")
+			value = strings.TrimSpace(value)
+			ok := true
+			switch key {
+			case "":
+				continue
+			case "key":
+				cfg.Keys = append(cfg.Keys, value)
+			case "domain":
+				cfg.Domains = append(cfg.Domains, strings.TrimPrefix(value, "@"))
+			case "maxEmails":
+				var n int
+				if n, ok = parseCount(value); ok {
+					cfg.Retention.MaxCount = n
+				}
+			case "maxAge":
+				var d time.Duration
+				if d, ok = parseAge(value); ok {
+					cfg.Retention.MaxAge = d
+				}
+			case "maxBytes":
+				var n int64
+				if n, ok = parseBytes(value); ok && totalMaxBytes > 0 && n > totalMaxBytes {
+					log.Printf("Ignoring maxBytes of mailbox %s: it is above RESENDPIT_TOTAL_MAX_BYTES and can never be reached", name)
+					continue
+				}
+				if ok {
+					cfg.Retention.MaxBytes = n
+				}
+			default:
+				ok = false
+			}
+			if !ok {
+				log.Printf("Ignoring invalid option %q of mailbox %s", option, name)
+			}
+		}
+		configs = append(configs, cfg)
+	}
+	return configs
+}
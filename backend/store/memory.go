@@ -0,0 +1,377 @@
+package store
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/appaka/resendpit/types"
+)
+
+// Memory is a Store that keeps everything in memory
+type Memory struct {
+	retention Retention
+	events    Publisher
+
+	mu        sync.RWMutex
+	mailboxes map[string]*mailbox
+	// mailboxConfigs are in the order they were configured, for routing
+	mailboxConfigs []MailboxConfig
+	// totalMaxBytes caps the size of all mailboxes together, if set
+	totalMaxBytes int64
+	spill         *spiller
+	spilledEmails int
+	spilledBytes  int64
+
+	smsMu       sync.RWMutex
+	smsMessages []types.SMS
+
+	sesMu             sync.RWMutex
+	identities        []types.Identity
+	sesRejects        []time.Time
+	configurationSets map[string]*types.ConfigurationSet
+	// suppressedDestinations is keyed by lowercased email address
+	suppressedDestinations map[string]types.SuppressedDestination
+	contactLists           map[string]*contactListEntry
+
+	templatesMu    sync.RWMutex
+	templates      map[int]types.Template
+	nextTemplateID int
+
+	recipientListsMu sync.RWMutex
+	recipientLists   map[string]types.RecipientList
+
+	rejectsMu sync.RWMutex
+	// rejects is keyed by lowercased email address
+	rejects map[string]types.Reject
+
+	operationsMu sync.Mutex
+	operations   map[string]types.Operation
+	// operationIDs are the keys of operations, oldest first
+	operationIDs []string
+
+	bulkEmailsMu sync.RWMutex
+	bulkEmails   map[string]types.BulkEmail
+	// bulkEmailIDs are the keys of bulkEmails, oldest first
+	bulkEmailIDs []string
+}
+
+// storedEmail is an email with its approximate size and when it was last
+// read (for LRU eviction). A spilled email has its bodies in a file.
+type storedEmail struct {
+	types.Email
+	size         int64
+	lastUsed     time.Time
+	spillPath    string
+	spilledBytes int64
+}
+
+// NewMemory returns an empty in-memory store. Each mailbox keeps the emails
+// retention allows unless configured otherwise; text messages are kept up to
+// its maximum count (or maxSMS) and age. Its events are sent to events, which
+// may be nil.
+func NewMemory(retention Retention, events Publisher) *Memory {
+	return &Memory{
+		retention:              retention,
+		events:                 events,
+		mailboxes:              map[string]*mailbox{},
+		configurationSets:      map[string]*types.ConfigurationSet{},
+		suppressedDestinations: map[string]types.SuppressedDestination{},
+		contactLists:           map[string]*contactListEntry{},
+		templates:              map[int]types.Template{},
+		nextTemplateID:         1,
+		recipientLists:         map[string]types.RecipientList{},
+		rejects:                map[string]types.Reject{},
+		operations:             map[string]types.Operation{},
+		bulkEmails:             map[string]types.BulkEmail{},
+	}
+}
+
+// AddEmail adds a new email to its mailbox (the default mailbox if it has
+// none, or if it would exceed maxAutoMailboxes), then evicts the emails the
+// mailbox's retention policy and the total size limit no longer allow
+func (m *Memory) AddEmail(email types.Email) {
+	if email.Mailbox == "" {
+		email.Mailbox = DefaultMailbox
+	}
+
+	// Large bodies are written out before m.mu is taken, so readers are not
+	// blocked on disk
+	m.mu.RLock()
+	spill := m.spill
+	m.mu.RUnlock()
+	spillPath := spill.write(email)
+
+	m.mu.Lock()
+	email.Mailbox = m.admitMailbox(email.Mailbox)
+	box := m.mailbox(email.Mailbox)
+	entry := storedEmail{Email: email, size: emailSize(email), lastUsed: time.Now()}
+	if spillPath != "" {
+		m.markSpilled(&entry, spillPath)
+	}
+	box.emails = append([]storedEmail{entry}, box.emails...)
+	box.bytes += entry.size
+	evicted := m.evict(box, time.Now())
+	evicted = append(evicted, m.evictTotalBytes(email.ID)...)
+	m.dropEmptyMailboxes()
+	m.mu.Unlock()
+
+	m.publish(types.SSEMessage{Type: "new-email", Email: &email})
+	m.publishEvictions(evicted)
+}
+
+// GetEmails returns a copy of all emails of all mailboxes, newest first.
+// Spilled emails are marked as such and have no bodies.
+func (m *Memory) GetEmails() []types.Email {
+	entries := m.entries()
+	result := make([]types.Email, len(entries))
+	for i := range entries {
+		result[i] = entries[i].Email
+	}
+	return result
+}
+
+// entries returns a copy of the stored emails of all mailboxes, newest first
+func (m *Memory) entries() []storedEmail {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var result []storedEmail
+	for _, box := range m.mailboxes {
+		result = append(result, box.emails...)
+	}
+	if len(m.mailboxes) > 1 {
+		sort.SliceStable(result, func(i, j int) bool {
+			return result[i].CreatedAt.After(result[j].CreatedAt)
+		})
+	}
+	return result
+}
+
+// GetEmail returns the email with the given ID, with its spilled bodies read
+// back, marking it as used
+func (m *Memory) GetEmail(id string) (types.Email, bool) {
+	m.mu.Lock()
+	var entry storedEmail
+	found := false
+	for _, box := range m.mailboxes {
+		for i := range box.emails {
+			if box.emails[i].ID == id {
+				box.emails[i].lastUsed = time.Now()
+				entry, found = box.emails[i], true
+			}
+		}
+	}
+	m.mu.Unlock()
+	if !found {
+		return types.Email{}, false
+	}
+	return entry.load(), true
+}
+
+// ClearEmails removes the emails of a mailbox, or of all mailboxes with
+// AllMailboxes
+func (m *Memory) ClearEmails(mailbox string) {
+	m.mu.Lock()
+	for name, box := range m.mailboxes {
+		if mailbox != AllMailboxes && name != mailbox {
+			continue
+		}
+		for _, entry := range box.emails {
+			m.unspill(entry)
+		}
+		box.emails = nil
+		box.bytes = 0
+	}
+	m.dropEmptyMailboxes()
+	m.mu.Unlock()
+
+	m.publish(types.SSEMessage{Type: "clear", Mailbox: mailbox})
+}
+
+// GetEmailCount returns the current number of emails in all mailboxes
+func (m *Memory) GetEmailCount() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n := 0
+	for _, box := range m.mailboxes {
+		n += len(box.emails)
+	}
+	return n
+}
+
+// GetMaxEmails returns the maximum number of emails kept per mailbox by
+// default, 0 if unlimited
+func (m *Memory) GetMaxEmails() int {
+	return m.retention.MaxCount
+}
+
+// GetRetention returns the default retention policy of mailboxes
+func (m *Memory) GetRetention() Retention {
+	return m.retention
+}
+
+// GetUsage returns how much the emails of all mailboxes take up
+func (m *Memory) GetUsage() Usage {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	usage := Usage{SpilledEmails: m.spilledEmails, SpilledBytes: m.spilledBytes}
+	for _, box := range m.mailboxes {
+		usage.Emails += len(box.emails)
+		usage.Bytes += box.bytes
+	}
+	return usage
+}
+
+// EvictExpired evicts the emails older than their mailbox's maximum age at
+// now. Text messages, send operations and bulk email requests older than the
+// default maximum age are dropped too.
+func (m *Memory) EvictExpired(now time.Time) int {
+	m.mu.Lock()
+	var evicted []eviction
+	for _, box := range m.mailboxes {
+		evicted = append(evicted, m.evict(box, now)...)
+	}
+	m.dropEmptyMailboxes()
+	m.mu.Unlock()
+
+	if maxAge := m.retention.MaxAge; maxAge > 0 {
+		m.expireSMS(now.Add(-maxAge))
+		m.expireOperations(now.Add(-maxAge))
+		m.expireBulkEmails(now.Add(-maxAge))
+	}
+	m.publishEvictions(evicted)
+	return len(evicted)
+}
+
+// eviction is an email evicted by the retention policy
+type eviction struct {
+	id      string
+	mailbox string
+	reason  string
+}
+
+// evict removes emails from a mailbox while a retention limit is exceeded:
+// the oldest (FIFO) or least recently used (LRU) for the count and size
+// limits, the oldest for the age limit. m.mu must be held.
+func (m *Memory) evict(box *mailbox, now time.Time) []eviction {
+	var evicted []eviction
+	r := box.retention
+	for n := len(box.emails); n > 0; n = len(box.emails) {
+		victim := n - 1
+		var reason string
+		switch {
+		case r.MaxCount > 0 && n > r.MaxCount:
+			reason, victim = EvictedByCount, box.evictionVictim()
+		case r.MaxBytes > 0 && box.bytes > r.MaxBytes && n > 1:
+			reason, victim = EvictedByBytes, box.evictionVictim()
+		case r.MaxAge > 0 && now.Sub(box.emails[victim].CreatedAt) > r.MaxAge:
+			reason = EvictedByAge
+		default:
+			return evicted
+		}
+		evicted = append(evicted, m.remove(box, victim, reason))
+	}
+	return evicted
+}
+
+// LimitTotalBytes caps the approximate total size of the emails of all
+// mailboxes, on top of their own limits; 0 (the default) lifts the cap
+func (m *Memory) LimitTotalBytes(n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.totalMaxBytes = n
+}
+
+// evictTotalBytes removes emails from any mailbox while the total size limit
+// is exceeded: the oldest (FIFO) or least recently used (LRU) across
+// mailboxes, but never newest, the email just added. m.mu must be held.
+func (m *Memory) evictTotalBytes(newest string) []eviction {
+	if m.totalMaxBytes <= 0 {
+		return nil
+	}
+	bytes := int64(0)
+	for _, box := range m.mailboxes {
+		bytes += box.bytes
+	}
+
+	var evicted []eviction
+	for bytes > m.totalMaxBytes {
+		box, victim := m.globalEvictionVictim(newest)
+		if box == nil {
+			break
+		}
+		bytes -= box.emails[victim].size
+		evicted = append(evicted, m.remove(box, victim, EvictedByBytes))
+	}
+	return evicted
+}
+
+// globalEvictionVictim returns the mailbox and index of the email to evict
+// for the store-wide limits, never the newest email, or nil if there is none.
+// m.mu must be held.
+func (m *Memory) globalEvictionVictim(newest string) (*mailbox, int) {
+	lru := m.retention.Eviction == EvictLRU
+	before := func(a, b *storedEmail) bool {
+		if lru {
+			return a.lastUsed.Before(b.lastUsed)
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+
+	var victimBox *mailbox
+	victim := -1
+	for _, box := range m.mailboxes {
+		for i := len(box.emails) - 1; i >= 0; i-- {
+			if box.emails[i].ID == newest {
+				continue
+			}
+			if victimBox == nil || before(&box.emails[i], &victimBox.emails[victim]) {
+				victimBox, victim = box, i
+			}
+			if !lru {
+				// The other emails of the mailbox are newer
+				break
+			}
+		}
+	}
+	return victimBox, victim
+}
+
+// remove removes the email at index i of a mailbox. m.mu must be held.
+func (m *Memory) remove(box *mailbox, i int, reason string) eviction {
+	entry := box.emails[i]
+	box.emails = append(box.emails[:i], box.emails[i+1:]...)
+	box.bytes -= entry.size
+	m.unspill(entry)
+	return eviction{id: entry.ID, mailbox: box.name, reason: reason}
+}
+
+// evictionVictim returns the index of the email to evict for the count or
+// size limit. The newest email is never picked.
+func (box *mailbox) evictionVictim() int {
+	victim := len(box.emails) - 1
+	if box.retention.Eviction != EvictLRU {
+		return victim
+	}
+	for i := victim - 1; i > 0; i-- {
+		if box.emails[i].lastUsed.Before(box.emails[victim].lastUsed) {
+			victim = i
+		}
+	}
+	return victim
+}
+
+// publishEvictions sends an evict-email event for each evicted email
+func (m *Memory) publishEvictions(evicted []eviction) {
+	for _, e := range evicted {
+		m.publish(types.SSEMessage{Type: "evict-email", ID: e.id, Mailbox: e.mailbox, Reason: e.reason})
+	}
+}
+
+func (m *Memory) publish(msg types.SSEMessage) {
+	if m.events != nil {
+		m.events.Publish(msg)
+	}
+}
+
+var _ Store = (*Memory)(nil)
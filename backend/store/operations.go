@@ -0,0 +1,57 @@
+package store
+
+import (
+	"time"
+
+	"github.com/appaka/resendpit/types"
+)
+
+// maxOperations caps the operations kept; the oldest are dropped first
+const maxOperations = 10000
+
+// AddOperation stores a send operation. It returns false, and the existing
+// operation, if one with the same ID was already added.
+func (m *Memory) AddOperation(op types.Operation) (types.Operation, bool) {
+	m.operationsMu.Lock()
+	defer m.operationsMu.Unlock()
+	if existing, ok := m.operations[op.ID]; ok {
+		return existing, false
+	}
+	m.operations[op.ID] = op
+	m.operationIDs = append(m.operationIDs, op.ID)
+	for len(m.operationIDs) > maxOperations {
+		m.dropOldestOperation()
+	}
+	return op, true
+}
+
+// expireOperations drops the operations created before cutoff
+func (m *Memory) expireOperations(cutoff time.Time) {
+	m.operationsMu.Lock()
+	defer m.operationsMu.Unlock()
+	for len(m.operationIDs) > 0 && m.operations[m.operationIDs[0]].CreatedAt.Before(cutoff) {
+		m.dropOldestOperation()
+	}
+}
+
+// dropOldestOperation removes the operation added first. m.operationsMu
+// must be held.
+func (m *Memory) dropOldestOperation() {
+	delete(m.operations, m.operationIDs[0])
+	m.operationIDs = m.operationIDs[1:]
+}
+
+// PollOperation returns the operation with the given ID and moves it from
+// Running to Succeeded, so the next poll sees it completed
+func (m *Memory) PollOperation(id string) (types.Operation, bool) {
+	m.operationsMu.Lock()
+	defer m.operationsMu.Unlock()
+	op, ok := m.operations[id]
+	if !ok {
+		return types.Operation{}, false
+	}
+	if op.Status == "Running" {
+		m.operations[id] = types.Operation{ID: op.ID, Status: "Succeeded", EmailID: op.EmailID, CreatedAt: op.CreatedAt}
+	}
+	return op, true
+}
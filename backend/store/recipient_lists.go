@@ -0,0 +1,63 @@
+package store
+
+import (
+	"sort"
+
+	"github.com/appaka/resendpit/types"
+)
+
+// AddRecipientList stores a recipient list. It returns false if a list with
+// the same ID already exists.
+func (m *Memory) AddRecipientList(list types.RecipientList) bool {
+	m.recipientListsMu.Lock()
+	defer m.recipientListsMu.Unlock()
+	if _, ok := m.recipientLists[list.ID]; ok {
+		return false
+	}
+	m.recipientLists[list.ID] = list
+	return true
+}
+
+// UpdateRecipientList replaces a recipient list. It returns false if the
+// list does not exist.
+func (m *Memory) UpdateRecipientList(list types.RecipientList) bool {
+	m.recipientListsMu.Lock()
+	defer m.recipientListsMu.Unlock()
+	if _, ok := m.recipientLists[list.ID]; !ok {
+		return false
+	}
+	m.recipientLists[list.ID] = list
+	return true
+}
+
+// GetRecipientList returns the recipient list with the given ID
+func (m *Memory) GetRecipientList(id string) (types.RecipientList, bool) {
+	m.recipientListsMu.RLock()
+	defer m.recipientListsMu.RUnlock()
+	list, ok := m.recipientLists[id]
+	return list, ok
+}
+
+// GetRecipientLists returns all recipient lists sorted by ID
+func (m *Memory) GetRecipientLists() []types.RecipientList {
+	m.recipientListsMu.RLock()
+	defer m.recipientListsMu.RUnlock()
+	result := make([]types.RecipientList, 0, len(m.recipientLists))
+	for _, list := range m.recipientLists {
+		result = append(result, list)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// DeleteRecipientList removes a recipient list. It returns false if it does
+// not exist.
+func (m *Memory) DeleteRecipientList(id string) bool {
+	m.recipientListsMu.Lock()
+	defer m.recipientListsMu.Unlock()
+	if _, ok := m.recipientLists[id]; !ok {
+		return false
+	}
+	delete(m.recipientLists, id)
+	return true
+}
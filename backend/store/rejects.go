@@ -0,0 +1,48 @@
+package store
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/appaka/resendpit/types"
+)
+
+// PutReject adds or replaces an address on the rejection denylist
+func (m *Memory) PutReject(reject types.Reject) {
+	m.rejectsMu.Lock()
+	defer m.rejectsMu.Unlock()
+	m.rejects[strings.ToLower(reject.Email)] = reject
+}
+
+// GetReject returns the denylist entry for an address
+func (m *Memory) GetReject(email string) (types.Reject, bool) {
+	m.rejectsMu.RLock()
+	defer m.rejectsMu.RUnlock()
+	reject, ok := m.rejects[strings.ToLower(email)]
+	return reject, ok
+}
+
+// GetRejects returns all denylist entries sorted by email address
+func (m *Memory) GetRejects() []types.Reject {
+	m.rejectsMu.RLock()
+	defer m.rejectsMu.RUnlock()
+	result := make([]types.Reject, 0, len(m.rejects))
+	for _, reject := range m.rejects {
+		result = append(result, reject)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Email < result[j].Email })
+	return result
+}
+
+// DeleteReject removes an address from the denylist. It returns false if
+// the address was not on it.
+func (m *Memory) DeleteReject(email string) bool {
+	m.rejectsMu.Lock()
+	defer m.rejectsMu.Unlock()
+	key := strings.ToLower(email)
+	if _, ok := m.rejects[key]; !ok {
+		return false
+	}
+	delete(m.rejects, key)
+	return true
+}
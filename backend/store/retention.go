@@ -0,0 +1,126 @@
+package store
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Retention limits the emails a store keeps. The oldest emails are evicted
+// as soon as any limit is exceeded; a zero limit is not enforced.
+type Retention struct {
+	// MaxAge evicts emails captured longer ago than this
+	MaxAge time.Duration
+	// MaxCount caps the number of emails
+	MaxCount int
+	// MaxBytes caps the approximate total size of the emails. The newest
+	// email is kept even when it is larger on its own.
+	MaxBytes int64
+	// Eviction picks the emails evicted for the count and size limits:
+	// EvictFIFO (the default) or EvictLRU
+	Eviction string
+}
+
+// Eviction policies
+const (
+	// EvictFIFO evicts the oldest email
+	EvictFIFO = "fifo"
+	// EvictLRU evicts the email read least recently (or, if never read,
+	// captured least recently)
+	EvictLRU = "lru"
+)
+
+// Eviction reasons, reported in evict-email events
+const (
+	EvictedByAge   = "age"
+	EvictedByCount = "count"
+	EvictedByBytes = "bytes"
+)
+
+// RetentionPolicy returns the retention configured with
+// RESENDPIT_MAX_AGE, RESENDPIT_MAX_EMAILS, RESENDPIT_MAX_BYTES and
+// RESENDPIT_EVICTION
+func RetentionPolicy() Retention {
+	return Retention{MaxAge: maxAge, MaxCount: maxEmails, MaxBytes: maxBytes, Eviction: evictionPolicy}
+}
+
+// parseCount parses a maximum number of emails; 0 means no limit
+func parseCount(s string) (int, bool) {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// parseAge parses a duration such as "90m", "72h" or "3d"
+func parseAge(s string) (time.Duration, bool) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil || n <= 0 {
+			return 0, false
+		}
+		return time.Duration(n * float64(24*time.Hour)), true
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, false
+	}
+	return d, true
+}
+
+// parseBytes parses a size in bytes, optionally with a KB, MB or GB suffix
+// (powers of 1024)
+func parseBytes(s string) (int64, bool) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	unit := int64(1)
+	for _, suffix := range []struct {
+		name string
+		size int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if rest, ok := strings.CutSuffix(s, suffix.name); ok {
+			s, unit = strings.TrimSpace(rest), suffix.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return n * unit, true
+}
+
+// janitorInterval returns how often expired emails are looked for: a
+// sixtieth of the maximum age, between a second and a minute
+func janitorInterval(maxAge time.Duration) time.Duration {
+	return min(max(maxAge/60, time.Second), time.Minute)
+}
+
+// StartJanitor evicts expired emails from st in the background until the
+// returned function is called. It does nothing unless a mailbox has a
+// maximum age.
+func StartJanitor(st Store) (stop func()) {
+	maxAge := st.GetRetention().MaxAge
+	for _, box := range st.GetMailboxes() {
+		if age := box.Retention.MaxAge; age > 0 && (maxAge <= 0 || age < maxAge) {
+			maxAge = age
+		}
+	}
+	if maxAge <= 0 {
+		return func() {}
+	}
+	ticker := time.NewTicker(janitorInterval(maxAge))
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case now := <-ticker.C:
+				st.EvictExpired(now)
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
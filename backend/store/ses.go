@@ -0,0 +1,210 @@
+package store
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/appaka/resendpit/types"
+)
+
+// sesStatsWindow is how far back SES send statistics are reported
+const sesStatsWindow = 14 * 24 * time.Hour
+
+// AddIdentity registers an SES identity. If the identity already exists, the
+// existing one is returned unchanged.
+func (m *Memory) AddIdentity(identity types.Identity) types.Identity {
+	m.sesMu.Lock()
+	defer m.sesMu.Unlock()
+	for _, existing := range m.identities {
+		if existing.Identity == identity.Identity {
+			return existing
+		}
+	}
+	m.identities = append(m.identities, identity)
+	return identity
+}
+
+// GetIdentity returns the SES identity with the given name
+func (m *Memory) GetIdentity(name string) (types.Identity, bool) {
+	m.sesMu.RLock()
+	defer m.sesMu.RUnlock()
+	for _, identity := range m.identities {
+		if identity.Identity == name {
+			return identity, true
+		}
+	}
+	return types.Identity{}, false
+}
+
+// GetIdentities returns a copy of all SES identities in creation order
+func (m *Memory) GetIdentities() []types.Identity {
+	m.sesMu.RLock()
+	defer m.sesMu.RUnlock()
+	result := make([]types.Identity, len(m.identities))
+	copy(result, m.identities)
+	return result
+}
+
+// RecordSESReject records a send rejected by the SES emulation
+func (m *Memory) RecordSESReject(at time.Time) {
+	m.sesMu.Lock()
+	defer m.sesMu.Unlock()
+	cutoff := at.Add(-sesStatsWindow)
+	kept := m.sesRejects[:0]
+	for _, t := range m.sesRejects {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	m.sesRejects = append(kept, at)
+}
+
+// GetSESRejects returns the times of rejected SES sends within the statistics window
+func (m *Memory) GetSESRejects() []time.Time {
+	m.sesMu.RLock()
+	defer m.sesMu.RUnlock()
+	cutoff := time.Now().UTC().Add(-sesStatsWindow)
+	var result []time.Time
+	for _, t := range m.sesRejects {
+		if t.After(cutoff) {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// AddConfigurationSet adds an SES configuration set. It returns false if a
+// configuration set with the same name already exists.
+func (m *Memory) AddConfigurationSet(set types.ConfigurationSet) bool {
+	m.sesMu.Lock()
+	defer m.sesMu.Unlock()
+	if _, ok := m.configurationSets[set.Name]; ok {
+		return false
+	}
+	m.configurationSets[set.Name] = &set
+	return true
+}
+
+// GetConfigurationSet returns a copy of the named SES configuration set
+func (m *Memory) GetConfigurationSet(name string) (types.ConfigurationSet, bool) {
+	m.sesMu.RLock()
+	defer m.sesMu.RUnlock()
+	set, ok := m.configurationSets[name]
+	if !ok {
+		return types.ConfigurationSet{}, false
+	}
+	return copyConfigurationSet(set), true
+}
+
+// GetConfigurationSets returns copies of all SES configuration sets sorted by name
+func (m *Memory) GetConfigurationSets() []types.ConfigurationSet {
+	m.sesMu.RLock()
+	defer m.sesMu.RUnlock()
+	result := make([]types.ConfigurationSet, 0, len(m.configurationSets))
+	for _, set := range m.configurationSets {
+		result = append(result, copyConfigurationSet(set))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// DeleteConfigurationSet removes an SES configuration set. It returns false if
+// the configuration set does not exist.
+func (m *Memory) DeleteConfigurationSet(name string) bool {
+	m.sesMu.Lock()
+	defer m.sesMu.Unlock()
+	if _, ok := m.configurationSets[name]; !ok {
+		return false
+	}
+	delete(m.configurationSets, name)
+	return true
+}
+
+// PutEventDestination adds or replaces an event destination on a configuration
+// set. It returns false if the configuration set does not exist.
+func (m *Memory) PutEventDestination(setName string, dest types.EventDestination) bool {
+	m.sesMu.Lock()
+	defer m.sesMu.Unlock()
+	set, ok := m.configurationSets[setName]
+	if !ok {
+		return false
+	}
+	for i, existing := range set.EventDestinations {
+		if existing.Name == dest.Name {
+			set.EventDestinations[i] = dest
+			return true
+		}
+	}
+	set.EventDestinations = append(set.EventDestinations, dest)
+	return true
+}
+
+// DeleteEventDestination removes an event destination from a configuration
+// set. It returns false if either does not exist.
+func (m *Memory) DeleteEventDestination(setName, destName string) bool {
+	m.sesMu.Lock()
+	defer m.sesMu.Unlock()
+	set, ok := m.configurationSets[setName]
+	if !ok {
+		return false
+	}
+	for i, existing := range set.EventDestinations {
+		if existing.Name == destName {
+			set.EventDestinations = append(set.EventDestinations[:i], set.EventDestinations[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func copyConfigurationSet(set *types.ConfigurationSet) types.ConfigurationSet {
+	result := *set
+	result.EventDestinations = make([]types.EventDestination, len(set.EventDestinations))
+	copy(result.EventDestinations, set.EventDestinations)
+	return result
+}
+
+// PutSuppressedDestination adds an address to the SES account suppression
+// list, replacing any existing entry for it
+func (m *Memory) PutSuppressedDestination(dest types.SuppressedDestination) {
+	m.sesMu.Lock()
+	defer m.sesMu.Unlock()
+	m.suppressedDestinations[strings.ToLower(dest.EmailAddress)] = dest
+}
+
+// GetSuppressedDestination returns the suppression list entry for an address
+func (m *Memory) GetSuppressedDestination(address string) (types.SuppressedDestination, bool) {
+	m.sesMu.RLock()
+	defer m.sesMu.RUnlock()
+	dest, ok := m.suppressedDestinations[strings.ToLower(address)]
+	return dest, ok
+}
+
+// GetSuppressedDestinations returns all suppression list entries, most
+// recently updated first
+func (m *Memory) GetSuppressedDestinations() []types.SuppressedDestination {
+	m.sesMu.RLock()
+	defer m.sesMu.RUnlock()
+	result := make([]types.SuppressedDestination, 0, len(m.suppressedDestinations))
+	for _, dest := range m.suppressedDestinations {
+		result = append(result, dest)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].LastUpdateTime.After(result[j].LastUpdateTime)
+	})
+	return result
+}
+
+// DeleteSuppressedDestination removes an address from the suppression list.
+// It returns false if the address is not on the list.
+func (m *Memory) DeleteSuppressedDestination(address string) bool {
+	m.sesMu.Lock()
+	defer m.sesMu.Unlock()
+	key := strings.ToLower(address)
+	if _, ok := m.suppressedDestinations[key]; !ok {
+		return false
+	}
+	delete(m.suppressedDestinations, key)
+	return true
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/appaka/resendpit/types"
+)
+
+// Usage is how much the stored emails take up. Bytes is their approximate
+// size, of which SpilledBytes are bodies moved to spill files.
+type Usage struct {
+	Emails        int   `json:"emails"`
+	Bytes         int64 `json:"bytes"`
+	SpilledEmails int   `json:"spilledEmails"`
+	SpilledBytes  int64 `json:"spilledBytes"`
+}
+
+// emailSize returns the approximate size of an email in bytes: the length
+// of its text fields, addresses, headers and metadata, plus the size of its
+// attachments as sent. Attachment content is not kept, but counting it lets
+// the size limit treat a 10 MB email like one.
+func emailSize(email types.Email) int64 {
+	n := len(email.ID) + len(email.Provider) + len(email.From) + len(email.Subject) +
+		len(email.HTML) + len(email.Text) + len(email.ReturnPath) +
+		len(email.ConfigurationSet) + len(email.TemplateID)
+	for _, list := range [][]string{email.To, email.CC, email.BCC, email.ReplyTo, email.SuppressedRecipients} {
+		for _, address := range list {
+			n += len(address)
+		}
+	}
+	for k, v := range email.Headers {
+		n += len(k) + len(v)
+	}
+	for k, v := range email.Metadata {
+		n += len(k) + len(v)
+	}
+	for _, tag := range email.Tags {
+		n += len(tag.Name) + len(tag.Value)
+	}
+	for _, a := range email.Attachments {
+		n += len(a.Filename) + len(a.ContentType) + len(a.ContentID) + len(a.Disposition) + len(a.URL)
+		if a.Size != nil {
+			n += *a.Size
+		}
+	}
+	for k, v := range email.TemplateData {
+		n += len(k) + len(fmt.Sprint(v))
+	}
+	return int64(n)
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"time"
+
+	"github.com/appaka/resendpit/types"
+)
+
+// maxSMS caps the text messages kept when the retention policy has no count
+// limit
+const maxSMS = 1000
+
+// AddSMS adds a new text message to the store (FIFO)
+func (m *Memory) AddSMS(sms types.SMS) {
+	max := m.retention.MaxCount
+	if max <= 0 {
+		max = maxSMS
+	}
+	m.smsMu.Lock()
+	m.smsMessages = append([]types.SMS{sms}, m.smsMessages...)
+	if len(m.smsMessages) > max {
+		m.smsMessages = m.smsMessages[:max]
+	}
+	m.smsMu.Unlock()
+
+	m.publish(types.SSEMessage{Type: "new-sms", SMS: &sms})
+}
+
+// GetSMSMessages returns a copy of all text messages
+func (m *Memory) GetSMSMessages() []types.SMS {
+	m.smsMu.RLock()
+	defer m.smsMu.RUnlock()
+	result := make([]types.SMS, len(m.smsMessages))
+	copy(result, m.smsMessages)
+	return result
+}
+
+// ClearSMS removes all text messages from the store
+func (m *Memory) ClearSMS() {
+	m.smsMu.Lock()
+	m.smsMessages = nil
+	m.smsMu.Unlock()
+
+	m.publish(types.SSEMessage{Type: "clear-sms"})
+}
+
+// GetSMSCount returns the current number of text messages
+func (m *Memory) GetSMSCount() int {
+	m.smsMu.RLock()
+	defer m.smsMu.RUnlock()
+	return len(m.smsMessages)
+}
+
+// expireSMS drops the text messages captured before cutoff
+func (m *Memory) expireSMS(cutoff time.Time) {
+	m.smsMu.Lock()
+	defer m.smsMu.Unlock()
+	// Text messages are stored newest first
+	n := len(m.smsMessages)
+	for n > 0 && m.smsMessages[n-1].CreatedAt.Before(cutoff) {
+		n--
+	}
+	m.smsMessages = m.smsMessages[:n]
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/appaka/resendpit/types"
+)
+
+// spiller moves large email bodies out of memory into files in a
+// directory, from which they are loaded when the email is read
+type spiller struct {
+	dir       string
+	threshold int64
+	seq       atomic.Int64
+}
+
+// spilledBody is the content of a spill file
+type spilledBody struct {
+	HTML string `json:"html,omitempty"`
+	Text string `json:"text,omitempty"`
+}
+
+// EnableSpill moves the HTML and text bodies of emails larger than
+// threshold bytes to files in dir, including the emails already stored.
+// Spill files left in dir by a previous run are removed.
+func (m *Memory) EnableSpill(dir string, threshold int64) error {
+	if dir == "" {
+		return errors.New("no spill directory: set RESENDPIT_SPILL_DIR or RESENDPIT_DATA_DIR")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	stale, _ := filepath.Glob(filepath.Join(dir, "email-*.json"))
+	for _, path := range stale {
+		os.Remove(path)
+	}
+
+	s := &spiller{dir: dir, threshold: threshold}
+	m.mu.Lock()
+	m.spill = s
+	var stored []types.Email
+	for _, box := range m.mailboxes {
+		for _, entry := range box.emails {
+			if entry.spillPath == "" {
+				stored = append(stored, entry.Email)
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	// The files are written without holding m.mu
+	paths := map[string]string{}
+	for _, email := range stored {
+		if path := s.write(email); path != "" {
+			paths[email.ID] = path
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, box := range m.mailboxes {
+		for i := range box.emails {
+			entry := &box.emails[i]
+			if path, ok := paths[entry.ID]; ok && entry.spillPath == "" {
+				m.markSpilled(entry, path)
+				delete(paths, entry.ID)
+			}
+		}
+	}
+	// Emails evicted meanwhile
+	for _, path := range paths {
+		os.Remove(path)
+	}
+	return nil
+}
+
+// write writes the bodies of email to a new file if they are over the
+// threshold, and returns its path. It returns "" if they are not, or if that
+// fails, so the email stays in memory. s may be nil.
+func (s *spiller) write(email types.Email) string {
+	if s == nil || int64(len(email.HTML)+len(email.Text)) <= s.threshold {
+		return ""
+	}
+	data, err := json.Marshal(spilledBody{HTML: email.HTML, Text: email.Text})
+	if err != nil {
+		return ""
+	}
+	path := filepath.Join(s.dir, fmt.Sprintf("email-%d.json", s.seq.Add(1)))
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		log.Printf("Failed to spill email %s: %v", email.ID, err)
+		return ""
+	}
+	return path
+}
+
+// markSpilled drops the bodies of entry, written to the file at path, from
+// memory. m.mu must be held.
+func (m *Memory) markSpilled(entry *storedEmail, path string) {
+	bodySize := int64(len(entry.HTML) + len(entry.Text))
+	entry.HTML, entry.Text = "", ""
+	entry.Spilled = true
+	entry.spillPath = path
+	entry.spilledBytes = bodySize
+	m.spilledBytes += bodySize
+	m.spilledEmails++
+}
+
+// load returns the email of entry with its spilled bodies read back. It
+// reads a file, so m.mu should not be held.
+func (entry *storedEmail) load() types.Email {
+	email := entry.Email
+	if entry.spillPath == "" {
+		return email
+	}
+	data, err := os.ReadFile(entry.spillPath)
+	if err != nil {
+		log.Printf("Failed to load spilled email %s: %v", entry.ID, err)
+		return email
+	}
+	var body spilledBody
+	if err := json.Unmarshal(data, &body); err != nil {
+		log.Printf("Failed to load spilled email %s: %v", entry.ID, err)
+		return email
+	}
+	email.HTML, email.Text = body.HTML, body.Text
+	email.Spilled = false
+	return email
+}
+
+// unspill removes the spill file of an evicted or cleared entry
+func (m *Memory) unspill(entry storedEmail) {
+	if entry.spillPath == "" {
+		return
+	}
+	os.Remove(entry.spillPath)
+	m.spilledBytes -= entry.spilledBytes
+	m.spilledEmails--
+}
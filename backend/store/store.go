@@ -1,103 +1,227 @@
 package store
 
 import (
+	"log"
 	"os"
-	"strconv"
-	"sync"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/appaka/resendpit/types"
 )
 
 var (
-	maxEmails = 50
-	mu        sync.RWMutex
-	emails    []types.Email
-
-	subscribersMu sync.RWMutex
-	subscribers   []chan types.SSEMessage
+	maxEmails      = 50
+	maxAge         time.Duration
+	maxBytes       int64
+	totalMaxBytes  int64
+	evictionPolicy = EvictFIFO
+	dataDir        string
+	spillThreshold int64
+	spillDir       string
+	mailboxConfigs []MailboxConfig
 )
 
 func init() {
+	// 0 lifts the count limit, for use with the age or size limits
 	if env := os.Getenv("RESENDPIT_MAX_EMAILS"); env != "" {
-		if n, err := strconv.Atoi(env); err == nil && n > 0 {
+		if n, ok := parseCount(env); ok {
 			maxEmails = n
 		}
 	}
+	if env := os.Getenv("RESENDPIT_MAX_AGE"); env != "" {
+		if d, ok := parseAge(env); ok {
+			maxAge = d
+		}
+	}
+	if env := os.Getenv("RESENDPIT_MAX_BYTES"); env != "" {
+		if n, ok := parseBytes(env); ok {
+			maxBytes = n
+		}
+	}
+	if env := os.Getenv("RESENDPIT_TOTAL_MAX_BYTES"); env != "" {
+		if n, ok := parseBytes(env); ok {
+			totalMaxBytes = n
+		}
+	}
+	if totalMaxBytes > 0 && maxBytes > totalMaxBytes {
+		log.Printf("RESENDPIT_MAX_BYTES is above RESENDPIT_TOTAL_MAX_BYTES and can never be reached")
+	}
+	if strings.EqualFold(os.Getenv("RESENDPIT_EVICTION"), EvictLRU) {
+		evictionPolicy = EvictLRU
+	}
+	dataDir = os.Getenv("RESENDPIT_DATA_DIR")
+	if env := os.Getenv("RESENDPIT_SPILL_THRESHOLD"); env != "" {
+		if n, ok := parseBytes(env); ok {
+			spillThreshold = n
+		}
+	}
+	spillDir = os.Getenv("RESENDPIT_SPILL_DIR")
+	if spillDir == "" && dataDir != "" {
+		spillDir = filepath.Join(dataDir, "spill")
+	}
+	mailboxConfigs = parseMailboxes(os.Getenv("RESENDPIT_MAILBOXES"), RetentionPolicy(), totalMaxBytes)
 }
 
-// AddEmail adds a new email to the store (FIFO)
-func AddEmail(email types.Email) {
-	mu.Lock()
-	emails = append([]types.Email{email}, emails...)
-	if len(emails) > maxEmails {
-		emails = emails[:maxEmails]
-	}
-	mu.Unlock()
+// TotalMaxBytes returns the cap on the size of all mailboxes together
+// (RESENDPIT_TOTAL_MAX_BYTES), 0 if there is none
+func TotalMaxBytes() int64 {
+	return totalMaxBytes
+}
 
-	broadcast(types.SSEMessage{Type: "new-email", Email: &email})
+// DataDir returns the directory captured emails are persisted in
+// (RESENDPIT_DATA_DIR), or "" to keep them in memory only
+func DataDir() string {
+	return dataDir
 }
 
-// GetEmails returns a copy of all emails
-func GetEmails() []types.Email {
-	mu.RLock()
-	defer mu.RUnlock()
-	result := make([]types.Email, len(emails))
-	copy(result, emails)
-	return result
+// MailboxConfigs returns the mailboxes configured with RESENDPIT_MAILBOXES
+func MailboxConfigs() []MailboxConfig {
+	return mailboxConfigs
 }
 
-// ClearEmails removes all emails from the store
-func ClearEmails() {
-	mu.Lock()
-	emails = nil
-	mu.Unlock()
+// SpillThreshold returns the body size above which email bodies are moved
+// out of memory (RESENDPIT_SPILL_THRESHOLD), 0 if they are not
+func SpillThreshold() int64 {
+	return spillThreshold
+}
 
-	broadcast(types.SSEMessage{Type: "clear"})
+// SpillDir returns the directory spilled bodies are written to
+// (RESENDPIT_SPILL_DIR, by default "spill" in the data directory), or "" if
+// neither is set
+func SpillDir() string {
+	return spillDir
 }
 
-// GetEmailCount returns the current number of emails
-func GetEmailCount() int {
-	mu.RLock()
-	defer mu.RUnlock()
-	return len(emails)
+// Store holds everything Resend-Pit captures or is configured with
+type Store interface {
+	EmailStore
+	SMSStore
+	SESStore
+	TemplateStore
+	RecipientListStore
+	RejectStore
+	OperationStore
+	BulkEmailStore
+	MailboxStore
 }
 
-// GetMaxEmails returns the configured maximum emails limit
-func GetMaxEmails() int {
-	return maxEmails
+// EmailStore holds captured emails, newest first
+type EmailStore interface {
+	// AddEmail adds a new email, evicting the oldest ones the retention
+	// policy no longer allows
+	AddEmail(email types.Email)
+	// GetEmails returns a copy of all emails, without spilled bodies
+	GetEmails() []types.Email
+	// GetEmail returns the email with the given ID, with its bodies
+	GetEmail(id string) (types.Email, bool)
+	// ClearEmails removes the emails of a mailbox, or of all mailboxes with
+	// AllMailboxes
+	ClearEmails(mailbox string)
+	// GetEmailCount returns the current number of emails
+	GetEmailCount() int
+	// GetMaxEmails returns the maximum number of emails kept, 0 if
+	// unlimited
+	GetMaxEmails() int
+	// GetRetention returns the retention policy
+	GetRetention() Retention
+	// GetUsage returns how much the stored emails take up
+	GetUsage() Usage
+	// EvictExpired evicts the emails older than the maximum age at now and
+	// returns how many were evicted
+	EvictExpired(now time.Time) int
 }
 
-// Subscribe creates a new SSE subscription channel
-func Subscribe() chan types.SSEMessage {
-	ch := make(chan types.SSEMessage, 10)
-	subscribersMu.Lock()
-	subscribers = append(subscribers, ch)
-	subscribersMu.Unlock()
-	return ch
+// MailboxStore partitions emails into named mailboxes. Each has its own
+// retention policy.
+type MailboxStore interface {
+	// ConfigureMailbox adds or replaces the configuration of a mailbox
+	ConfigureMailbox(cfg MailboxConfig)
+	// MailboxFor returns the configured mailbox for an API key or
+	// recipients, "" if none matches
+	MailboxFor(apiKey string, recipients []string) string
+	// GetMailboxEmails returns a copy of the emails of a mailbox, without
+	// spilled bodies
+	GetMailboxEmails(name string) []types.Email
+	// GetMailboxes describes the mailboxes
+	GetMailboxes() []MailboxInfo
 }
 
-// Unsubscribe removes a subscription channel
-func Unsubscribe(ch chan types.SSEMessage) {
-	subscribersMu.Lock()
-	defer subscribersMu.Unlock()
-	for i, sub := range subscribers {
-		if sub == ch {
-			subscribers = append(subscribers[:i], subscribers[i+1:]...)
-			close(ch)
-			return
-		}
-	}
+// SMSStore holds captured text messages, newest first
+type SMSStore interface {
+	AddSMS(sms types.SMS)
+	GetSMSMessages() []types.SMS
+	ClearSMS()
+	GetSMSCount() int
 }
 
-// broadcast sends a message to all subscribers
-func broadcast(msg types.SSEMessage) {
-	subscribersMu.RLock()
-	defer subscribersMu.RUnlock()
-	for _, ch := range subscribers {
-		select {
-		case ch <- msg:
-		default:
-			// Channel full, skip (slow client)
-		}
-	}
+// SESStore holds the SES account state: identities, send statistics,
+// configuration sets, the suppression list and contact lists
+type SESStore interface {
+	AddIdentity(identity types.Identity) types.Identity
+	GetIdentity(name string) (types.Identity, bool)
+	GetIdentities() []types.Identity
+
+	RecordSESReject(at time.Time)
+	GetSESRejects() []time.Time
+
+	AddConfigurationSet(set types.ConfigurationSet) bool
+	GetConfigurationSet(name string) (types.ConfigurationSet, bool)
+	GetConfigurationSets() []types.ConfigurationSet
+	DeleteConfigurationSet(name string) bool
+	PutEventDestination(setName string, dest types.EventDestination) bool
+	DeleteEventDestination(setName, destName string) bool
+
+	PutSuppressedDestination(dest types.SuppressedDestination)
+	GetSuppressedDestination(address string) (types.SuppressedDestination, bool)
+	GetSuppressedDestinations() []types.SuppressedDestination
+	DeleteSuppressedDestination(address string) bool
+
+	AddContactList(list types.ContactList) bool
+	UpdateContactList(list types.ContactList) bool
+	GetContactList(name string) (types.ContactList, bool)
+	GetContactLists() []types.ContactList
+	DeleteContactList(name string) bool
+	PutContact(listName string, contact types.Contact) bool
+	GetContact(listName, address string) (types.Contact, bool)
+	GetContacts(listName string) ([]types.Contact, bool)
+	DeleteContact(listName, address string) bool
+}
+
+// TemplateStore holds Postmark templates
+type TemplateStore interface {
+	AddTemplate(template types.Template) (types.Template, bool)
+	UpdateTemplate(template types.Template) bool
+	GetTemplate(idOrAlias string) (types.Template, bool)
+	GetTemplates() []types.Template
+	DeleteTemplate(id int) bool
+}
+
+// RecipientListStore holds SparkPost recipient lists
+type RecipientListStore interface {
+	AddRecipientList(list types.RecipientList) bool
+	UpdateRecipientList(list types.RecipientList) bool
+	GetRecipientList(id string) (types.RecipientList, bool)
+	GetRecipientLists() []types.RecipientList
+	DeleteRecipientList(id string) bool
+}
+
+// RejectStore holds the Mandrill rejection denylist
+type RejectStore interface {
+	PutReject(reject types.Reject)
+	GetReject(email string) (types.Reject, bool)
+	GetRejects() []types.Reject
+	DeleteReject(email string) bool
+}
+
+// OperationStore holds Azure send operations
+type OperationStore interface {
+	AddOperation(op types.Operation) (types.Operation, bool)
+	PollOperation(id string) (types.Operation, bool)
+}
+
+// BulkEmailStore holds MailerSend bulk email requests
+type BulkEmailStore interface {
+	AddBulkEmail(bulk types.BulkEmail)
+	GetBulkEmail(id string) (types.BulkEmail, bool)
 }
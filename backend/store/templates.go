@@ -0,0 +1,85 @@
+package store
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/appaka/resendpit/types"
+)
+
+// AddTemplate stores a new template and assigns its ID. It returns false if
+// another template already uses the alias.
+func (m *Memory) AddTemplate(template types.Template) (types.Template, bool) {
+	m.templatesMu.Lock()
+	defer m.templatesMu.Unlock()
+	if template.Alias != "" && m.findTemplateByAlias(template.Alias, 0) {
+		return types.Template{}, false
+	}
+	template.ID = m.nextTemplateID
+	m.nextTemplateID++
+	m.templates[template.ID] = template
+	return template, true
+}
+
+// UpdateTemplate replaces a template, keeping its ID. It returns false if
+// another template already uses the alias.
+func (m *Memory) UpdateTemplate(template types.Template) bool {
+	m.templatesMu.Lock()
+	defer m.templatesMu.Unlock()
+	if template.Alias != "" && m.findTemplateByAlias(template.Alias, template.ID) {
+		return false
+	}
+	m.templates[template.ID] = template
+	return true
+}
+
+// GetTemplate returns a template by numeric ID or by alias
+func (m *Memory) GetTemplate(idOrAlias string) (types.Template, bool) {
+	m.templatesMu.RLock()
+	defer m.templatesMu.RUnlock()
+	if id, err := strconv.Atoi(idOrAlias); err == nil {
+		template, ok := m.templates[id]
+		return template, ok
+	}
+	for _, template := range m.templates {
+		if template.Alias != "" && strings.EqualFold(template.Alias, idOrAlias) {
+			return template, true
+		}
+	}
+	return types.Template{}, false
+}
+
+// GetTemplates returns all templates sorted by ID
+func (m *Memory) GetTemplates() []types.Template {
+	m.templatesMu.RLock()
+	defer m.templatesMu.RUnlock()
+	result := make([]types.Template, 0, len(m.templates))
+	for _, template := range m.templates {
+		result = append(result, template)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// DeleteTemplate removes a template. It returns false if it does not exist.
+func (m *Memory) DeleteTemplate(id int) bool {
+	m.templatesMu.Lock()
+	defer m.templatesMu.Unlock()
+	if _, ok := m.templates[id]; !ok {
+		return false
+	}
+	delete(m.templates, id)
+	return true
+}
+
+// findTemplateByAlias reports whether a template other than exceptID uses
+// the alias. The caller must hold m.templatesMu.
+func (m *Memory) findTemplateByAlias(alias string, exceptID int) bool {
+	for id, template := range m.templates {
+		if id != exceptID && strings.EqualFold(template.Alias, alias) {
+			return true
+		}
+	}
+	return false
+}
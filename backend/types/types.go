@@ -13,11 +13,34 @@ type Email struct {
 	Subject     string            `json:"subject"`
 	HTML        string            `json:"html,omitempty"`
 	Text        string            `json:"text,omitempty"`
-	ReplyTo     string            `json:"replyTo,omitempty"`
+	ReplyTo     []string          `json:"replyTo,omitempty"`
 	Headers     map[string]string `json:"headers,omitempty"`
 	Tags        []Tag             `json:"tags,omitempty"`
 	Attachments []Attachment      `json:"attachments,omitempty"`
 	CreatedAt   time.Time         `json:"createdAt"`
+
+	// ReturnPath is where bounces and complaints are forwarded (SES
+	// ReturnPath / FeedbackForwardingEmailAddress)
+	ReturnPath string `json:"returnPath,omitempty"`
+	// ConfigurationSet is the SES configuration set the email was sent with
+	ConfigurationSet string `json:"configurationSet,omitempty"`
+	// Metadata holds provider-specific values that have no dedicated field
+	// (e.g. the SES SourceArn)
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// SuppressedRecipients lists recipients on the SES account suppression
+	// list, which the email was not delivered to
+	SuppressedRecipients []string `json:"suppressedRecipients,omitempty"`
+	// ScheduledAt is when the sender asked for the email to be delivered
+	ScheduledAt *time.Time `json:"scheduledAt,omitempty"`
+	// TemplateID and TemplateData record the provider-side template the
+	// email was sent with and its variables
+	TemplateID   string                 `json:"templateId,omitempty"`
+	TemplateData map[string]interface{} `json:"templateData,omitempty"`
+	// Mailbox is the mailbox the email was routed into
+	Mailbox string `json:"mailbox,omitempty"`
+	// Spilled marks an email listed without its HTML and text bodies, which
+	// were moved to disk; they are returned when it is requested by ID
+	Spilled bool `json:"spilled,omitempty"`
 }
 
 // Tag represents email metadata tags
@@ -28,8 +51,14 @@ type Tag struct {
 
 // Attachment represents an email attachment
 type Attachment struct {
-	Filename string `json:"filename"`
-	Size     *int   `json:"size,omitempty"`
+	Filename    string `json:"filename"`
+	Size        *int   `json:"size,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	ContentID   string `json:"contentId,omitempty"`
+	// Disposition is "attachment" or "inline"
+	Disposition string `json:"disposition,omitempty"`
+	// URL is where the provider was asked to fetch the content from
+	URL string `json:"url,omitempty"`
 }
 
 // ResendEmailRequest represents the incoming request from Resend SDK
@@ -41,7 +70,7 @@ type ResendEmailRequest struct {
 	Text        string            `json:"text,omitempty"`
 	CC          interface{}       `json:"cc,omitempty"`
 	BCC         interface{}       `json:"bcc,omitempty"`
-	ReplyTo     string            `json:"reply_to,omitempty"`
+	ReplyTo     interface{}       `json:"reply_to,omitempty"`
 	Headers     map[string]string `json:"headers,omitempty"`
 	Tags        []Tag             `json:"tags,omitempty"`
 	Attachments []AttachmentReq   `json:"attachments,omitempty"`
@@ -53,11 +82,35 @@ type AttachmentReq struct {
 	Content  string `json:"content,omitempty"`
 }
 
+// SMS represents a stored text message
+type SMS struct {
+	ID        string   `json:"id"`
+	Provider  string   `json:"provider"`
+	From      string   `json:"from,omitempty"`
+	To        string   `json:"to"`
+	Body      string   `json:"body"`
+	MediaURLs []string `json:"mediaUrls,omitempty"`
+	// Metadata holds provider-specific values (message SID, sender ID, SMS
+	// type, ...)
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	ScheduledAt *time.Time        `json:"scheduledAt,omitempty"`
+	CreatedAt   time.Time         `json:"createdAt"`
+}
+
 // SSEMessage represents a Server-Sent Event message
 type SSEMessage struct {
-	Type   string  `json:"type"`
-	Emails []Email `json:"emails,omitempty"`
-	Email  *Email  `json:"email,omitempty"`
+	Type        string  `json:"type"`
+	Emails      []Email `json:"emails,omitempty"`
+	Email       *Email  `json:"email,omitempty"`
+	SMSMessages []SMS   `json:"smsMessages,omitempty"`
+	SMS         *SMS    `json:"sms,omitempty"`
+	// ID and Reason identify an evicted email and why it was evicted
+	// (evict-email)
+	ID     string `json:"id,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// Mailbox is the mailbox of an evicted email, or the mailbox cleared
+	// (clear; empty when all were)
+	Mailbox string `json:"mailbox,omitempty"`
 }
 
 // ValidationError represents an API validation error
@@ -66,3 +119,139 @@ type ValidationError struct {
 	Message    string `json:"message"`
 	Name       string `json:"name"`
 }
+
+// Identity represents an SES sender identity (email address or domain)
+type Identity struct {
+	Identity           string    `json:"identity"`
+	Type               string    `json:"type"`
+	VerificationStatus string    `json:"verificationStatus"`
+	VerificationToken  string    `json:"verificationToken,omitempty"`
+	CreatedAt          time.Time `json:"createdAt"`
+}
+
+// ConfigurationSet represents an SES configuration set
+type ConfigurationSet struct {
+	Name              string             `json:"name"`
+	EventDestinations []EventDestination `json:"eventDestinations,omitempty"`
+	CreatedAt         time.Time          `json:"createdAt"`
+}
+
+// EventDestination represents an SES configuration set event destination.
+// MatchingEventTypes use the SES v2 spelling (SEND, DELIVERY, BOUNCE, ...).
+type EventDestination struct {
+	Name               string   `json:"name"`
+	Enabled            bool     `json:"enabled"`
+	MatchingEventTypes []string `json:"matchingEventTypes"`
+	SNSTopicArn        string   `json:"snsTopicArn,omitempty"`
+}
+
+// SuppressedDestination represents an address on the SES account suppression list
+type SuppressedDestination struct {
+	EmailAddress   string    `json:"emailAddress"`
+	Reason         string    `json:"reason"`
+	LastUpdateTime time.Time `json:"lastUpdateTime"`
+	MessageID      string    `json:"messageId,omitempty"`
+	FeedbackID     string    `json:"feedbackId,omitempty"`
+}
+
+// ContactList represents an SES v2 contact list
+type ContactList struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Topics      []Topic   `json:"topics,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// Topic represents a subscription topic of a contact list.
+// DefaultSubscriptionStatus is OPT_IN or OPT_OUT.
+type Topic struct {
+	Name                      string `json:"name"`
+	DisplayName               string `json:"displayName"`
+	Description               string `json:"description,omitempty"`
+	DefaultSubscriptionStatus string `json:"defaultSubscriptionStatus"`
+}
+
+// Contact represents a contact in an SES v2 contact list
+type Contact struct {
+	EmailAddress     string            `json:"emailAddress"`
+	TopicPreferences []TopicPreference `json:"topicPreferences,omitempty"`
+	UnsubscribeAll   bool              `json:"unsubscribeAll"`
+	AttributesData   string            `json:"attributesData,omitempty"`
+	CreatedAt        time.Time         `json:"createdAt"`
+	UpdatedAt        time.Time         `json:"updatedAt"`
+}
+
+// TopicPreference is a contact's subscription status (OPT_IN or OPT_OUT) for a topic
+type TopicPreference struct {
+	TopicName          string `json:"topicName"`
+	SubscriptionStatus string `json:"subscriptionStatus"`
+}
+
+// Template represents a stored email template (Postmark templates API).
+// TemplateType is "Standard" or "Layout"; a Standard template may reference
+// a layout by alias.
+type Template struct {
+	ID             int       `json:"id"`
+	Name           string    `json:"name"`
+	Alias          string    `json:"alias,omitempty"`
+	Subject        string    `json:"subject,omitempty"`
+	HTMLBody       string    `json:"htmlBody,omitempty"`
+	TextBody       string    `json:"textBody,omitempty"`
+	TemplateType   string    `json:"templateType"`
+	LayoutTemplate string    `json:"layoutTemplate,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// RecipientList represents a stored list of recipients (SparkPost
+// recipient lists)
+type RecipientList struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Recipients  []ListRecipient `json:"recipients"`
+	CreatedAt   time.Time       `json:"createdAt"`
+}
+
+// ListRecipient is a recipient of a recipient list, with the values it
+// contributes to each send
+type ListRecipient struct {
+	Email            string                 `json:"email"`
+	Name             string                 `json:"name,omitempty"`
+	HeaderTo         string                 `json:"headerTo,omitempty"`
+	Tags             []string               `json:"tags,omitempty"`
+	Metadata         map[string]interface{} `json:"metadata,omitempty"`
+	SubstitutionData map[string]interface{} `json:"substitutionData,omitempty"`
+}
+
+// Reject represents an address on the Mandrill rejection denylist. Sends to
+// it are rejected with Reason as the reject_reason.
+type Reject struct {
+	Email     string    `json:"email"`
+	Reason    string    `json:"reason"`
+	Detail    string    `json:"detail,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Operation represents an Azure Communication Services long-running send
+// operation. Status is Running until the operation is first polled, then
+// Succeeded.
+type Operation struct {
+	ID        string    `json:"id"`
+	Status    string    `json:"status"`
+	EmailID   string    `json:"emailId"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// BulkEmail represents a MailerSend bulk email request. ValidationErrors
+// is keyed by the invalid field of the skipped message.
+type BulkEmail struct {
+	ID               string              `json:"id"`
+	State            string              `json:"state"`
+	TotalRecipients  int                 `json:"totalRecipients"`
+	ValidationErrors map[string][]string `json:"validationErrors"`
+	MessageIDs       []string            `json:"messageIds"`
+	CreatedAt        time.Time           `json:"createdAt"`
+	UpdatedAt        time.Time           `json:"updatedAt"`
+}
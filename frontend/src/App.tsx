@@ -33,9 +33,17 @@ export default function App() {
               setEmails((prev) => [data.email!, ...prev].slice(0, 50));
             }
             break;
+          case 'evict-email':
+            setEmails((prev) => prev.filter((e) => e.id !== data.id));
+            setSelectedId((prev) => (prev === data.id ? null : prev));
+            break;
           case 'clear':
-            setEmails([]);
-            setSelectedId(null);
+            if (data.mailbox) {
+              setEmails((prev) => prev.filter((e) => e.mailbox !== data.mailbox));
+            } else {
+              setEmails([]);
+              setSelectedId(null);
+            }
             break;
         }
       } catch (e) {
@@ -56,7 +64,26 @@ export default function App() {
     }
   }, []);
 
-  const selectedEmail = emails.find((e) => e.id === selectedId) ?? null;
+  const listedEmail = emails.find((e) => e.id === selectedId) ?? null;
+  const [loadedEmail, setLoadedEmail] = useState<Email | null>(null);
+
+  // Fetch the opened email in full: spilled emails are listed without their
+  // bodies, and the read counts for LRU eviction
+  useEffect(() => {
+    if (!listedEmail) return;
+    let cancelled = false;
+    fetch(`/api/emails/${listedEmail.id}`)
+      .then((res) => (res.ok ? res.json() : null))
+      .then((email: Email | null) => {
+        if (!cancelled && email) setLoadedEmail(email);
+      })
+      .catch((e) => console.error('Failed to load email:', e));
+    return () => {
+      cancelled = true;
+    };
+  }, [listedEmail?.id]);
+
+  const selectedEmail = loadedEmail?.id === listedEmail?.id ? loadedEmail : listedEmail;
 
   return (
     <div className="flex h-screen flex-col bg-zinc-950">
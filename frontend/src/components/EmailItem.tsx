@@ -1,5 +1,5 @@
 import type { Email } from '../lib/types';
-import { formatRelativeTime } from '../lib/utils';
+import { formatRelativeTime, getProviderBadge } from '../lib/utils';
 
 interface EmailItemProps {
   email: Email;
@@ -8,6 +8,7 @@ interface EmailItemProps {
 }
 
 export function EmailItem({ email, selected, onClick }: EmailItemProps) {
+  const provider = getProviderBadge(email.provider);
   const fromName = email.from.includes('<')
     ? email.from.split('<')[0].trim()
     : email.from;
@@ -23,13 +24,9 @@ export function EmailItem({ email, selected, onClick }: EmailItemProps) {
         <div className="flex min-w-0 items-center gap-1.5">
           <span className="truncate text-sm font-medium text-zinc-200">{fromName}</span>
           <span
-            className={`shrink-0 rounded px-1 py-0.5 text-[10px] font-medium leading-none ${
-              email.provider === 'ses'
-                ? 'bg-amber-500/20 text-amber-400'
-                : 'bg-blue-500/20 text-blue-400'
-            }`}
+            className={`shrink-0 rounded px-1 py-0.5 text-[10px] font-medium leading-none ${provider.className}`}
           >
-            {email.provider === 'ses' ? 'SES' : 'Resend'}
+            {provider.label}
           </span>
         </div>
         <span className="shrink-0 text-xs text-zinc-500">
@@ -1,6 +1,6 @@
 import { useState, useMemo } from 'react';
 import type { Email } from '../lib/types';
-import { getHtmlSizeInfo, extractLinks } from '../lib/utils';
+import { getHtmlSizeInfo, extractLinks, getProviderBadge } from '../lib/utils';
 import { EmptyState } from './EmptyState';
 
 interface EmailPreviewProps {
@@ -58,12 +58,10 @@ export function EmailPreview({ email }: EmailPreviewProps) {
             <span className="w-12 text-zinc-500">Via:</span>
             <span
               className={`inline-flex items-center rounded px-1.5 py-0.5 text-xs font-medium ${
-                email.provider === 'ses'
-                  ? 'bg-amber-500/20 text-amber-400'
-                  : 'bg-blue-500/20 text-blue-400'
+                getProviderBadge(email.provider).className
               }`}
             >
-              {email.provider === 'ses' ? 'Amazon SES' : 'Resend'}
+              {getProviderBadge(email.provider).name}
             </span>
           </div>
           <div className="flex gap-2">
@@ -86,10 +84,18 @@ export function EmailPreview({ email }: EmailPreviewProps) {
               <span className="text-zinc-300">{email.bcc.join(', ')}</span>
             </div>
           )}
-          {email.replyTo && (
+          {email.suppressedRecipients && email.suppressedRecipients.length > 0 && (
+            <div className="flex gap-2">
+              <span className="w-12 text-zinc-500">Supp.:</span>
+              <span className="text-red-400">
+                {email.suppressedRecipients.join(', ')} (not delivered)
+              </span>
+            </div>
+          )}
+          {email.replyTo && email.replyTo.length > 0 && (
             <div className="flex gap-2">
               <span className="w-12 text-zinc-500">Reply:</span>
-              <span className="text-zinc-300">{email.replyTo}</span>
+              <span className="text-zinc-300">{email.replyTo.join(', ')}</span>
             </div>
           )}
           <div className="flex gap-2">
@@ -8,15 +8,48 @@ export interface Email {
   subject: string;
   html?: string;
   text?: string;
-  replyTo?: string;
+  replyTo?: string[];
   headers?: Record<string, string>;
   tags?: Array<{ name: string; value: string }>;
-  attachments?: Array<{ filename: string; size?: number }>;
+  attachments?: Array<{
+    filename: string;
+    size?: number;
+    contentType?: string;
+    contentId?: string;
+    disposition?: 'attachment' | 'inline';
+    url?: string;
+  }>;
+  createdAt: string;
+  returnPath?: string;
+  metadata?: Record<string, string>;
+  configurationSet?: string;
+  suppressedRecipients?: string[];
+  scheduledAt?: string;
+  templateId?: string;
+  templateData?: Record<string, unknown>;
+  mailbox?: string;
+  spilled?: boolean;
+}
+
+export interface SMS {
+  id: string;
+  provider: string;
+  from?: string;
+  to: string;
+  body: string;
+  mediaUrls?: string[];
+  metadata?: Record<string, string>;
+  scheduledAt?: string;
   createdAt: string;
 }
 
 export interface SSEMessage {
-  type: 'init' | 'new-email' | 'clear';
+  type: 'init' | 'new-email' | 'evict-email' | 'clear' | 'new-sms' | 'clear-sms';
   emails?: Email[];
   email?: Email;
+  smsMessages?: SMS[];
+  sms?: SMS;
+  id?: string;
+  reason?: 'age' | 'count' | 'bytes';
+  mailbox?: string;
 }
@@ -51,3 +51,37 @@ export function extractLinks(html: string): ExtractedLink[] {
     isExternal: (link.getAttribute('href') || '').startsWith('http'),
   }));
 }
+
+export interface ProviderBadge {
+  label: string;
+  name: string;
+  className: string;
+}
+
+const PROVIDER_BADGES: Record<string, ProviderBadge> = {
+  resend: { label: 'Resend', name: 'Resend', className: 'bg-blue-500/20 text-blue-400' },
+  ses: { label: 'SES', name: 'Amazon SES', className: 'bg-amber-500/20 text-amber-400' },
+  brevo: { label: 'Brevo', name: 'Brevo', className: 'bg-teal-500/20 text-teal-400' },
+  mailgun: { label: 'Mailgun', name: 'Mailgun', className: 'bg-red-500/20 text-red-400' },
+  sparkpost: { label: 'SparkPost', name: 'SparkPost', className: 'bg-orange-500/20 text-orange-400' },
+  mandrill: { label: 'Mandrill', name: 'Mandrill', className: 'bg-pink-500/20 text-pink-400' },
+  postmark: { label: 'Postmark', name: 'Postmark', className: 'bg-yellow-500/20 text-yellow-300' },
+  sendgrid: { label: 'SendGrid', name: 'SendGrid', className: 'bg-sky-500/20 text-sky-400' },
+  msgraph: { label: 'Graph', name: 'Microsoft Graph', className: 'bg-indigo-500/20 text-indigo-400' },
+  gmail: { label: 'Gmail', name: 'Gmail API', className: 'bg-rose-500/20 text-rose-400' },
+  azure: { label: 'Azure', name: 'Azure Communication Services', className: 'bg-cyan-500/20 text-cyan-400' },
+  mailersend: { label: 'MailerSend', name: 'MailerSend', className: 'bg-violet-500/20 text-violet-400' },
+  loops: { label: 'Loops', name: 'Loops', className: 'bg-lime-500/20 text-lime-400' },
+  customerio: { label: 'Customer.io', name: 'Customer.io', className: 'bg-emerald-500/20 text-emerald-400' },
+  smtp: { label: 'SMTP', name: 'SMTP', className: 'bg-zinc-500/20 text-zinc-300' },
+};
+
+export function getProviderBadge(provider: string): ProviderBadge {
+  return (
+    PROVIDER_BADGES[provider] ?? {
+      label: provider,
+      name: provider,
+      className: 'bg-zinc-500/20 text-zinc-300',
+    }
+  );
+}